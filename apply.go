@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// deploymentApplier server-side applies Deployments.
+type deploymentApplier interface {
+	Apply(ctx context.Context, namespace, name string, data []byte) (*appsv1.Deployment, error)
+}
+
+// restDeploymentApplier applies Deployments through the apps/v1 REST
+// client, the typed client doesn't take the field manager of a patch.
+type restDeploymentApplier struct {
+	client rest.Interface
+}
+
+// Apply sends the apply patch forcing the ownership of conflicting fields:
+// the fields the controller sets are the ones it reconciles. The request is
+// cancelled with ctx.
+func (a *restDeploymentApplier) Apply(ctx context.Context, namespace, name string, data []byte) (*appsv1.Deployment, error) {
+	force := true
+	result := &appsv1.Deployment{}
+	err := a.client.Patch(types.ApplyPatchType).
+		Namespace(namespace).
+		Resource("deployments").
+		Name(name).
+		VersionedParams(&metav1.PatchOptions{FieldManager: fieldManager, Force: &force}, scheme.ParameterCodec).
+		Body(data).
+		Context(ctx).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// applyConfiguration renders the apply patch of the Deployment: only the
+// fields set by newDeployment, so fields set by mutating webhooks or by
+// hand are left to their owners.
+func applyConfiguration(deployment *appsv1.Deployment) ([]byte, error) {
+	deployment = deployment.DeepCopy()
+	deployment.TypeMeta = metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"}
+	deployment.ResourceVersion = ""
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deployment)
+	if err != nil {
+		return nil, err
+	}
+	// The zero creation timestamps and status are rendered as null and
+	// would clear the ones set by the API server.
+	unstructured.RemoveNestedField(object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(object, "spec", "template", "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(object, "status")
+	return json.Marshal(object)
+}
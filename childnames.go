@@ -0,0 +1,180 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/naming"
+)
+
+// defaultDeploymentNameTemplate names Deployments after their InferenceJob.
+const defaultDeploymentNameTemplate = "{{.JobName}}"
+
+// ownerUIDIndex indexes Deployments by the UID of the InferenceJob
+// controlling them, and by the one their InferenceJobUIDLabel ties them to.
+const ownerUIDIndex = "ownerUID"
+
+func indexByOwnerUID(obj interface{}) ([]string, error) {
+	deployment, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return nil, nil
+	}
+	var uids []string
+	if ref := metav1.GetControllerOf(deployment); ref != nil && ref.Kind == "InferenceJob" {
+		uids = append(uids, string(ref.UID))
+	}
+	if uid := deployment.Labels[InferenceJobUIDLabel]; uid != "" && (len(uids) == 0 || uids[0] != uid) {
+		uids = append(uids, uid)
+	}
+	return uids, nil
+}
+
+// ownedDeployments returns the Deployments controlled by the InferenceJob
+// or labelled with its UID, without going through the other Deployments of
+// its namespace.
+func (c *Controller) ownedDeployments(inferenceJob *samplev1alpha1.InferenceJob) ([]*appsv1.Deployment, error) {
+	objs, err := c.deploymentsIndexer.ByIndex(ownerUIDIndex, string(inferenceJob.UID))
+	if err != nil {
+		return nil, err
+	}
+	deployments := make([]*appsv1.Deployment, 0, len(objs))
+	for _, obj := range objs {
+		deployments = append(deployments, obj.(*appsv1.Deployment))
+	}
+	return deployments, nil
+}
+
+// deploymentName returns the name of the workload of the InferenceJob:
+// spec.deploymentName if set, otherwise the rendered name template of its
+// workload type, see childName. StatefulSets and DaemonSets without a
+// template of their own are named like the Deployment.
+func (c *Controller) deploymentName(inferenceJob *samplev1alpha1.InferenceJob) (string, error) {
+	if inferenceJob.Spec.DeploymentName != "" {
+		return inferenceJob.Spec.DeploymentName, nil
+	}
+	templates := jobNameTemplates(inferenceJob)
+	var name string
+	var err error
+	switch inferenceJob.Spec.WorkloadType {
+	case samplev1alpha1.WorkloadTypeStatefulSet:
+		name, err = childName("statefulset", inferenceJob, templates.StatefulSet, c.nameTemplates.StatefulSet)
+	case samplev1alpha1.WorkloadTypeDaemonSet:
+		name, err = childName("daemonset", inferenceJob, templates.DaemonSet, c.nameTemplates.DaemonSet)
+	}
+	if name != "" || err != nil {
+		return name, err
+	}
+	return childName("deployment", inferenceJob, templates.Deployment, c.nameTemplates.Deployment)
+}
+
+// serviceName returns the name of the headless Service of the StatefulSet
+// of the InferenceJob: the rendered Service name template, otherwise the
+// name of the StatefulSet.
+func (c *Controller) serviceName(inferenceJob *samplev1alpha1.InferenceJob, statefulSetName string) (string, error) {
+	name, err := childName("service", inferenceJob, jobNameTemplates(inferenceJob).Service, c.nameTemplates.Service)
+	if name == "" && err == nil {
+		name = statefulSetName
+	}
+	return name, err
+}
+
+// childName renders the name template of a kind of child of the
+// InferenceJob: its own if set, otherwise the one of the controller. The
+// name is empty if neither is set.
+func childName(kind string, inferenceJob *samplev1alpha1.InferenceJob, jobTemplate, controllerTemplate string) (string, error) {
+	tmpl := controllerTemplate
+	if jobTemplate != "" {
+		tmpl = jobTemplate
+	}
+	if tmpl == "" {
+		return "", nil
+	}
+	return naming.Render(kind, tmpl, naming.Data{
+		JobName:   inferenceJob.Name,
+		Namespace: inferenceJob.Namespace,
+		Version:   naming.Version(inferenceJob.Spec.ImageToDeploy),
+	})
+}
+
+// jobNameTemplates returns the name templates of the InferenceJob, empty if
+// it has none.
+func jobNameTemplates(inferenceJob *samplev1alpha1.InferenceJob) samplev1alpha1.NameTemplates {
+	if inferenceJob.Spec.NameTemplates == nil {
+		return samplev1alpha1.NameTemplates{}
+	}
+	return *inferenceJob.Spec.NameTemplates
+}
+
+// deleteSupersededDeployments deletes the Deployments controlled by the
+// InferenceJob other than the current one, e.g. those of previous versions
+// when the Deployment name template includes the version or the one left
+// behind by a rename of spec.deploymentName. It waits for the current
+// Deployment to be fully available so traffic is never left without
+// replicas.
+func (c *Controller) deleteSupersededDeployments(inferenceJob *samplev1alpha1.InferenceJob, current *appsv1.Deployment) error {
+	if !fullyAvailable(current) {
+		return nil
+	}
+	superseded, err := c.supersededDeployments(inferenceJob, current.Name)
+	if err != nil {
+		return err
+	}
+	for _, name := range superseded {
+		klog.V(4).Infof("Deleting deployment %s superseded by %s", name, current.Name)
+		err := c.kubeclientset.AppsV1().Deployments(inferenceJob.Namespace).Delete(name, nil)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// supersededDeployments lists the Deployments of the InferenceJob
+// deleteSupersededDeployments would delete next to the named one.
+func (c *Controller) supersededDeployments(inferenceJob *samplev1alpha1.InferenceJob, deploymentName string) ([]string, error) {
+	deployments, err := c.ownedDeployments(inferenceJob)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, deployment := range deployments {
+		if deployment.Name != deploymentName && (metav1.IsControlledBy(deployment, inferenceJob) || lastDeploymentOf(deployment, inferenceJob)) {
+			names = append(names, deployment.Name)
+		}
+	}
+	return names, nil
+}
+
+// lastDeploymentOf reports whether the Deployment is the one recorded in the
+// status of the InferenceJob and has since lost its owner reference, which
+// the UID label stamped by the controller still ties to the InferenceJob.
+func lastDeploymentOf(deployment *appsv1.Deployment, inferenceJob *samplev1alpha1.InferenceJob) bool {
+	return deployment.Name == inferenceJob.Status.DeploymentName &&
+		deployment.Labels[InferenceJobUIDLabel] == string(inferenceJob.UID) &&
+		metav1.GetControllerOf(deployment) == nil
+}
+
+// fullyAvailable reports whether every desired replica of the Deployment is
+// available.
+func fullyAvailable(deployment *appsv1.Deployment) bool {
+	return deployment.Spec.Replicas == nil || deployment.Status.AvailableReplicas >= *deployment.Spec.Replicas
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// CleanupFinalizer holds the deletion of InferenceJobs until their
+	// cleanup hooks have run.
+	CleanupFinalizer = "fabianoyoschitaki.io/cleanup"
+
+	// ErrCleanupFailed is used as part of the Event 'reason' when a cleanup
+	// hook of a deleted InferenceJob fails.
+	ErrCleanupFailed = "CleanupFailed"
+	// MessageCleanupFailed is the message used for Events when a cleanup
+	// hook of a deleted InferenceJob fails.
+	MessageCleanupFailed = "Cleanup hook %s failed: %s"
+)
+
+// cleanupHook runs before a deleted InferenceJob disappears, e.g. to
+// deregister its model from an external registry, flush caches or remove
+// resources it doesn't own. Hooks must be idempotent: a failed cleanup is
+// retried from the first hook.
+type cleanupHook interface {
+	Name() string
+	Cleanup(inferenceJob *samplev1alpha1.InferenceJob) error
+}
+
+// webhookCleanup posts deleted InferenceJobs to an HTTP endpoint, which
+// answers with a 2xx status once it is done cleaning up after them.
+type webhookCleanup struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookCleanup(url string, timeout time.Duration) *webhookCleanup {
+	return &webhookCleanup{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (w *webhookCleanup) Name() string {
+	return w.url
+}
+
+// Cleanup posts the InferenceJob to the endpoint.
+func (w *webhookCleanup) Cleanup(inferenceJob *samplev1alpha1.InferenceJob) error {
+	body, err := json.Marshal(inferenceJob)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// syncCleanupFinalizer adds CleanupFinalizer to InferenceJobs if cleanup
+// hooks are configured and removes it otherwise. It returns true if the
+// InferenceJob was updated, in which case the sync ends and continues with
+// the update event.
+func (c *Controller) syncCleanupFinalizer(inferenceJob *samplev1alpha1.InferenceJob) (bool, error) {
+	cleanup := len(c.cleanupHooks) > 0
+	if cleanup == hasFinalizer(inferenceJob, CleanupFinalizer) {
+		return false, nil
+	}
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	if cleanup {
+		inferenceJobCopy.Finalizers = append(inferenceJobCopy.Finalizers, CleanupFinalizer)
+	} else {
+		inferenceJobCopy.Finalizers = removeFinalizer(inferenceJobCopy.Finalizers, CleanupFinalizer)
+	}
+	_, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).Update(inferenceJobCopy)
+	return true, err
+}
+
+// runCleanupHooks runs the cleanup hooks of a deleted InferenceJob and then
+// releases it by removing CleanupFinalizer. A failed hook is reported with
+// an Event and retried with the sync.
+func (c *Controller) runCleanupHooks(inferenceJob *samplev1alpha1.InferenceJob) error {
+	for _, hook := range c.cleanupHooks {
+		if err := hook.Cleanup(inferenceJob); err != nil {
+			c.recorder.Eventf(inferenceJob, corev1.EventTypeWarning, ErrCleanupFailed, MessageCleanupFailed, hook.Name(), err.Error())
+			return fmt.Errorf("cleanup hook %s of inferenceJob %s/%s failed: %s", hook.Name(), inferenceJob.Namespace, inferenceJob.Name, err.Error())
+		}
+	}
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	inferenceJobCopy.Finalizers = removeFinalizer(inferenceJobCopy.Finalizers, CleanupFinalizer)
+	_, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).Update(inferenceJobCopy)
+	return err
+}
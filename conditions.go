@@ -0,0 +1,134 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// newCondition creates a new InferenceJob condition.
+func newCondition(condType samplev1alpha1.InferenceJobConditionType, status corev1.ConditionStatus, reason, message string) samplev1alpha1.InferenceJobCondition {
+	return samplev1alpha1.InferenceJobCondition{
+		Type:               condType,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// getCondition returns the condition with the provided type.
+func getCondition(status samplev1alpha1.InferenceJobStatus, condType samplev1alpha1.InferenceJobConditionType) *samplev1alpha1.InferenceJobCondition {
+	for i := range status.Conditions {
+		c := status.Conditions[i]
+		if c.Type == condType {
+			return &c
+		}
+	}
+	return nil
+}
+
+// setCondition updates the InferenceJob to include the provided condition.
+// If the condition that we are about to add already exists and has the same
+// status and reason then we are not going to update.
+func setCondition(status *samplev1alpha1.InferenceJobStatus, condition samplev1alpha1.InferenceJobCondition) {
+	currentCond := getCondition(*status, condition.Type)
+	if currentCond != nil && currentCond.Status == condition.Status && currentCond.Reason == condition.Reason && currentCond.Message == condition.Message {
+		return
+	}
+	// Do not update lastTransitionTime if the status of the condition doesn't change.
+	if currentCond != nil && currentCond.Status == condition.Status {
+		condition.LastTransitionTime = currentCond.LastTransitionTime
+	}
+	newConditions := filterOutCondition(status.Conditions, condition.Type)
+	status.Conditions = append(newConditions, condition)
+}
+
+// removeCondition removes the InferenceJob condition with the provided type.
+func removeCondition(status *samplev1alpha1.InferenceJobStatus, condType samplev1alpha1.InferenceJobConditionType) {
+	status.Conditions = filterOutCondition(status.Conditions, condType)
+}
+
+// filterOutCondition returns a new slice of conditions without conditions
+// with the provided type.
+func filterOutCondition(conditions []samplev1alpha1.InferenceJobCondition, condType samplev1alpha1.InferenceJobConditionType) []samplev1alpha1.InferenceJobCondition {
+	var newConditions []samplev1alpha1.InferenceJobCondition
+	for _, c := range conditions {
+		if c.Type == condType {
+			continue
+		}
+		newConditions = append(newConditions, c)
+	}
+	return newConditions
+}
+
+// setDeploymentConditions sets the Available, Progressing and Degraded
+// conditions of an InferenceJob from its Deployment, and its Ready
+// condition if it has no post-rollout test.
+func setDeploymentConditions(status *samplev1alpha1.InferenceJobStatus, inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment) {
+	available := newCondition(samplev1alpha1.Available, corev1.ConditionUnknown, "DeploymentPending", "")
+	for _, cond := range deployment.Status.Conditions {
+		if cond.Type == appsv1.DeploymentAvailable {
+			available = newCondition(samplev1alpha1.Available, cond.Status, cond.Reason, cond.Message)
+		}
+	}
+	setCondition(status, available)
+	if inferenceJob.Spec.PostRolloutTest == nil {
+		setCondition(status, newCondition(samplev1alpha1.Ready, available.Status, available.Reason, available.Message))
+	}
+
+	var deadlineExceeded *appsv1.DeploymentCondition
+	for i, cond := range deployment.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			deadlineExceeded = &deployment.Status.Conditions[i]
+		}
+	}
+	switch {
+	case deadlineExceeded != nil:
+		setCondition(status, newCondition(samplev1alpha1.Progressing, corev1.ConditionFalse, deadlineExceeded.Reason, deadlineExceeded.Message))
+		setCondition(status, newCondition(samplev1alpha1.Degraded, corev1.ConditionTrue, deadlineExceeded.Reason, deadlineExceeded.Message))
+		return
+	case rolloutComplete(deployment):
+		setCondition(status, newCondition(samplev1alpha1.Progressing, corev1.ConditionFalse, "RolloutComplete", ""))
+	default:
+		setCondition(status, newCondition(samplev1alpha1.Progressing, corev1.ConditionTrue, "RolloutInProgress", ""))
+	}
+	removeCondition(status, samplev1alpha1.Degraded)
+}
+
+// setReplicaConditions sets the Available, Progressing, Ready and Degraded
+// conditions of an InferenceJob running in a StatefulSet or DaemonSet from
+// its number of ready and desired pods.
+func setReplicaConditions(status *samplev1alpha1.InferenceJobStatus, ready, desired int32) {
+	if ready >= desired {
+		setCondition(status, newCondition(samplev1alpha1.Available, corev1.ConditionTrue, "PodsReady", ""))
+		setCondition(status, newCondition(samplev1alpha1.Progressing, corev1.ConditionFalse, "RolloutComplete", ""))
+	} else {
+		msg := fmt.Sprintf("%d of %d pods ready", ready, desired)
+		setCondition(status, newCondition(samplev1alpha1.Available, corev1.ConditionFalse, "PodsNotReady", msg))
+		setCondition(status, newCondition(samplev1alpha1.Progressing, corev1.ConditionTrue, "RolloutInProgress", msg))
+	}
+	available := getCondition(*status, samplev1alpha1.Available)
+	setCondition(status, newCondition(samplev1alpha1.Ready, available.Status, available.Reason, available.Message))
+	removeCondition(status, samplev1alpha1.Degraded)
+}
@@ -17,14 +17,20 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	appsinformers "k8s.io/client-go/informers/apps/v1"
@@ -32,6 +38,7 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
@@ -42,10 +49,40 @@ import (
 	samplescheme "k8s.io/sample-controller/pkg/generated/clientset/versioned/scheme"
 	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions/samplecontroller/v1alpha1"
 	listers "k8s.io/sample-controller/pkg/generated/listers/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/naming"
+	"k8s.io/sample-controller/pkg/policy"
 )
 
 const controllerAgentName = "sample-controller"
 
+// defaultShutdownTimeout is how long workers may drain the workqueue on
+// shutdown unless configured otherwise.
+const defaultShutdownTimeout = 30 * time.Second
+
+// defaultSyncTimeout is the deadline of a single sync of an InferenceJob
+// unless configured otherwise.
+const defaultSyncTimeout = time.Minute
+
+// gpuResourceName is the extended resource advertised by the NVIDIA device
+// plugin.
+const gpuResourceName corev1.ResourceName = "nvidia.com/gpu"
+
+// threadTuningEnvVars are the thread count variables injected when
+// spec.threadTuning is set.
+var threadTuningEnvVars = []string{
+	"GOMAXPROCS",
+	"OMP_NUM_THREADS",
+	"MKL_NUM_THREADS",
+	"TF_NUM_INTRAOP_THREADS",
+}
+
+// modelURIEnvVar passes spec.modelURI to the inference container.
+const modelURIEnvVar = "MODEL_URI"
+
+// alertReceiverAnnotationPrefix prefixes the annotations carrying the alert
+// receivers of an InferenceJob, one annotation per receiver type.
+const alertReceiverAnnotationPrefix = "alerting.fabianoyoschitaki.io/"
+
 const (
 	// SuccessSynced is used as part of the Event 'reason' when a InferenceJob is synced
 	SuccessSynced = "Synced"
@@ -68,10 +105,20 @@ type Controller struct {
 	// sampleclientset is a clientset for our own API group
 	sampleclientset clientset.Interface
 
-	deploymentsLister   appslisters.DeploymentLister
-	deploymentsSynced   cache.InformerSynced
+	deploymentsLister appslisters.DeploymentLister
+	deploymentsSynced cache.InformerSynced
+	// deploymentsIndexer indexes Deployments by ownerUIDIndex.
+	deploymentsIndexer  cache.Indexer
 	inferenceJobsLister listers.InferenceJobLister
 	inferenceJobsSynced cache.InformerSynced
+	// inferenceJobsIndexer indexes InferenceJobs by deploymentNameIndex.
+	inferenceJobsIndexer cache.Indexer
+	// podsLister is set if pods are watched, see watchPods.
+	podsLister corelisters.PodLister
+	podsSynced cache.InformerSynced
+	// nodesLister is set if nodes are watched, see watchNodes.
+	nodesLister corelisters.NodeLister
+	nodesSynced cache.InformerSynced
 
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
@@ -79,9 +126,97 @@ type Controller struct {
 	// time, and makes it easy to ensure we are never processing the same item
 	// simultaneously in two different workers.
 	workqueue workqueue.RateLimitingInterface
+	// retryLimiter backs off the retries of InferenceJobs on a curve
+	// picked by the class of their sync error.
+	retryLimiter *classRateLimiter
+	// importqueue holds the keys of Deployments annotated for import into
+	// a new InferenceJob.
+	importqueue workqueue.RateLimitingInterface
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
+	// lastSynced records when InferenceJobs were last reconciled to honor
+	// their reconcile policy.
+	lastSynced *syncTimes
+	// messages holds the templates customizing Event and condition
+	// messages.
+	messages *messageCatalog
+	// policy evaluates the lint rules reported in the PolicyViolations
+	// condition.
+	policy *policy.Engine
+	// podLoad, if set, is used to rank pods by load before a scale-down so
+	// the least loaded replicas are terminated first.
+	podLoad podLoadProvider
+	// promotion, if set, allows InferenceJobs to be promoted to other
+	// namespaces with PromoteAnnotation.
+	promotion *promotionConfig
+	// nameTemplates name the children of InferenceJobs without name
+	// templates of their own, see childName.
+	nameTemplates samplev1alpha1.NameTemplates
+	// observeOnly stops all writes to the workloads of InferenceJobs outside
+	// of enforcedNamespaces. Their status reports the pending changes.
+	observeOnly        bool
+	enforcedNamespaces map[string]bool
+	// dryRun observes every namespace and only logs and records Events for
+	// the changes it would make, without writing the status either.
+	dryRun bool
+	// rolloutTests runs the HTTP post-rollout tests of InferenceJobs.
+	rolloutTests *rolloutTestRunner
+	// hibernation, if set, scales InferenceJobs to zero during off-hours
+	// windows.
+	hibernation *hibernationConfig
+	// creations holds the Deployments created but not yet reported by the
+	// informer.
+	creations *creationExpectations
+	// metrics counts the syncs and writes of the controller, see serveMetrics.
+	metrics *controllerMetrics
+	// deploymentWrites limits the concurrent Deployment writes per
+	// namespace.
+	deploymentWrites *namespaceLimiter
+	// deploymentApplier server-side applies the Deployments of
+	// InferenceJobs.
+	deploymentApplier deploymentApplier
+	// externalPolicy, if set, reviews Deployments before they are created
+	// or updated.
+	externalPolicy *externalPolicy
+	// metricsPush, if set, pushes the metrics scraped from the pods of
+	// InferenceJobs.
+	metricsPush *metricsPusher
+	// accelerators, if set, holds the GPU memory InferenceJobs are checked
+	// to fit their model in.
+	accelerators *policy.AcceleratorMemory
+	// orphans, if set, is run every orphanSweepInterval to remove the
+	// resources left behind by deleted InferenceJobs.
+	orphans             *orphanSweeper
+	orphanSweepInterval time.Duration
+	// clusterDomain is the DNS domain of the cluster the addresses of
+	// InferenceJobs are reported in.
+	clusterDomain string
+	// cleanupHooks run before deleted InferenceJobs disappear, held by
+	// CleanupFinalizer while any are configured.
+	cleanupHooks []cleanupHook
+	// requeueInterval, if set, reconciles InferenceJobs again this long
+	// after they were last synced, independent of the informer resync.
+	requeueInterval time.Duration
+	// shutdownTimeout is how long workers may drain the workqueue on
+	// shutdown.
+	shutdownTimeout time.Duration
+	// maxRetries, if set, is the number of times a failing InferenceJob is
+	// retried before it is marked Failed and left alone until its spec
+	// changes.
+	maxRetries int
+	// syncTimeout, if set, is the deadline of a single sync. Writes aren't
+	// started past it and the server-side apply of the Deployment is
+	// cancelled when it passes.
+	syncTimeout time.Duration
+	// settleWindow, if set, delays the sync of an updated InferenceJob so
+	// the updates following within the window are synced with it.
+	settleWindow time.Duration
+	// shards, if set, restricts the controller to the InferenceJobs of its
+	// shard.
+	shards *shards
+	// traceAll logs the sync steps of every InferenceJob, see trace.
+	traceAll bool
 }
 
 // NewController returns a new sample controller
@@ -90,6 +225,18 @@ func NewController(
 	sampleclientset clientset.Interface,
 	deploymentInformer appsinformers.DeploymentInformer,
 	inferenceJobInformer informers.InferenceJobInformer) *Controller {
+	return NewControllerWithRateLimiter(kubeclientset, sampleclientset, deploymentInformer, inferenceJobInformer, nil)
+}
+
+// NewControllerWithRateLimiter returns a new sample controller retrying
+// failed syncs with rateLimiter. If nil, retries back off on the curve of
+// the class of their error, see classRateLimiter.
+func NewControllerWithRateLimiter(
+	kubeclientset kubernetes.Interface,
+	sampleclientset clientset.Interface,
+	deploymentInformer appsinformers.DeploymentInformer,
+	inferenceJobInformer informers.InferenceJobInformer,
+	rateLimiter workqueue.RateLimiter) *Controller {
 
 	// Create event broadcaster
 	// Add sample-controller types to the default Kubernetes Scheme so Events can be
@@ -97,26 +244,74 @@ func NewController(
 	utilruntime.Must(samplescheme.AddToScheme(scheme.Scheme))
 	klog.V(4).Info("Creating event broadcaster")
 	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartLogging(klog.Infof)
+	eventBroadcaster.StartEventWatcher(logEvent)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclientset.CoreV1().Events("")})
-	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+	messages := newMessageCatalog()
+	recorder := &templatingRecorder{
+		EventRecorder: eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName}),
+		messages:      messages,
+		labelKeys:     defaultEventLabelKeys,
+	}
+	retryLimiter := newClassRateLimiter(defaultRetryBackoffs)
+	if rateLimiter == nil {
+		rateLimiter = retryLimiter
+	}
 
 	controller := &Controller{
-		kubeclientset:       kubeclientset,
-		sampleclientset:     sampleclientset,
-		deploymentsLister:   deploymentInformer.Lister(),
-		deploymentsSynced:   deploymentInformer.Informer().HasSynced,
-		inferenceJobsLister: inferenceJobInformer.Lister(),
-		inferenceJobsSynced: inferenceJobInformer.Informer().HasSynced,
-		workqueue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "InferenceJobs"),
-		recorder:            recorder,
+		kubeclientset:        kubeclientset,
+		sampleclientset:      sampleclientset,
+		deploymentsLister:    deploymentInformer.Lister(),
+		deploymentsSynced:    deploymentInformer.Informer().HasSynced,
+		deploymentsIndexer:   deploymentInformer.Informer().GetIndexer(),
+		inferenceJobsLister:  inferenceJobInformer.Lister(),
+		inferenceJobsSynced:  inferenceJobInformer.Informer().HasSynced,
+		inferenceJobsIndexer: inferenceJobInformer.Informer().GetIndexer(),
+		retryLimiter:         retryLimiter,
+		importqueue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "DeploymentImports"),
+		recorder:             recorder,
+		messages:             messages,
+		lastSynced:           newSyncTimes(),
+		rolloutTests:         newRolloutTestRunner(),
+		creations:            newCreationExpectations(),
+		metrics:              newControllerMetrics(),
+		policy:               policy.NewEngine(policy.DefaultRules()...),
+		nameTemplates:        samplev1alpha1.NameTemplates{Deployment: defaultDeploymentNameTemplate},
+		enforcedNamespaces:   map[string]bool{},
+		deploymentWrites:     newNamespaceLimiter(0),
+		deploymentApplier:    &restDeploymentApplier{client: kubeclientset.AppsV1().RESTClient()},
+		clusterDomain:        defaultClusterDomain,
+		shutdownTimeout:      defaultShutdownTimeout,
+		syncTimeout:          defaultSyncTimeout,
 	}
+	// Sync the InferenceJobs of the highest spec.priority first.
+	controller.workqueue = newPriorityQueue(rateLimiter, controller.inferenceJobPriority)
+
+	// Index InferenceJobs by the Deployment they claim to detect name
+	// conflicts. This only fails if the informer was already started.
+	utilruntime.Must(inferenceJobInformer.Informer().AddIndexers(cache.Indexers{
+		deploymentNameIndex: indexByDeploymentName,
+	}))
+	// Index Deployments by their InferenceJob to find them without listing
+	// their namespace.
+	utilruntime.Must(deploymentInformer.Informer().AddIndexers(cache.Indexers{
+		ownerUIDIndex: indexByOwnerUID,
+	}))
 
 	klog.Info("Setting up event handlers")
-	// Set up an event handler for when InferenceJob resources change
+	// Set up an event handler for when InferenceJob resources change. Updates
+	// of the status alone are skipped, see inferenceJobChanged, the others
+	// wait for the settle window so bursts are synced once.
 	inferenceJobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: controller.enqueueInferenceJob,
 		UpdateFunc: func(old, new interface{}) {
+			oldJob, newJob := old.(*samplev1alpha1.InferenceJob), new.(*samplev1alpha1.InferenceJob)
+			if !inferenceJobChanged(oldJob, newJob) {
+				return
+			}
+			if oldJob.ResourceVersion != newJob.ResourceVersion && controller.settleWindow > 0 {
+				controller.enqueueInferenceJobAfter(new, controller.settleWindow)
+				return
+			}
 			controller.enqueueInferenceJob(new)
 		},
 	})
@@ -127,7 +322,10 @@ func NewController(
 	// handling Deployment resources. More info on this pattern:
 	// https://github.com/kubernetes/community/blob/8cafef897a22026d42f5e5bb3f104febe7e29830/contributors/devel/controllers.md
 	deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: controller.handleObject,
+		AddFunc: func(obj interface{}) {
+			controller.creations.observe(obj)
+			controller.handleObject(obj)
+		},
 		UpdateFunc: func(old, new interface{}) {
 			newDepl := new.(*appsv1.Deployment)
 			oldDepl := old.(*appsv1.Deployment)
@@ -138,19 +336,36 @@ func NewController(
 			}
 			controller.handleObject(new)
 		},
-		DeleteFunc: controller.handleObject,
+		DeleteFunc: func(obj interface{}) {
+			controller.creations.observe(obj)
+			controller.handleObject(obj)
+		},
+	})
+	// Unmanaged Deployments can be handed over to a new InferenceJob by
+	// annotating them with ImportAnnotation.
+	deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.enqueueImport,
+		UpdateFunc: func(old, new interface{}) {
+			controller.enqueueImport(new)
+		},
 	})
 
 	return controller
 }
 
 // Run will set up the event handlers for types we are interested in, as well
-// as syncing informer caches and starting workers. It will block until stopCh
-// is closed, at which point it will shutdown the workqueue and wait for
-// workers to finish processing their current work items.
-func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
+// as syncing informer caches and starting workers. It will block until ctx
+// is cancelled, at which point it will shutdown the workqueue and wait up to
+// shutdownTimeout for workers to drain it. Syncs still running then are
+// cancelled at their next step; the clients of this client-go release don't
+// take a context, so API calls in flight finish on their own.
+func (c *Controller) Run(ctx context.Context, threadiness int) error {
 	defer utilruntime.HandleCrash()
-	defer c.workqueue.ShutDown()
+	// The delaying queue panics when shut down twice.
+	var shutDownQueue sync.Once
+	defer shutDownQueue.Do(c.workqueue.ShutDown)
+	defer c.importqueue.ShutDown()
+	stopCh := ctx.Done()
 
 	// Start the informer factories to begin populating the informer caches
 	klog.Info("Starting InferenceJob controller")
@@ -160,16 +375,62 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 	if ok := cache.WaitForCacheSync(stopCh, c.deploymentsSynced, c.inferenceJobsSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
+	if c.podsSynced != nil && !cache.WaitForCacheSync(stopCh, c.podsSynced) {
+		return fmt.Errorf("failed to wait for the pod cache to sync")
+	}
+	if c.nodesSynced != nil && !cache.WaitForCacheSync(stopCh, c.nodesSynced) {
+		return fmt.Errorf("failed to wait for the node cache to sync")
+	}
+
+	if c.shards != nil {
+		klog.Infof("Running shard %d of %d", c.shards.index, c.shards.count)
+		c.shards.onChange = c.enqueueAllInferenceJobs
+		go wait.Until(c.shards.renew, shardRenewInterval, stopCh)
+		// Hand the keys over right away once the workers are done.
+		defer c.shards.release()
+	}
 
 	klog.Info("Starting workers")
-	// Launch two workers to process InferenceJob resources
+	// Workers outlive ctx to drain the workqueue, until the shutdown timeout.
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	var workers sync.WaitGroup
+	// Launch threadiness workers to process InferenceJob resources
 	for i := 0; i < threadiness; i++ {
-		go wait.Until(c.runWorker, time.Second, stopCh)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			wait.Until(func() { c.runWorker(workCtx) }, time.Second, stopCh)
+		}()
+	}
+	go wait.Until(c.runImportWorker, time.Second, stopCh)
+	go wait.Until(c.sweepRetainedDeployments, retentionSweepInterval, stopCh)
+	if c.hibernation != nil {
+		go wait.Until(c.syncHibernation, hibernationInterval, stopCh)
+	}
+	if c.metricsPush != nil {
+		go wait.Until(c.pushMetrics, c.metricsPush.interval, stopCh)
+	}
+	if c.orphans != nil {
+		c.shards.runPrimary(stopCh, func(stopCh <-chan struct{}) {
+			wait.Until(c.orphans.run, c.orphanSweepInterval, stopCh)
+		})
 	}
 
 	klog.Info("Started workers")
 	<-stopCh
 	klog.Info("Shutting down workers")
+	shutDownQueue.Do(c.workqueue.ShutDown)
+	drained := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(c.shutdownTimeout):
+		klog.Warningf("Workers didn't drain the workqueue within %s, cancelling their syncs", c.shutdownTimeout)
+	}
 
 	return nil
 }
@@ -177,18 +438,14 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 // runWorker is a long-running function that will continually call the
 // processNextWorkItem function in order to read and process a message on the
 // workqueue.
-func (c *Controller) runWorker() {
-	fmt.Println("[controller.go] runWorker start")
-	for c.processNextWorkItem() {
-		fmt.Println("[controller.go] runWorker for loop")
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextWorkItem(ctx) {
 	}
-	fmt.Println("[controller.go] runWorker end")
 }
 
 // processNextWorkItem will read a single work item off the workqueue and
 // attempt to process it, by calling the syncHandler.
-func (c *Controller) processNextWorkItem() bool {
-	fmt.Println("[controller.go] processNextWorkItem start")
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 	obj, shutdown := c.workqueue.Get()
 
 	if shutdown {
@@ -221,14 +478,36 @@ func (c *Controller) processNextWorkItem() bool {
 		}
 		// Run the syncHandler, passing it the namespace/name string of the
 		// InferenceJob resource to be synced.
-		if err := c.syncHandler(key); err != nil {
+		syncCtx := ctx
+		if c.syncTimeout > 0 {
+			var cancel context.CancelFunc
+			syncCtx, cancel = context.WithTimeout(ctx, c.syncTimeout)
+			defer cancel()
+		}
+		start := time.Now()
+		err := c.syncHandler(syncCtx, key)
+		if err != nil {
+			c.metrics.observeReconcile(reconcileError, time.Since(start))
+			c.retryLimiter.observe(key, err)
+			c.trace(key, "sync failed", "error", err, "requeues", c.workqueue.NumRequeues(key))
+			if c.maxRetries > 0 && c.workqueue.NumRequeues(key) >= c.maxRetries {
+				// Give up until the spec changes instead of retrying forever.
+				c.workqueue.Forget(obj)
+				c.markFailed(key, err)
+				return fmt.Errorf("error syncing '%s': %s, giving up after %d retries", key, err.Error(), c.maxRetries)
+			}
 			// Put the item back on the workqueue to handle any transient errors.
 			c.workqueue.AddRateLimited(key)
+			if c.workqueue.NumRequeues(key) >= degradedRequeues {
+				c.markDegraded(key, err)
+			}
 			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
 		}
+		c.metrics.observeReconcile(reconcileSuccess, time.Since(start))
 		// Finally, if no error occurs we Forget this item so it does not
 		// get queued again until another change happens.
 		c.workqueue.Forget(obj)
+		c.trace(key, "synced")
 		klog.Infof("Successfully synced '%s'", key)
 		return nil
 	}(obj)
@@ -237,20 +516,27 @@ func (c *Controller) processNextWorkItem() bool {
 		utilruntime.HandleError(err)
 		return true
 	}
-	fmt.Println("[controller.go] processNextWorkItem end")
 	return true
 }
 
 // syncHandler compares the actual state with the desired, and attempts to
 // converge the two. It then updates the Status block of the InferenceJob resource
 // with the current status of the resource.
-func (c *Controller) syncHandler(key string) error {
+func (c *Controller) syncHandler(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	// Convert the namespace/name string into a distinct namespace and name
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
 		return nil
 	}
+	// Queued before the shard topology changed.
+	if !c.shards.owns(key) {
+		c.trace(key, "skip key of another shard")
+		return nil
+	}
 
 	// Get the InferenceJob resource with this namespace/name
 	inferenceJob, err := c.inferenceJobsLister.InferenceJobs(namespace).Get(name)
@@ -259,37 +545,161 @@ func (c *Controller) syncHandler(key string) error {
 		// processing.
 		if errors.IsNotFound(err) {
 			utilruntime.HandleError(fmt.Errorf("inferenceJob '%s' in work queue no longer exists", key))
+			c.lastSynced.forget(key)
+			c.rolloutTests.forget(key)
+			if c.externalPolicy != nil {
+				c.externalPolicy.forget(key)
+			}
 			return nil
 		}
 
 		return err
 	}
 
-	deploymentName := inferenceJob.Spec.DeploymentName
-	if deploymentName == "" {
+	c.trace(key, "sync", "generation", inferenceJob.Generation, "resourceVersion", inferenceJob.ResourceVersion)
+	if inferenceJob.DeletionTimestamp != nil {
+		c.trace(key, "deleting", "finalizers", inferenceJob.Finalizers)
+		if c.dryRun {
+			klog.Infof("Dry run: InferenceJob %s is being deleted, its finalizers are left alone", key)
+			return nil
+		}
+		if c.observing(namespace) {
+			klog.V(4).Infof("InferenceJob %s is being deleted in an observed namespace, its finalizers are left alone", key)
+			return nil
+		}
+		if hasFinalizer(inferenceJob, CleanupFinalizer) {
+			return c.runCleanupHooks(inferenceJob)
+		}
+		if hasFinalizer(inferenceJob, RetainFinalizer) {
+			return c.retainDeployments(inferenceJob)
+		}
+		if len(inferenceJob.Finalizers) > 0 && inferenceJob.Status.Phase != samplev1alpha1.PhaseTerminating {
+			// Other finalizers hold the deletion, report it meanwhile.
+			inferenceJobCopy := inferenceJob.DeepCopy()
+			inferenceJobCopy.Status.Phase = samplev1alpha1.PhaseTerminating
+			_, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(namespace).UpdateStatus(inferenceJobCopy)
+			return err
+		}
+		return nil
+	}
+	if gaveUp(inferenceJob) {
+		c.trace(key, "skip failed generation", "failedGeneration", inferenceJob.Status.FailedGeneration)
+		klog.V(4).Infof("InferenceJob %s failed to sync generation %d, waiting for a spec change", key, inferenceJob.Generation)
+		return nil
+	}
+	observing := c.observing(namespace)
+	if !observing {
+		if updated, err := c.syncRetainFinalizer(inferenceJob); updated || err != nil {
+			return err
+		}
+		if updated, err := c.syncCleanupFinalizer(inferenceJob); updated || err != nil {
+			return err
+		}
+	}
+	if delay := c.reconcileDelay(key, inferenceJob, time.Now()); delay > 0 {
+		c.trace(key, "delay reconcile", "delay", delay)
+		klog.V(4).Infof("InferenceJob %s reconciled less than its minimum interval ago, retrying in %s", name, delay)
+		c.workqueue.AddAfter(key, delay)
+		return nil
+	}
+
+	if inferenceJob.Annotations[PromoteAnnotation] != "" && !observing {
+		if !promotable(inferenceJob) {
+			// Promoted once the Ready condition flips with the next status update.
+			klog.V(4).Infof("InferenceJob %s waiting for its post-rollout test before promotion", name)
+		} else if err := c.promoteInferenceJob(inferenceJob); err != nil {
+			return err
+		}
+	}
+
+	deploymentName, err := c.deploymentName(inferenceJob)
+	if err != nil {
 		// We choose to absorb the error here as the worker would requeue the
 		// resource otherwise. Instead, the next time the resource is updated
 		// the resource will be queued again.
-		utilruntime.HandleError(fmt.Errorf("%s: deployment name must be specified", key))
+		utilruntime.HandleError(fmt.Errorf("%s: %s", key, err.Error()))
 		return nil
 	}
+	// The Deployment is rendered from a copy carrying the resolved name, the
+	// spec keeps following the name template.
+	named := inferenceJob
+	if inferenceJob.Spec.DeploymentName != deploymentName {
+		named = inferenceJob.DeepCopy()
+		named.Spec.DeploymentName = deploymentName
+	}
+
+	// Leave the Deployment to the InferenceJob that claimed its name first
+	// rather than fighting over ownership on every sync.
+	claimant, err := c.deploymentNameClaimant(named)
+	if err != nil {
+		return err
+	}
+	if claimant != nil {
+		c.trace(key, "name conflict", "deployment", deploymentName, "claimant", claimant.Namespace+"/"+claimant.Name)
+		if c.dryRun {
+			klog.Infof("Dry run: InferenceJob %s leaves deployment %s to %s/%s", key, deploymentName, claimant.Namespace, claimant.Name)
+			return nil
+		}
+		return c.markNameConflict(inferenceJob, deploymentName, claimant)
+	}
+	if observing {
+		c.trace(key, "observe", "deployment", deploymentName)
+		return c.observeInferenceJob(inferenceJob, named)
+	}
+	if allowed, err := c.reviewDeployment(key, inferenceJob, newDeployment(named)); !allowed {
+		return err
+	}
+	if fits, err := c.checkModelFit(inferenceJob); !fits {
+		return err
+	}
+	c.trace(key, "sync workload", "workloadType", named.Spec.WorkloadType, "name", deploymentName)
+	switch named.Spec.WorkloadType {
+	case samplev1alpha1.WorkloadTypeStatefulSet:
+		return c.syncStatefulSet(key, inferenceJob, named)
+	case samplev1alpha1.WorkloadTypeDaemonSet:
+		return c.syncDaemonSet(key, inferenceJob, named)
+	}
 
 	// Get the deployment with the name specified in InferenceJob.spec
 	deployment, err := c.deploymentsLister.Deployments(inferenceJob.Namespace).Get(deploymentName)
 	// If the resource doesn't exist, we'll create it
 	if errors.IsNotFound(err) {
-		deployment, err = c.kubeclientset.AppsV1().Deployments(inferenceJob.Namespace).Create(newDeployment(inferenceJob))
+		deploymentKey := inferenceJob.Namespace + "/" + deploymentName
+		if c.creations.pending(deploymentKey) {
+			// Synced again once the informer reports the Deployment.
+			c.trace(key, "await deployment creation", "name", deploymentName)
+			return nil
+		}
+		c.trace(key, "create deployment", "name", deploymentName)
+		if deployment, err = c.applyDeployment(ctx, newDeployment(named)); err == nil {
+			c.creations.expect(deploymentKey)
+			c.metrics.deploymentCreated()
+		}
+	}
+	if err == errWriteThrottled {
+		c.workqueue.AddAfter(key, writeThrottleRetry)
+		return nil
 	}
 
 	// If an error occurs during Get/Create, we'll requeue the item so we can
 	// attempt processing again later. This could have been caused by a
 	// temporary network failure, or any other transient reason.
 	if err != nil {
+		c.recordResourceError(inferenceJob, "Deployment", deploymentName, err)
 		return err
 	}
 
 	// If the Deployment is not controlled by this InferenceJob resource, we should log
 	// a warning to the event recorder and ret
+	if !metav1.IsControlledBy(deployment, inferenceJob) {
+		adopted, err := c.adoptDeployment(inferenceJob, deployment)
+		if err != nil {
+			return err
+		}
+		if adopted != nil {
+			deployment = adopted
+		}
+	}
 	if !metav1.IsControlledBy(deployment, inferenceJob) {
 		msg := fmt.Sprintf(MessageResourceExists, deployment.Name)
 		c.recorder.Event(inferenceJob, corev1.EventTypeWarning, ErrResourceExists, msg)
@@ -297,123 +707,270 @@ func (c *Controller) syncHandler(key string) error {
 	}
 
 	// If this number of the replicas on the InferenceJob resource is specified, and the
-	// number does not equal the current desired replicas on the Deployment, we
-	// should update the Deployment resource.
-	if inferenceJob.Spec.Replicas != nil && *inferenceJob.Spec.Replicas != *deployment.Spec.Replicas {
-		klog.V(4).Infof("InferenceJob %s replicas: %d, deployment replicas: %d", name, *inferenceJob.Spec.Replicas, *deployment.Spec.Replicas)
-		deployment, err = c.kubeclientset.AppsV1().Deployments(inferenceJob.Namespace).Update(newDeployment(inferenceJob))
+	// number does not equal the current desired replicas on the Deployment, or the
+	// pod template rendered from the InferenceJob has drifted from the one on the
+	// Deployment, we should update the Deployment resource.
+	desired := newDeployment(named)
+	desired.Spec.Replicas = c.stabilizedReplicas(key, inferenceJob, deployment)
+	zoneSurge, err := c.zoneSurge(inferenceJob, deployment)
+	if err != nil {
+		// Keep the current surge rather than failing the sync.
+		utilruntime.HandleError(fmt.Errorf("%s: failed to check replicas per zone: %s", key, err.Error()))
+		zoneSurge = inferenceJob.Status.ZoneSurge
+	}
+	desired.Spec.Replicas = surgedReplicas(inferenceJob, desired.Spec.Replicas, zoneSurge)
+	preserveSelector(desired, deployment)
+	rollOut := true
+	if (inferenceJob.Spec.PrePullImages && deploymentImage(desired) != deploymentImage(deployment)) ||
+		reactivating(inferenceJob, desired, deployment) {
+		if rollOut, err = c.prePullImage(inferenceJob, desired); err != nil {
+			return err
+		}
+		if !rollOut {
+			c.workqueue.AddAfter(key, prePullPollInterval)
+		}
+	}
+	if !rollOut {
+		klog.V(4).Infof("InferenceJob %s waiting for image pre-pull before updating deployment %s", name, deployment.Name)
+	} else if desired.Spec.Replicas != nil && *desired.Spec.Replicas != *deployment.Spec.Replicas {
+		klog.V(4).Infof("InferenceJob %s replicas: %d, deployment replicas: %d", name, *desired.Spec.Replicas, *deployment.Spec.Replicas)
+		if c.podLoad != nil && *desired.Spec.Replicas < *deployment.Spec.Replicas {
+			// Ordering the scale-down is best effort, it must not block it.
+			if err := c.setPodDeletionCosts(deployment); err != nil {
+				utilruntime.HandleError(fmt.Errorf("%s: failed to set pod deletion costs: %s", key, err.Error()))
+			}
+		}
+		c.trace(key, "scale deployment", "name", deployment.Name, "from", *deployment.Spec.Replicas, "to", *desired.Spec.Replicas)
+		deployment, err = c.patchDeployment(ctx, desired)
+	} else if (driftCorrection(inferenceJob) || templateChanged(desired, deployment)) && templateDrifted(desired, deployment) ||
+		strategyDrifted(desired, deployment) || revisionHistoryLimitDrifted(desired, deployment) {
+		klog.V(4).Infof("InferenceJob %s pod template, rollout strategy or revision history limit has drifted from deployment %s", name, deployment.Name)
+		c.trace(key, "patch deployment", "name", deployment.Name)
+		deployment, err = c.patchDeployment(ctx, desired)
 	}
 
+	if err == errWriteThrottled {
+		c.workqueue.AddAfter(key, writeThrottleRetry)
+		return nil
+	}
 	// If an error occurs during Update, we'll requeue the item so we can
 	// attempt processing again later. THis could have been caused by a
 	// temporary network failure, or any other transient reason.
+	if err != nil {
+		c.recordResourceError(inferenceJob, "Deployment", deploymentName, err)
+		return err
+	}
+
+	if err := c.deleteSupersededDeployments(inferenceJob, deployment); err != nil {
+		return err
+	}
+	if err := c.deleteWorkloads(inferenceJob, "StatefulSet", "Service", "DaemonSet"); err != nil {
+		return err
+	}
+
+	testResult, err := c.postRolloutTest(key, inferenceJob, deployment)
 	if err != nil {
 		return err
 	}
 
 	// Finally, we update the status block of the InferenceJob resource to reflect the
 	// current state of the world
-	err = c.updateInferenceJobStatus(inferenceJob, deployment)
+	c.trace(key, "update status", "deployment", deployment.Name, "availableReplicas", deployment.Status.AvailableReplicas)
+	err = c.updateInferenceJobStatus(inferenceJob, deployment, zoneSurge, testResult)
 	if err != nil {
 		return err
 	}
 
+	c.scheduleReconcile(key, inferenceJob, time.Now())
 	c.recorder.Event(inferenceJob, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
 	return nil
 }
 
-func (c *Controller) updateInferenceJobStatus(inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment) error {
+func (c *Controller) updateInferenceJobStatus(inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment, zoneSurge int32, testResult *samplev1alpha1.PostRolloutTestResult) error {
 	// NEVER modify objects from the store. It's a read-only, local cache.
 	// You can use DeepCopy() to make a deep copy of original object and modify this copy
 	// Or create a copy manually for better performance
 	inferenceJobCopy := inferenceJob.DeepCopy()
+	inferenceJobCopy.Status.Replicas = 1
+	if deployment.Spec.Replicas != nil {
+		inferenceJobCopy.Status.Replicas = *deployment.Spec.Replicas
+	}
 	inferenceJobCopy.Status.AvailableReplicas = deployment.Status.AvailableReplicas
-	// If the CustomResourceSubresources feature gate is not enabled,
-	// we must use Update instead of UpdateStatus to update the Status block of the InferenceJob resource.
-	// UpdateStatus will not allow changes to the Spec of the resource,
-	// which is ideal for ensuring nothing other than resource status has been updated.
-	_, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).Update(inferenceJobCopy)
+	inferenceJobCopy.Status.ReadyReplicas = deployment.Status.ReadyReplicas
+	inferenceJobCopy.Status.UpdatedReplicas = deployment.Status.UpdatedReplicas
+	inferenceJobCopy.Status.UnavailableReplicas = deployment.Status.UnavailableReplicas
+	inferenceJobCopy.Status.NumberReady = 0
+	inferenceJobCopy.Status.LabelSelector = metav1.FormatLabelSelector(deployment.Spec.Selector)
+	inferenceJobCopy.Status.DeploymentGeneration = deployment.Generation
+	inferenceJobCopy.Status.TemplateHash = deployment.Annotations[TemplateHashAnnotation]
+	// Superseded Deployments are deleted once the current one is fully
+	// available, until then the previous name is kept.
+	if fullyAvailable(deployment) {
+		inferenceJobCopy.Status.DeploymentName = deployment.Name
+	}
+	inferenceJobCopy.Status.Address = ""
+	inferenceJobCopy.Status.URL = ""
+	inferenceJobCopy.Status.PendingScaleDown = pendingScaleDown(inferenceJob, deployment)
+	inferenceJobCopy.Status.ZoneSurge = zoneSurge
+	inferenceJobCopy.Status.PostRolloutTest = testResult
+	// Only the current Deployment is listed, superseded ones are deleted.
+	inferenceJobCopy.Status.Resources = []samplev1alpha1.ResourceStatus{deploymentResourceStatus(deployment)}
+	setDeploymentConditions(&inferenceJobCopy.Status, inferenceJob, deployment)
+	c.setFailingPodsCondition(inferenceJob, &inferenceJobCopy.Status, deployment)
+	if inferenceJob.Spec.PostRolloutTest != nil {
+		setReadyCondition(&inferenceJobCopy.Status, inferenceJob.Spec.PostRolloutTest, deployment, testResult)
+	}
+	return c.writeInferenceJobStatus(inferenceJob, inferenceJobCopy)
+}
+
+// writeInferenceJobStatus clears the conditions of a successful sync from
+// the copy of an InferenceJob, evaluates its policies and writes its status,
+// see putInferenceJobStatus.
+func (c *Controller) writeInferenceJobStatus(inferenceJob, inferenceJobCopy *samplev1alpha1.InferenceJob) error {
+	removeCondition(&inferenceJobCopy.Status, samplev1alpha1.NameConflict)
+	removeCondition(&inferenceJobCopy.Status, samplev1alpha1.PendingChanges)
+	removeCondition(&inferenceJobCopy.Status, samplev1alpha1.PolicyDenied)
+	removeCondition(&inferenceJobCopy.Status, samplev1alpha1.ModelTooLarge)
+	removeCondition(&inferenceJobCopy.Status, samplev1alpha1.Failed)
+	inferenceJobCopy.Status.FailedGeneration = 0
+	c.setPolicyCondition(inferenceJobCopy)
+	inferenceJobCopy.Status.Phase = inferenceJobPhase(inferenceJobCopy)
+	inferenceJobCopy.Status.ObservedGeneration = inferenceJobCopy.Generation
+	return c.putInferenceJobStatus(inferenceJob, inferenceJobCopy)
+}
+
+// putInferenceJobStatus writes the status of the copy of an InferenceJob
+// unless it is the same as the one of the InferenceJob but for the sync
+// times, and its last sync time is more recent than lastSyncRefresh.
+func (c *Controller) putInferenceJobStatus(inferenceJob, inferenceJobCopy *samplev1alpha1.InferenceJob) error {
+	now := metav1.Now()
+	if !statusChanged(inferenceJob.Status, inferenceJobCopy.Status) && !syncTimeStale(inferenceJob.Status, now.Time) {
+		klog.V(4).Infof("InferenceJob %s/%s status is up to date", inferenceJob.Namespace, inferenceJob.Name)
+		return nil
+	}
+	inferenceJobCopy.Status.LastSyncTime = &now
+	// UpdateStatus only writes the Status block through the status
+	// subresource, a concurrent edit of the spec makes it conflict and be
+	// retried instead of being overwritten.
+	_, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJobCopy.Namespace).UpdateStatus(inferenceJobCopy)
+	c.metrics.observeStatusUpdate(err)
 	return err
 }
 
+// setPolicyCondition evaluates the lint policies against the InferenceJob and
+// reports violations in its PolicyViolations condition. The condition is
+// dropped once the spec complies again.
+func (c *Controller) setPolicyCondition(inferenceJob *samplev1alpha1.InferenceJob) {
+	violations := c.policy.Evaluate(inferenceJob)
+	if len(violations) == 0 {
+		removeCondition(&inferenceJob.Status, samplev1alpha1.PolicyViolations)
+		return
+	}
+	msg := policy.Summary(violations)
+	condMsg := c.messages.render("PolicyCheckFailed", msg, inferenceJob)
+	if cond := getCondition(inferenceJob.Status, samplev1alpha1.PolicyViolations); cond == nil || cond.Message != condMsg {
+		c.recorder.Event(inferenceJob, corev1.EventTypeWarning, string(samplev1alpha1.PolicyViolations), msg)
+	}
+	setCondition(&inferenceJob.Status, newCondition(samplev1alpha1.PolicyViolations, corev1.ConditionTrue, "PolicyCheckFailed", condMsg))
+}
+
 // enqueueInferenceJob takes a InferenceJob resource and converts it into a namespace/name
 // string which is then put onto the work queue. This method should *not* be
 // passed resources of any type other than InferenceJob.
 func (c *Controller) enqueueInferenceJob(obj interface{}) {
-	fmt.Println("[controller.go] enqueueInferenceJob: start")
 	var key string
 	var err error
 	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
-		fmt.Println("[controller.go] enqueueInferenceJob: entered if.")
 		utilruntime.HandleError(err)
 		return
 	}
-	fmt.Println("[controller.go] enqueueInferenceJob: key value: " + key)
-	fmt.Println("[controller.go] enqueueInferenceJob: end")
+	if !c.shards.owns(key) {
+		return
+	}
+	c.trace(key, "enqueue")
 	c.workqueue.Add(key)
 }
 
+// enqueueAllInferenceJobs puts the keys of every cached InferenceJob onto
+// the work queue, e.g. once the keys of the shard changed.
+func (c *Controller) enqueueAllInferenceJobs() {
+	inferenceJobs, err := c.inferenceJobsLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, inferenceJob := range inferenceJobs {
+		c.enqueueInferenceJob(inferenceJob)
+	}
+}
+
+// enqueueInferenceJobAfter puts the key of an InferenceJob onto the work
+// queue once the delay has passed. Enqueueing it again in the meantime
+// doesn't push the sync back, the latest state is synced then.
+func (c *Controller) enqueueInferenceJobAfter(obj interface{}, delay time.Duration) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if !c.shards.owns(key) {
+		return
+	}
+	c.trace(key, "enqueue", "delay", delay)
+	c.workqueue.AddAfter(key, delay)
+}
+
 // handleObject will take any resource implementing metav1.Object and attempt
 // to find the InferenceJob resource that 'owns' it. It does this by looking at the
 // objects metadata.ownerReferences field for an appropriate OwnerReference.
 // It then enqueues that InferenceJob resource to be processed. If the object does not
 // have an appropriate OwnerReference, it will simply be skipped.
 func (c *Controller) handleObject(obj interface{}) {
-	fmt.Println("[controller.go] handleObject start")
 	var object metav1.Object
 	var ok bool
 	if object, ok = obj.(metav1.Object); !ok {
 		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
 		if !ok {
-			fmt.Errorf("[controller.go] handleObject: error decoding object, invalid type")
 			utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
 			return
 		}
 		object, ok = tombstone.Obj.(metav1.Object)
 		if !ok {
-			fmt.Errorf("[controller.go] handleObject: error decoding object tombstone, invalid type")
 			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
 			return
 		}
-		fmt.Printf("[controller.go] handleObject: Recovered deleted object '%s' from tombstone\n", object.GetName())
 		klog.V(4).Infof("Recovered deleted object '%s' from tombstone", object.GetName())
 	}
-	fmt.Printf("[controller.go] handleObject: Processing object: %s\n", object.GetName())
 	klog.V(4).Infof("Processing object: %s", object.GetName())
 	if ownerRef := metav1.GetControllerOf(object); ownerRef != nil {
 		// If this object is not owned by a InferenceJob, we should not do anything more
 		// with it.
-		fmt.Printf("[controller.go] handleObject: ownerRef.Kind: %s\n", ownerRef.Kind)
 		if ownerRef.Kind != "InferenceJob" {
 			return
 		}
 
 		inferenceJob, err := c.inferenceJobsLister.InferenceJobs(object.GetNamespace()).Get(ownerRef.Name)
 		if err != nil {
-			fmt.Printf("[controller.go] handleObject: ignoring orphaned object '%s' of inferenceJob '%s'\n", object.GetSelfLink(), ownerRef.Name)
 			klog.V(4).Infof("ignoring orphaned object '%s' of inferenceJob '%s'", object.GetSelfLink(), ownerRef.Name)
 			return
 		}
 
+		c.trace(object.GetNamespace()+"/"+ownerRef.Name, "owned object changed", "name", object.GetName())
 		c.enqueueInferenceJob(inferenceJob)
 		return
 	}
-	fmt.Println("[controller.go] handleObject: end")
 }
 
 // newDeployment creates a new Deployment for a InferenceJob resource. It also sets
 // the appropriate OwnerReferences on the resource so handleObject can discover
 // the InferenceJob resource that 'owns' it.
 func newDeployment(inferenceJob *samplev1alpha1.InferenceJob) *appsv1.Deployment {
-	fmt.Println("[controller.go] newDeployment: start: " + inferenceJob.GetName() + "-" + inferenceJob.GetNamespace())
 	labels := map[string]string{
 		"app":        inferenceJob.Spec.ImageToDeploy,
 		"controller": inferenceJob.Name,
 	}
 
-	fmt.Println("[controller.go] newDeployment: inferenceJob.Spec.ImageToDeploy is " + inferenceJob.Spec.ImageToDeploy)
-	fmt.Println("[controller.go] newDeployment: end")
-	return &appsv1.Deployment{
+	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      inferenceJob.Spec.DeploymentName,
 			Namespace: inferenceJob.Namespace,
@@ -422,7 +979,7 @@ func newDeployment(inferenceJob *samplev1alpha1.InferenceJob) *appsv1.Deployment
 			},
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: inferenceJob.Spec.Replicas,
+			Replicas: tierReplicas(inferenceJob),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
@@ -436,11 +993,487 @@ func newDeployment(inferenceJob *samplev1alpha1.InferenceJob) *appsv1.Deployment
 							//Name:  "nginx",
 							Name: strings.Split(inferenceJob.Spec.ImageToDeploy, ":")[0],
 							//Image: "nginx:latest",
-							Image: inferenceJob.Spec.ImageToDeploy,
+							Image:           inferenceJob.Spec.ImageToDeploy,
+							ImagePullPolicy: imagePullPolicy(&inferenceJob.Spec),
 						},
 					},
 				},
 			},
 		},
 	}
+	if inferenceJob.Spec.Strategy != nil {
+		deployment.Spec.Strategy = *inferenceJob.Spec.Strategy.DeepCopy()
+	}
+	if inferenceJob.Spec.RevisionHistoryLimit != nil {
+		limit := *inferenceJob.Spec.RevisionHistoryLimit
+		deployment.Spec.RevisionHistoryLimit = &limit
+	}
+	if inferenceJob.Spec.Template != nil {
+		applyBaseTemplate(deployment, inferenceJob.Spec.Template, &inferenceJob.Spec)
+	}
+	if len(inferenceJob.Labels) > 0 || len(inferenceJob.Spec.PodLabels) > 0 {
+		// The template gets its own map, the selector shares the original.
+		podLabels := map[string]string{}
+		for k, v := range deployment.Spec.Template.Labels {
+			podLabels[k] = v
+		}
+		for k, v := range inferenceJob.Labels {
+			podLabels[k] = v
+		}
+		for k, v := range inferenceJob.Spec.PodLabels {
+			podLabels[k] = v
+		}
+		// The selector labels win, the pods must keep matching it.
+		for k, v := range labels {
+			podLabels[k] = v
+		}
+		deployment.Spec.Template.Labels = podLabels
+	}
+	if len(inferenceJob.Labels) > 0 {
+		deployment.Labels = make(map[string]string, len(inferenceJob.Labels))
+		for k, v := range inferenceJob.Labels {
+			deployment.Labels[k] = v
+		}
+	}
+	if restartedAt := inferenceJob.Annotations[samplev1alpha1.RestartedAtAnnotation]; restartedAt != "" {
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		deployment.Spec.Template.Annotations[samplev1alpha1.RestartedAtAnnotation] = restartedAt
+	}
+	if len(inferenceJob.Spec.PodAnnotations) > 0 {
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = make(map[string]string, len(inferenceJob.Spec.PodAnnotations))
+		}
+		for k, v := range inferenceJob.Spec.PodAnnotations {
+			deployment.Spec.Template.Annotations[k] = v
+		}
+	}
+	if len(inferenceJob.Spec.NodeSelector) > 0 {
+		// Copy the map, it is extended below and the InferenceJob comes
+		// from the informer cache.
+		nodeSelector := make(map[string]string, len(inferenceJob.Spec.NodeSelector))
+		for k, v := range inferenceJob.Spec.NodeSelector {
+			nodeSelector[k] = v
+		}
+		deployment.Spec.Template.Spec.NodeSelector = nodeSelector
+	}
+	if len(inferenceJob.Spec.Tolerations) > 0 {
+		deployment.Spec.Template.Spec.Tolerations = append([]corev1.Toleration{}, inferenceJob.Spec.Tolerations...)
+	}
+	if inferenceJob.Spec.ServiceAccountName != "" {
+		deployment.Spec.Template.Spec.ServiceAccountName = inferenceJob.Spec.ServiceAccountName
+	}
+	if inferenceJob.Spec.PriorityClassName != "" {
+		deployment.Spec.Template.Spec.PriorityClassName = inferenceJob.Spec.PriorityClassName
+	}
+	if inferenceJob.Spec.SchedulerName != "" {
+		deployment.Spec.Template.Spec.SchedulerName = inferenceJob.Spec.SchedulerName
+	}
+	if inferenceJob.Spec.RuntimeClassName != nil {
+		runtimeClassName := *inferenceJob.Spec.RuntimeClassName
+		deployment.Spec.Template.Spec.RuntimeClassName = &runtimeClassName
+	}
+	if len(inferenceJob.Spec.ImagePullSecrets) > 0 {
+		deployment.Spec.Template.Spec.ImagePullSecrets = append([]corev1.LocalObjectReference{}, inferenceJob.Spec.ImagePullSecrets...)
+	}
+	if inferenceJob.Spec.Affinity != nil {
+		deployment.Spec.Template.Spec.Affinity = inferenceJob.Spec.Affinity.DeepCopy()
+	}
+	if inferenceJob.Spec.DNSPolicy != "" {
+		deployment.Spec.Template.Spec.DNSPolicy = inferenceJob.Spec.DNSPolicy
+	}
+	if inferenceJob.Spec.DNSConfig != nil {
+		deployment.Spec.Template.Spec.DNSConfig = inferenceJob.Spec.DNSConfig.DeepCopy()
+	}
+	if len(inferenceJob.Spec.HostAliases) > 0 {
+		hostAliases := make([]corev1.HostAlias, len(inferenceJob.Spec.HostAliases))
+		for i := range inferenceJob.Spec.HostAliases {
+			inferenceJob.Spec.HostAliases[i].DeepCopyInto(&hostAliases[i])
+		}
+		deployment.Spec.Template.Spec.HostAliases = hostAliases
+	}
+	if inferenceJob.Spec.TerminationGracePeriodSeconds != nil {
+		gracePeriod := *inferenceJob.Spec.TerminationGracePeriodSeconds
+		deployment.Spec.Template.Spec.TerminationGracePeriodSeconds = &gracePeriod
+	}
+	if inferenceJob.Spec.PreStop != nil {
+		deployment.Spec.Template.Spec.Containers[0].Lifecycle = &corev1.Lifecycle{PreStop: inferenceJob.Spec.PreStop.DeepCopy()}
+	}
+	if len(inferenceJob.Spec.SpreadTopologyKeys) > 0 {
+		setSpreadAntiAffinity(&deployment.Spec.Template.Spec, labels, inferenceJob.Spec.SpreadTopologyKeys)
+	}
+	if len(inferenceJob.Spec.Env) > 0 {
+		// Copy the slice, thread tuning variables are appended below.
+		deployment.Spec.Template.Spec.Containers[0].Env = append([]corev1.EnvVar{}, inferenceJob.Spec.Env...)
+	}
+	if inferenceJob.Spec.ModelURI != "" {
+		container := &deployment.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, corev1.EnvVar{Name: modelURIEnvVar, Value: inferenceJob.Spec.ModelURI})
+	}
+	if len(inferenceJob.Spec.EnvFrom) > 0 {
+		deployment.Spec.Template.Spec.Containers[0].EnvFrom = append([]corev1.EnvFromSource{}, inferenceJob.Spec.EnvFrom...)
+	}
+	if len(inferenceJob.Spec.Command) > 0 {
+		deployment.Spec.Template.Spec.Containers[0].Command = append([]string{}, inferenceJob.Spec.Command...)
+	}
+	if len(inferenceJob.Spec.Args) > 0 {
+		deployment.Spec.Template.Spec.Containers[0].Args = append([]string{}, inferenceJob.Spec.Args...)
+	}
+	if len(inferenceJob.Spec.Ports) > 0 {
+		deployment.Spec.Template.Spec.Containers[0].Ports = append([]corev1.ContainerPort{}, inferenceJob.Spec.Ports...)
+	}
+	if len(inferenceJob.Spec.InitContainers) > 0 {
+		initContainers := make([]corev1.Container, len(inferenceJob.Spec.InitContainers))
+		for i := range inferenceJob.Spec.InitContainers {
+			inferenceJob.Spec.InitContainers[i].DeepCopyInto(&initContainers[i])
+		}
+		deployment.Spec.Template.Spec.InitContainers = initContainers
+	}
+	if inferenceJob.Spec.Transformer != nil {
+		deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers, transformerContainer(inferenceJob.Spec.Transformer))
+	}
+	for i := range inferenceJob.Spec.ExtraContainers {
+		deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers, *inferenceJob.Spec.ExtraContainers[i].DeepCopy())
+	}
+	if len(inferenceJob.Spec.Volumes) > 0 {
+		deployment.Spec.Template.Spec.Volumes = append([]corev1.Volume{}, inferenceJob.Spec.Volumes...)
+	}
+	if len(inferenceJob.Spec.VolumeMounts) > 0 {
+		deployment.Spec.Template.Spec.Containers[0].VolumeMounts = append([]corev1.VolumeMount{}, inferenceJob.Spec.VolumeMounts...)
+	}
+	setProbes(&deployment.Spec.Template.Spec.Containers[0], &inferenceJob.Spec)
+	if inferenceJob.Spec.GPUs != nil {
+		// Keep the cpu and memory limits of spec.template.
+		resources := &deployment.Spec.Template.Spec.Containers[0].Resources
+		if resources.Limits == nil {
+			resources.Limits = corev1.ResourceList{}
+		}
+		resources.Limits[gpuResourceName] = *resource.NewQuantity(*inferenceJob.Spec.GPUs, resource.DecimalSI)
+	}
+	if inferenceJob.Spec.ThreadTuning {
+		container := &deployment.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, threadTuningEnv()...)
+	}
+	if inferenceJob.Spec.DedicatedNodes {
+		setDedicatedNodes(&deployment.Spec.Template.Spec, naming.QualifiedName(inferenceJob.Namespace, inferenceJob.Name))
+	}
+	deployment.Annotations = map[string]string{}
+	if inferenceJob.Spec.Alerting != nil {
+		annotations := alertingAnnotations(inferenceJob.Spec.Alerting)
+		if len(annotations) > 0 && deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		for k, v := range annotations {
+			deployment.Annotations[k] = v
+			deployment.Spec.Template.Annotations[k] = v
+		}
+	}
+	deployment.Annotations[TemplateHashAnnotation] = templateHash(&deployment.Spec.Template)
+	stampIdentity(&deployment.ObjectMeta, inferenceJob)
+	return deployment
+}
+
+// threadTuningEnv returns environment variables sizing runtime thread pools
+// to the container CPU limit. The kubelet rounds the limit up to whole cores.
+func threadTuningEnv() []corev1.EnvVar {
+	env := make([]corev1.EnvVar, 0, len(threadTuningEnvVars))
+	for _, name := range threadTuningEnvVars {
+		env = append(env, corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				ResourceFieldRef: &corev1.ResourceFieldSelector{Resource: "limits.cpu"},
+			},
+		})
+	}
+	return env
+}
+
+// alertingAnnotations renders the alert receivers as one annotation per
+// receiver type, holding the comma-separated targets of that type.
+func alertingAnnotations(alerting *samplev1alpha1.AlertingSpec) map[string]string {
+	targets := map[samplev1alpha1.AlertReceiverType][]string{}
+	for _, r := range alerting.Receivers {
+		targets[r.Type] = append(targets[r.Type], r.Target)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	annotations := make(map[string]string, len(targets))
+	for t, v := range targets {
+		annotations[alertReceiverAnnotationPrefix+string(t)] = strings.Join(v, ",")
+	}
+	return annotations
+}
+
+// preserveSelector keeps the selector of an existing Deployment, which is
+// immutable, and makes sure the desired pod template still matches it. This
+// matters for Deployments that were created outside the controller and
+// imported.
+func preserveSelector(desired, existing *appsv1.Deployment) {
+	if existing.Spec.Selector == nil {
+		return
+	}
+	desired.Spec.Selector = existing.Spec.Selector.DeepCopy()
+	for k, v := range existing.Spec.Selector.MatchLabels {
+		desired.Spec.Template.Labels[k] = v
+	}
+}
+
+// volumesDrifted reports whether volumes or volume mounts were added to or
+// removed from the desired Deployment. DeepDerivative ignores fields unset in
+// the desired template, so removals aren't caught by the drift check on
+// their own. Entries are compared with DeepDerivative too as the API server
+// defaults some volume source fields.
+func volumesDrifted(desired, existing *appsv1.Deployment) bool {
+	desiredSpec, existingSpec := desired.Spec.Template.Spec, existing.Spec.Template.Spec
+	if len(desiredSpec.Volumes) != len(existingSpec.Volumes) {
+		return true
+	}
+	for i := range desiredSpec.Volumes {
+		if !equality.Semantic.DeepDerivative(desiredSpec.Volumes[i], existingSpec.Volumes[i]) {
+			return true
+		}
+	}
+	if len(desiredSpec.Containers) == 0 || len(existingSpec.Containers) == 0 {
+		return false
+	}
+	desiredMounts, existingMounts := desiredSpec.Containers[0].VolumeMounts, existingSpec.Containers[0].VolumeMounts
+	if len(desiredMounts) != len(existingMounts) {
+		return true
+	}
+	for i := range desiredMounts {
+		if !equality.Semantic.DeepDerivative(desiredMounts[i], existingMounts[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateDrifted reports whether the pod template of the Deployment differs
+// from the desired one.
+func templateDrifted(desired, existing *appsv1.Deployment) bool {
+	return !equality.Semantic.DeepDerivative(desired.Spec.Template, existing.Spec.Template) ||
+		volumesDrifted(desired, existing) || serviceAccountDrifted(desired, existing) ||
+		containerDrifted(desired, existing) || podFieldsCleared(desired, existing)
+}
+
+// strategyDrifted reports whether the rollout strategy of the Deployment
+// differs from the desired one. Deployments without a strategy get a rolling
+// update with 25% surge and unavailability on admission.
+func strategyDrifted(desired, existing *appsv1.Deployment) bool {
+	return !equality.Semantic.DeepDerivative(defaultedStrategy(desired.Spec.Strategy), defaultedStrategy(existing.Spec.Strategy))
+}
+
+// revisionHistoryLimitDrifted reports whether the revision history limit of
+// the Deployment differs from the desired one, which defaults to 10.
+func revisionHistoryLimitDrifted(desired, existing *appsv1.Deployment) bool {
+	return defaultedRevisionHistoryLimit(desired.Spec.RevisionHistoryLimit) != defaultedRevisionHistoryLimit(existing.Spec.RevisionHistoryLimit)
+}
+
+func defaultedRevisionHistoryLimit(limit *int32) int32 {
+	if limit == nil {
+		return 10
+	}
+	return *limit
+}
+
+func defaultedStrategy(strategy appsv1.DeploymentStrategy) appsv1.DeploymentStrategy {
+	if strategy.Type != "" {
+		return strategy
+	}
+	maxSurge, maxUnavailable := intstr.FromString("25%"), intstr.FromString("25%")
+	return appsv1.DeploymentStrategy{
+		Type:          appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{MaxSurge: &maxSurge, MaxUnavailable: &maxUnavailable},
+	}
+}
+
+// containerDrifted reports whether the init containers or lists of the
+// containers were cleared in the desired Deployment, or containers were
+// removed, renamed or had their image changed, which DeepDerivative doesn't
+// notice.
+func containerDrifted(desired, existing *appsv1.Deployment) bool {
+	if len(desired.Spec.Template.Spec.InitContainers) == 0 && len(existing.Spec.Template.Spec.InitContainers) > 0 {
+		return true
+	}
+	if len(desired.Spec.Template.Spec.Containers) != len(existing.Spec.Template.Spec.Containers) {
+		return true
+	}
+	for i := range desired.Spec.Template.Spec.Containers {
+		desiredContainer, existingContainer := desired.Spec.Template.Spec.Containers[i], existing.Spec.Template.Spec.Containers[i]
+		// DeepDerivative takes an empty desired image as unset.
+		if desiredContainer.Name != existingContainer.Name || desiredContainer.Image != existingContainer.Image ||
+			len(desiredContainer.Ports) == 0 && len(existingContainer.Ports) > 0 ||
+			len(desiredContainer.Command) == 0 && len(existingContainer.Command) > 0 ||
+			len(desiredContainer.Args) == 0 && len(existingContainer.Args) > 0 ||
+			desiredContainer.Lifecycle == nil && existingContainer.Lifecycle != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// podFieldsCleared reports whether optional fields of the pod spec were
+// cleared in the desired Deployment, which DeepDerivative doesn't notice.
+func podFieldsCleared(desired, existing *appsv1.Deployment) bool {
+	desiredSpec, existingSpec := desired.Spec.Template.Spec, existing.Spec.Template.Spec
+	return desiredSpec.PriorityClassName == "" && existingSpec.PriorityClassName != "" ||
+		desiredSpec.RuntimeClassName == nil && existingSpec.RuntimeClassName != nil ||
+		desiredSpec.Affinity == nil && existingSpec.Affinity != nil ||
+		desiredSpec.DNSConfig == nil && existingSpec.DNSConfig != nil ||
+		len(desiredSpec.HostAliases) == 0 && len(existingSpec.HostAliases) > 0 ||
+		// The DNS policy and scheduler name are defaulted on admission.
+		desiredSpec.DNSPolicy == "" && existingSpec.DNSPolicy != "" && existingSpec.DNSPolicy != corev1.DNSClusterFirst ||
+		desiredSpec.SchedulerName == "" && existingSpec.SchedulerName != "" && existingSpec.SchedulerName != corev1.DefaultSchedulerName ||
+		// The grace period is defaulted on admission.
+		desiredSpec.TerminationGracePeriodSeconds == nil && existingSpec.TerminationGracePeriodSeconds != nil &&
+			*existingSpec.TerminationGracePeriodSeconds != corev1.DefaultTerminationGracePeriodSeconds
+}
+
+// serviceAccountDrifted reports whether the service account of the pods
+// differs from the desired one. Pods without a service account are assigned
+// the default one on admission, which DeepDerivative ignores, so switching
+// back to it needs checking separately.
+func serviceAccountDrifted(desired, existing *appsv1.Deployment) bool {
+	desiredName, existingName := desired.Spec.Template.Spec.ServiceAccountName, existing.Spec.Template.Spec.ServiceAccountName
+	if desiredName == "" {
+		desiredName = "default"
+	}
+	if existingName == "" {
+		existingName = "default"
+	}
+	return desiredName != existingName
+}
+
+// applyBaseTemplate replaces the pod template of the Deployment with a copy
+// of the template of the InferenceJob, keeping the selector labels and the
+// image of the inference container.
+func applyBaseTemplate(deployment *appsv1.Deployment, base *corev1.PodTemplateSpec, spec *samplev1alpha1.InferenceJobSpec) {
+	template := base.DeepCopy()
+	inference := deployment.Spec.Template.Spec.Containers[0]
+	if len(template.Spec.Containers) == 0 {
+		template.Spec.Containers = []corev1.Container{inference}
+	} else {
+		container := &template.Spec.Containers[0]
+		if container.Name == "" {
+			container.Name = inference.Name
+		}
+		container.Image = inference.Image
+		if container.ImagePullPolicy == "" || spec.ImagePullPolicy != "" {
+			container.ImagePullPolicy = inference.ImagePullPolicy
+		}
+	}
+	// The selector labels win, the pods must keep matching it.
+	podLabels := map[string]string{}
+	for k, v := range template.Labels {
+		podLabels[k] = v
+	}
+	for k, v := range deployment.Spec.Template.Labels {
+		podLabels[k] = v
+	}
+	template.Labels = podLabels
+	deployment.Spec.Template = *template
+}
+
+// imagePullPolicy returns the pull policy of the inference container,
+// always pulling mutable tags unless set explicitly.
+func imagePullPolicy(spec *samplev1alpha1.InferenceJobSpec) corev1.PullPolicy {
+	if spec.ImagePullPolicy != "" {
+		return spec.ImagePullPolicy
+	}
+	if naming.Version(spec.ImageToDeploy) == "latest" && !strings.Contains(spec.ImageToDeploy, "@") {
+		return corev1.PullAlways
+	}
+	return corev1.PullIfNotPresent
+}
+
+// transformerContainerName is the name of the container rendered from
+// spec.transformer.
+const transformerContainerName = "transformer"
+
+// transformerContainer renders the transformer container of an InferenceJob.
+func transformerContainer(transformer *samplev1alpha1.TransformerSpec) corev1.Container {
+	t := transformer.DeepCopy()
+	pullPolicy := corev1.PullIfNotPresent
+	if naming.Version(t.Image) == "latest" && !strings.Contains(t.Image, "@") {
+		pullPolicy = corev1.PullAlways
+	}
+	return corev1.Container{
+		Name:            transformerContainerName,
+		Image:           t.Image,
+		ImagePullPolicy: pullPolicy,
+		Command:         t.Command,
+		Args:            t.Args,
+		Env:             t.Env,
+		Ports:           t.Ports,
+		Resources:       t.Resources,
+	}
+}
+
+// setSpreadAntiAffinity makes the scheduler prefer nodes of topology domains
+// running fewer pods matching the selector labels.
+func setSpreadAntiAffinity(podSpec *corev1.PodSpec, selector map[string]string, topologyKeys []string) {
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	if podSpec.Affinity.PodAntiAffinity == nil {
+		podSpec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	antiAffinity := podSpec.Affinity.PodAntiAffinity
+	for _, key := range topologyKeys {
+		matchLabels := make(map[string]string, len(selector))
+		for k, v := range selector {
+			matchLabels[k] = v
+		}
+		antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, corev1.WeightedPodAffinityTerm{
+			Weight: 100,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: matchLabels},
+				TopologyKey:   key,
+			},
+		})
+	}
+}
+
+// setProbes sets the readiness and liveness probes of the inference
+// container, deriving the ones not given explicitly from spec.healthCheck.
+func setProbes(container *corev1.Container, spec *samplev1alpha1.InferenceJobSpec) {
+	container.ReadinessProbe = spec.ReadinessProbe.DeepCopy()
+	container.LivenessProbe = spec.LivenessProbe.DeepCopy()
+	if spec.HealthCheck == nil {
+		return
+	}
+	handler := corev1.Handler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path: spec.HealthCheck.Path,
+			Port: spec.HealthCheck.Port,
+		},
+	}
+	if container.ReadinessProbe == nil {
+		container.ReadinessProbe = &corev1.Probe{Handler: handler, PeriodSeconds: 5}
+	}
+	if container.LivenessProbe == nil {
+		container.LivenessProbe = &corev1.Probe{
+			Handler:             *handler.DeepCopy(),
+			InitialDelaySeconds: spec.HealthCheck.StartupSeconds,
+		}
+	}
+}
+
+// setDedicatedNodes pins the pod spec to the node group reserved for the
+// InferenceJob with the qualified name. Nodes are expected to be labelled
+// and tainted with DedicatedNodeLabelKey=<name>:NoSchedule by the cluster
+// operator.
+func setDedicatedNodes(podSpec *corev1.PodSpec, name string) {
+	if podSpec.NodeSelector == nil {
+		podSpec.NodeSelector = map[string]string{}
+	}
+	podSpec.NodeSelector[samplev1alpha1.DedicatedNodeLabelKey] = name
+	podSpec.Tolerations = append(podSpec.Tolerations, corev1.Toleration{
+		Key:      samplev1alpha1.DedicatedNodeLabelKey,
+		Operator: corev1.TolerationOpEqual,
+		Value:    name,
+		Effect:   corev1.TaintEffectNoSchedule,
+	})
 }
@@ -17,21 +17,37 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	apps "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/diff"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 	kubeinformers "k8s.io/client-go/informers"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
 	core "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 
 	samplecontroller "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
 	"k8s.io/sample-controller/pkg/generated/clientset/versioned/fake"
@@ -49,7 +65,7 @@ type fixture struct {
 	client     *fake.Clientset
 	kubeclient *k8sfake.Clientset
 	// Objects to put in the store.
-	jobLister        []*samplecontroller.Job
+	jobLister        []*samplecontroller.InferenceJob
 	deploymentLister []*apps.Deployment
 	// Actions expected to happen on the client.
 	kubeactions []core.Action
@@ -67,14 +83,14 @@ func newFixture(t *testing.T) *fixture {
 	return f
 }
 
-func newJob(name string, replicas *int32) *samplecontroller.Job {
-	return &samplecontroller.Job{
+func newJob(name string, replicas *int32) *samplecontroller.InferenceJob {
+	return &samplecontroller.InferenceJob{
 		TypeMeta: metav1.TypeMeta{APIVersion: samplecontroller.SchemeGroupVersion.String()},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: metav1.NamespaceDefault,
 		},
-		Spec: samplecontroller.JobSpec{
+		Spec: samplecontroller.InferenceJobSpec{
 			DeploymentName: fmt.Sprintf("%s-deployment", name),
 			Replicas:       replicas,
 		},
@@ -89,14 +105,15 @@ func (f *fixture) newController() (*Controller, informers.SharedInformerFactory,
 	k8sI := kubeinformers.NewSharedInformerFactory(f.kubeclient, noResyncPeriodFunc())
 
 	c := NewController(f.kubeclient, f.client,
-		k8sI.Apps().V1().Deployments(), i.Samplecontroller().V1alpha1().Jobs())
+		k8sI.Apps().V1().Deployments(), i.Samplecontroller().V1alpha1().InferenceJobs())
 
-	c.jobsSynced = alwaysReady
+	c.inferenceJobsSynced = alwaysReady
 	c.deploymentsSynced = alwaysReady
 	c.recorder = &record.FakeRecorder{}
+	c.deploymentApplier = &fakeDeploymentApplier{client: f.kubeclient}
 
 	for _, f := range f.jobLister {
-		i.Samplecontroller().V1alpha1().Jobs().Informer().GetIndexer().Add(f)
+		i.Samplecontroller().V1alpha1().InferenceJobs().Informer().GetIndexer().Add(f)
 	}
 
 	for _, d := range f.deploymentLister {
@@ -123,7 +140,7 @@ func (f *fixture) runController(jobName string, startInformers bool, expectError
 		k8sI.Start(stopCh)
 	}
 
-	err := c.syncHandler(jobName)
+	err := c.syncHandler(context.Background(), jobName)
 	if !expectError && err != nil {
 		f.t.Errorf("error syncing job: %v", err)
 	} else if expectError && err == nil {
@@ -178,7 +195,7 @@ func checkAction(expected, actual core.Action, t *testing.T) {
 	case core.CreateAction:
 		e, _ := expected.(core.CreateAction)
 		expObject := e.GetObject()
-		object := a.GetObject()
+		object := withoutResourceStatus(a.GetObject())
 
 		if !reflect.DeepEqual(expObject, object) {
 			t.Errorf("Action %s %s has wrong object\nDiff:\n %s",
@@ -187,7 +204,7 @@ func checkAction(expected, actual core.Action, t *testing.T) {
 	case core.UpdateAction:
 		e, _ := expected.(core.UpdateAction)
 		expObject := e.GetObject()
-		object := a.GetObject()
+		object := withoutResourceStatus(a.GetObject())
 
 		if !reflect.DeepEqual(expObject, object) {
 			t.Errorf("Action %s %s has wrong object\nDiff:\n %s",
@@ -205,6 +222,24 @@ func checkAction(expected, actual core.Action, t *testing.T) {
 	}
 }
 
+// withoutResourceStatus clears status.resources and status.lastSyncTime of
+// InferenceJobs, they carry the sync time and are covered by
+// TestSetResourceStatus, as well as the transition times of their
+// conditions.
+func withoutResourceStatus(object runtime.Object) runtime.Object {
+	job, ok := object.(*samplecontroller.InferenceJob)
+	if !ok {
+		return object
+	}
+	job = job.DeepCopy()
+	job.Status.Resources = nil
+	job.Status.LastSyncTime = nil
+	for i := range job.Status.Conditions {
+		job.Status.Conditions[i].LastTransitionTime = metav1.Time{}
+	}
+	return job
+}
+
 // filterInformerActions filters list and watch actions for testing resources.
 // Since list and watch don't change resource state we can filter it to lower
 // nose level in our tests.
@@ -212,8 +247,8 @@ func filterInformerActions(actions []core.Action) []core.Action {
 	ret := []core.Action{}
 	for _, action := range actions {
 		if len(action.GetNamespace()) == 0 &&
-			(action.Matches("list", "jobs") ||
-				action.Matches("watch", "jobs") ||
+			(action.Matches("list", "inferencejobs") ||
+				action.Matches("watch", "inferencejobs") ||
 				action.Matches("list", "deployments") ||
 				action.Matches("watch", "deployments")) {
 			continue
@@ -224,22 +259,51 @@ func filterInformerActions(actions []core.Action) []core.Action {
 	return ret
 }
 
-func (f *fixture) expectCreateDeploymentAction(d *apps.Deployment) {
-	f.kubeactions = append(f.kubeactions, core.NewCreateAction(schema.GroupVersionResource{Resource: "deployments"}, d.Namespace, d))
+func (f *fixture) expectApplyDeploymentAction(d *apps.Deployment) {
+	data, err := applyConfiguration(d)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.kubeactions = append(f.kubeactions, core.NewPatchAction(schema.GroupVersionResource{Resource: "deployments"}, d.Namespace, d.Name, types.ApplyPatchType, data))
+}
+
+// fakeDeploymentApplier records apply patches on the fake clientset, which
+// can't apply them, and stores the applied Deployment as is.
+type fakeDeploymentApplier struct {
+	client *k8sfake.Clientset
 }
 
-func (f *fixture) expectUpdateDeploymentAction(d *apps.Deployment) {
-	f.kubeactions = append(f.kubeactions, core.NewUpdateAction(schema.GroupVersionResource{Resource: "deployments"}, d.Namespace, d))
+func (a *fakeDeploymentApplier) Apply(ctx context.Context, namespace, name string, data []byte) (*apps.Deployment, error) {
+	gvr := apps.SchemeGroupVersion.WithResource("deployments")
+	a.client.Invokes(core.NewPatchAction(gvr, namespace, name, types.ApplyPatchType, data), nil)
+	deployment := &apps.Deployment{}
+	if err := json.Unmarshal(data, deployment); err != nil {
+		return nil, err
+	}
+	err := a.client.Tracker().Update(gvr, deployment, namespace)
+	if errors.IsNotFound(err) {
+		err = a.client.Tracker().Create(gvr, deployment, namespace)
+	}
+	return deployment, err
 }
 
-func (f *fixture) expectUpdateJobStatusAction(job *samplecontroller.Job) {
-	action := core.NewUpdateAction(schema.GroupVersionResource{Resource: "jobs"}, job.Namespace, job)
-	// TODO: Until #38113 is merged, we can't use Subresource
-	//action.Subresource = "status"
+// expectUpdateJobStatusAction expects the status of the job to be updated
+// from d, the Deployment it has after the sync, which has no pod available
+// yet.
+func (f *fixture) expectUpdateJobStatusAction(job *samplecontroller.InferenceJob, d *apps.Deployment) {
+	job = job.DeepCopy()
+	job.Status.Replicas = *d.Spec.Replicas
+	job.Status.LabelSelector = metav1.FormatLabelSelector(d.Spec.Selector)
+	job.Status.TemplateHash = d.Annotations[TemplateHashAnnotation]
+	setCondition(&job.Status, newCondition(samplecontroller.Available, corev1.ConditionUnknown, "DeploymentPending", ""))
+	setCondition(&job.Status, newCondition(samplecontroller.Ready, corev1.ConditionUnknown, "DeploymentPending", ""))
+	setCondition(&job.Status, newCondition(samplecontroller.Progressing, corev1.ConditionTrue, "RolloutInProgress", ""))
+	job.Status.Phase = samplecontroller.PhasePending
+	action := core.NewUpdateSubresourceAction(schema.GroupVersionResource{Resource: "inferencejobs"}, "status", job.Namespace, withoutResourceStatus(job))
 	f.actions = append(f.actions, action)
 }
 
-func getKey(job *samplecontroller.Job, t *testing.T) string {
+func getKey(job *samplecontroller.InferenceJob, t *testing.T) string {
 	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(job)
 	if err != nil {
 		t.Errorf("Unexpected error getting key for job %v: %v", job.Name, err)
@@ -256,8 +320,27 @@ func TestCreatesDeployment(t *testing.T) {
 	f.objects = append(f.objects, job)
 
 	expDeployment := newDeployment(job)
-	f.expectCreateDeploymentAction(expDeployment)
-	f.expectUpdateJobStatusAction(job)
+	f.expectApplyDeploymentAction(expDeployment)
+	f.expectUpdateJobStatusAction(job, expDeployment)
+
+	f.run(getKey(job, t))
+}
+
+func TestCreatesDeploymentFromNameTemplate(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.Spec.DeploymentName = ""
+	job.Spec.ImageToDeploy = "nginx:1.17"
+	job.Spec.NameTemplates = &samplecontroller.NameTemplates{Deployment: "{{.JobName}}-{{.Version}}"}
+
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+
+	named := job.DeepCopy()
+	named.Spec.DeploymentName = "test-1-17"
+	expDeployment := newDeployment(named)
+	f.expectApplyDeploymentAction(expDeployment)
+	f.expectUpdateJobStatusAction(job, expDeployment)
 
 	f.run(getKey(job, t))
 }
@@ -272,7 +355,7 @@ func TestDoNothing(t *testing.T) {
 	f.deploymentLister = append(f.deploymentLister, d)
 	f.kubeobjects = append(f.kubeobjects, d)
 
-	f.expectUpdateJobStatusAction(job)
+	f.expectUpdateJobStatusAction(job, d)
 	f.run(getKey(job, t))
 }
 
@@ -290,11 +373,529 @@ func TestUpdateDeployment(t *testing.T) {
 	f.deploymentLister = append(f.deploymentLister, d)
 	f.kubeobjects = append(f.kubeobjects, d)
 
-	f.expectUpdateJobStatusAction(job)
-	f.expectUpdateDeploymentAction(expDeployment)
+	f.expectUpdateJobStatusAction(job, expDeployment)
+	f.expectApplyDeploymentAction(expDeployment)
+	f.run(getKey(job, t))
+}
+
+func TestUpdateDeploymentTemplateDrift(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	d := newDeployment(job)
+
+	// Reserve dedicated nodes, which only changes the pod template
+	job.Spec.DedicatedNodes = true
+	expDeployment := newDeployment(job)
+
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateJobStatusAction(job, expDeployment)
+	f.expectApplyDeploymentAction(expDeployment)
+	f.run(getKey(job, t))
+}
+
+func TestRestartedAtRollsTemplate(t *testing.T) {
+	for _, previous := range []string{"", "2019-04-01T10:00:00Z"} {
+		f := newFixture(t)
+		job := newJob("test", int32Ptr(1))
+		if previous != "" {
+			job.Annotations = map[string]string{samplecontroller.RestartedAtAnnotation: previous}
+		}
+		d := newDeployment(job)
+
+		// Request a restart, which only changes the pod template annotation
+		job = job.DeepCopy()
+		job.Annotations = map[string]string{samplecontroller.RestartedAtAnnotation: "2019-04-02T10:00:00Z"}
+		expDeployment := newDeployment(job)
+
+		if got := expDeployment.Spec.Template.Annotations[samplecontroller.RestartedAtAnnotation]; got != "2019-04-02T10:00:00Z" {
+			t.Errorf("expected the restart time in the pod template, got %q", got)
+		}
+		if expDeployment.Annotations[TemplateHashAnnotation] == d.Annotations[TemplateHashAnnotation] {
+			t.Errorf("expected the template hash to change")
+		}
+		rest := expDeployment.DeepCopy()
+		rest.Annotations[TemplateHashAnnotation] = d.Annotations[TemplateHashAnnotation]
+		if previous == "" {
+			delete(rest.Spec.Template.Annotations, samplecontroller.RestartedAtAnnotation)
+			if len(rest.Spec.Template.Annotations) == 0 {
+				rest.Spec.Template.Annotations = d.Spec.Template.Annotations
+			}
+		} else {
+			rest.Spec.Template.Annotations[samplecontroller.RestartedAtAnnotation] = previous
+		}
+		if !reflect.DeepEqual(d, rest) {
+			t.Errorf("expected only the pod template to change:\n%s", diff.ObjectGoPrintSideBySide(d, rest))
+		}
+
+		f.jobLister = append(f.jobLister, job)
+		f.objects = append(f.objects, job)
+		f.deploymentLister = append(f.deploymentLister, d)
+		f.kubeobjects = append(f.kubeobjects, d)
+
+		f.expectUpdateJobStatusAction(job, expDeployment)
+		f.expectApplyDeploymentAction(expDeployment)
+		f.run(getKey(job, t))
+	}
+}
+
+func TestDedicatedNodesQualifiedByNamespace(t *testing.T) {
+	job := newJob("test", int32Ptr(1))
+	job.Spec.DedicatedNodes = true
+	other := job.DeepCopy()
+	other.Namespace = "other"
+
+	value := newDeployment(job).Spec.Template.Spec.NodeSelector[samplecontroller.DedicatedNodeLabelKey]
+	if value != "default.test" {
+		t.Errorf("expected the dedicated node value to be qualified by the namespace, got %q", value)
+	}
+	if other := newDeployment(other).Spec.Template.Spec.NodeSelector[samplecontroller.DedicatedNodeLabelKey]; other == value {
+		t.Errorf("expected InferenceJobs of the same name in different namespaces to get different nodes, got %q", other)
+	}
+}
+
+func TestTemplateDriftedImage(t *testing.T) {
+	job := newJob("test", int32Ptr(1))
+	job.Spec.ImageToDeploy = "model-server:v1"
+	desired := newDeployment(job)
+
+	edited := newDeployment(job)
+	edited.Spec.Template.Spec.Containers[0].Image = "model-server:debug"
+	if !templateDrifted(desired, edited) {
+		t.Error("expected an edited image to drift")
+	}
+
+	cleared := desired.DeepCopy()
+	cleared.Spec.Template.Spec.Containers[0].Image = ""
+	if !templateDrifted(cleared, desired) {
+		t.Error("expected a cleared image to drift")
+	}
+	if templateDrifted(desired, desired.DeepCopy()) {
+		t.Error("expected an unchanged image not to drift")
+	}
+}
+
+func TestUpdateDeploymentVolumeRemoved(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.Spec.Volumes = []corev1.Volume{{Name: "scratch", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+	job.Spec.VolumeMounts = []corev1.VolumeMount{{Name: "scratch", MountPath: "/scratch"}}
+	d := newDeployment(job)
+
+	// Drop the scratch volume, which DeepDerivative alone doesn't notice
+	job.Spec.Volumes = nil
+	job.Spec.VolumeMounts = nil
+	expDeployment := newDeployment(job)
+
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateJobStatusAction(job, expDeployment)
+	f.expectApplyDeploymentAction(expDeployment)
+	f.run(getKey(job, t))
+}
+
+func TestUpdateDeploymentArgsCleared(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.Spec.Args = []string{"--workers=4"}
+	d := newDeployment(job)
+
+	// Fall back to the default arguments of the image
+	job.Spec.Args = nil
+	expDeployment := newDeployment(job)
+
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateJobStatusAction(job, expDeployment)
+	f.expectApplyDeploymentAction(expDeployment)
+	f.run(getKey(job, t))
+}
+
+func TestUpdateDeploymentSidecarRemoved(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.Spec.ExtraContainers = []corev1.Container{{Name: "log-agent", Image: "fluent-bit"}}
+	d := newDeployment(job)
+
+	job.Spec.ExtraContainers = nil
+	expDeployment := newDeployment(job)
+
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateJobStatusAction(job, expDeployment)
+	f.expectApplyDeploymentAction(expDeployment)
+	f.run(getKey(job, t))
+}
+
+func TestNewDeploymentFromTemplate(t *testing.T) {
+	job := newJob("test", int32Ptr(1))
+	job.Spec.Template = &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"controller": "other", "team": "ml"}},
+		Spec: corev1.PodSpec{
+			DNSPolicy:  corev1.DNSClusterFirstWithHostNet,
+			Containers: []corev1.Container{{Name: "server", Image: "ignored", WorkingDir: "/models"}},
+		},
+	}
+
+	d := newDeployment(job)
+	podSpec := d.Spec.Template.Spec
+	if podSpec.DNSPolicy != corev1.DNSClusterFirstWithHostNet {
+		t.Errorf("expected the DNS policy of the template, got %q", podSpec.DNSPolicy)
+	}
+	if c := podSpec.Containers[0]; c.Name != "server" || c.Image != job.Spec.ImageToDeploy || c.WorkingDir != "/models" {
+		t.Errorf("expected the template container running the job image, got %#v", c)
+	}
+	if d.Spec.Template.Labels["controller"] != job.Name || d.Spec.Template.Labels["team"] != "ml" {
+		t.Errorf("expected the selector labels merged over the template labels, got %v", d.Spec.Template.Labels)
+	}
+	if job.Spec.Template.Spec.Containers[0].Image != "ignored" {
+		t.Errorf("expected the template of the job to be left unchanged")
+	}
+}
+
+func TestNewDeploymentGPUsKeepTemplateLimits(t *testing.T) {
+	job := newJob("test", int32Ptr(1))
+	gpus := int64(2)
+	job.Spec.GPUs = &gpus
+	job.Spec.Template = &corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")},
+			}}},
+		},
+	}
+
+	limits := newDeployment(job).Spec.Template.Spec.Containers[0].Resources.Limits
+	if cpu := limits[corev1.ResourceCPU]; cpu.String() != "4" {
+		t.Errorf("expected the cpu limit of the template to be kept, got %v", limits)
+	}
+	if gpu := limits[gpuResourceName]; gpu.Value() != 2 {
+		t.Errorf("expected 2 GPUs, got %v", limits)
+	}
+	if _, ok := job.Spec.Template.Spec.Containers[0].Resources.Limits[gpuResourceName]; ok {
+		t.Errorf("expected the template of the job to be left unchanged")
+	}
+}
+
+func TestUpdateDeploymentStrategy(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	d := newDeployment(job)
+
+	job.Spec.Strategy = &apps.DeploymentStrategy{Type: apps.RecreateDeploymentStrategyType}
+	expDeployment := newDeployment(job)
+
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateJobStatusAction(job, expDeployment)
+	f.expectApplyDeploymentAction(expDeployment)
+	f.run(getKey(job, t))
+}
+
+func TestUpdateDeploymentRevisionHistoryLimit(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	d := newDeployment(job)
+
+	job.Spec.RevisionHistoryLimit = int32Ptr(2)
+	expDeployment := newDeployment(job)
+
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateJobStatusAction(job, expDeployment)
+	f.expectApplyDeploymentAction(expDeployment)
+	f.run(getKey(job, t))
+}
+
+func TestUpdateDeploymentTransformerArgsCleared(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.Spec.Transformer = &samplecontroller.TransformerSpec{Image: "transformer:1.0", Args: []string{"--normalize"}}
+	d := newDeployment(job)
+
+	job.Spec.Transformer.Args = nil
+	expDeployment := newDeployment(job)
+
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateJobStatusAction(job, expDeployment)
+	f.expectApplyDeploymentAction(expDeployment)
+	f.run(getKey(job, t))
+}
+
+func TestUpdateDeploymentHostAliasesRemoved(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.Spec.HostAliases = []corev1.HostAlias{{IP: "10.0.0.10", Hostnames: []string{"registry.internal"}}}
+	d := newDeployment(job)
+
+	job.Spec.HostAliases = nil
+	expDeployment := newDeployment(job)
+
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	f.expectUpdateJobStatusAction(job, expDeployment)
+	f.expectApplyDeploymentAction(expDeployment)
 	f.run(getKey(job, t))
 }
 
+func TestDeleteSupersededDeployments(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.UID = "uid"
+	job.Status.DeploymentName = "test-old"
+	current := newDeployment(job)
+	current.Status.AvailableReplicas = 1
+
+	renamed := job.DeepCopy()
+	renamed.Spec.DeploymentName = "test-renamed"
+	controlled := newDeployment(renamed)
+	// Lost its owner reference, still labelled by the controller.
+	old := newDeployment(job)
+	old.Name = "test-old"
+	old.OwnerReferences = nil
+	old.Labels = map[string]string{InferenceJobUIDLabel: "uid"}
+	unrelated := old.DeepCopy()
+	unrelated.Name = "test-unrelated"
+	f.deploymentLister = append(f.deploymentLister, current, controlled, old, unrelated)
+	c, _, _ := f.newController()
+
+	current.Status.AvailableReplicas = 0
+	if err := c.deleteSupersededDeployments(job, current); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actions := f.kubeclient.Actions(); len(actions) != 0 {
+		t.Fatalf("expected no deletion before the current deployment is available, got %+v", actions)
+	}
+
+	current.Status.AvailableReplicas = 1
+	if err := c.deleteSupersededDeployments(job, current); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deleted := map[string]bool{}
+	for _, action := range f.kubeclient.Actions() {
+		if action.Matches("delete", "deployments") {
+			deleted[action.(core.DeleteAction).GetName()] = true
+		}
+	}
+	if !reflect.DeepEqual(deleted, map[string]bool{"test-renamed": true, "test-old": true}) {
+		t.Errorf("expected the renamed and last deployments to be deleted, got %v", deleted)
+	}
+}
+
+func TestAdoptExistingDeployment(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	existing := newDeployment(job)
+	existing.OwnerReferences = nil
+	f.kubeobjects = append(f.kubeobjects, existing)
+	c, _, _ := f.newController()
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	if adopted, err := c.adoptDeployment(job, existing); adopted != nil || err != nil {
+		t.Fatalf("expected no adoption without spec.adoptExisting, got %v, %v", adopted, err)
+	}
+	controlled := existing.DeepCopy()
+	other := newJob("other", int32Ptr(1))
+	controlled.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(other, samplecontroller.SchemeGroupVersion.WithKind("InferenceJob"))}
+	job.Spec.AdoptExisting = true
+	if adopted, err := c.adoptDeployment(job, controlled); adopted != nil || err != nil {
+		t.Fatalf("expected no adoption of a controlled deployment, got %v, %v", adopted, err)
+	}
+	if actions := filterInformerActions(f.kubeclient.Actions()); len(actions) != 0 {
+		t.Fatalf("expected no actions, got %+v", actions)
+	}
+
+	adopted, err := c.adoptDeployment(job, existing)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !metav1.IsControlledBy(adopted, job) {
+		t.Errorf("expected the deployment to be controlled by the InferenceJob, got %+v", adopted.OwnerReferences)
+	}
+	if event := <-recorder.Events; event != `Normal Adopted Adopted existing Deployment "test-deployment"` {
+		t.Errorf("unexpected event %q", event)
+	}
+}
+
+func TestNewStatefulSet(t *testing.T) {
+	job := newJob("test", int32Ptr(2))
+	job.Spec.WorkloadType = samplecontroller.WorkloadTypeStatefulSet
+	job.Spec.Ports = []corev1.ContainerPort{{ContainerPort: 8080, Protocol: corev1.ProtocolTCP}}
+	job.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "model-cache"}}}
+
+	statefulSet := newStatefulSet(job)
+	d := newDeployment(job)
+	if statefulSet.Name != d.Name || statefulSet.Spec.ServiceName != d.Name {
+		t.Errorf("expected statefulset and service %s, got %s and %s", d.Name, statefulSet.Name, statefulSet.Spec.ServiceName)
+	}
+	if !reflect.DeepEqual(statefulSet.Spec.Template, d.Spec.Template) {
+		t.Errorf("expected the pod template of the deployment")
+	}
+	if len(statefulSet.Spec.VolumeClaimTemplates) != 1 || statefulSet.Spec.VolumeClaimTemplates[0].Name != "model-cache" {
+		t.Errorf("expected the model-cache claim template, got %v", statefulSet.Spec.VolumeClaimTemplates)
+	}
+
+	service := newHeadlessService(statefulSet)
+	expPorts := []corev1.ServicePort{{Name: "port-8080", Port: 8080, Protocol: corev1.ProtocolTCP}}
+	if service.Spec.ClusterIP != corev1.ClusterIPNone || !reflect.DeepEqual(service.Spec.Ports, expPorts) {
+		t.Errorf("expected a headless service with ports %v, got %+v", expPorts, service.Spec)
+	}
+	address, url := serviceEndpoint(service, defaultClusterDomain)
+	if address != "test-deployment.default.svc.cluster.local" || url != "http://test-deployment.default.svc.cluster.local:8080" {
+		t.Errorf("unexpected address %s and url %s", address, url)
+	}
+}
+
+func TestChildNames(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	c.nameTemplates.Service = "{{.JobName}}-svc"
+	job := newJob("test", int32Ptr(1))
+	job.Spec.DeploymentName = ""
+	job.Spec.ImageToDeploy = "model-server:v2"
+	job.Spec.WorkloadType = samplecontroller.WorkloadTypeStatefulSet
+
+	for _, test := range []struct {
+		templates   *samplecontroller.NameTemplates
+		workload    string
+		service     string
+		description string
+	}{
+		{nil, "test", "test-svc", "controller templates"},
+		{&samplecontroller.NameTemplates{Deployment: "{{.JobName}}-{{.Version}}"}, "test-v2", "test-svc", "deployment template"},
+		{&samplecontroller.NameTemplates{Deployment: "{{.JobName}}-{{.Version}}", StatefulSet: "{{.JobName}}-sts", Service: "{{.JobName}}-headless"}, "test-sts", "test-headless", "per kind templates"},
+	} {
+		job.Spec.NameTemplates = test.templates
+		workload, err := c.deploymentName(job)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.description, err)
+		}
+		service, err := c.serviceName(job, workload)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.description, err)
+		}
+		if workload != test.workload || service != test.service {
+			t.Errorf("%s: expected %s and %s, got %s and %s", test.description, test.workload, test.service, workload, service)
+		}
+	}
+
+	c.nameTemplates.Service = ""
+	job.Spec.NameTemplates = nil
+	if service, _ := c.serviceName(job, "test"); service != "test" {
+		t.Errorf("expected the service to be named after the statefulset, got %s", service)
+	}
+	job.Spec.WorkloadType = samplecontroller.WorkloadTypeDaemonSet
+	job.Spec.NameTemplates = &samplecontroller.NameTemplates{DaemonSet: "{{.JobName}}-ds"}
+	if name, _ := c.deploymentName(job); name != "test-ds" {
+		t.Errorf("expected the daemonset template, got %s", name)
+	}
+}
+
+func TestNewDaemonSet(t *testing.T) {
+	job := newJob("test", int32Ptr(2))
+	job.Spec.WorkloadType = samplecontroller.WorkloadTypeDaemonSet
+
+	daemonSet := newDaemonSet(job)
+	d := newDeployment(job)
+	if daemonSet.Name != d.Name || !reflect.DeepEqual(daemonSet.Spec.Selector, d.Spec.Selector) {
+		t.Errorf("expected daemonset %s with the selector of the deployment, got %s", d.Name, daemonSet.Name)
+	}
+	if !reflect.DeepEqual(daemonSet.Spec.Template, d.Spec.Template) {
+		t.Errorf("expected the pod template of the deployment")
+	}
+	if !daemonSetDrifted(job, daemonSet, &apps.DaemonSet{}) {
+		t.Errorf("expected a daemonset without the template hash to have drifted")
+	}
+	if daemonSetDrifted(job, daemonSet, daemonSet.DeepCopy()) {
+		t.Errorf("expected an identical daemonset not to have drifted")
+	}
+}
+
+func TestOrphanSweeper(t *testing.T) {
+	old := metav1.NewTime(time.Now().Add(-time.Hour))
+	service := func(name, job string, created metav1.Time, owners ...metav1.OwnerReference) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         metav1.NamespaceDefault,
+			Labels:            map[string]string{InferenceJobLabel: job},
+			CreationTimestamp: created,
+			OwnerReferences:   owners,
+		}}
+	}
+	isController := true
+	kubeclient := k8sfake.NewSimpleClientset(
+		service("orphan", "deleted", old),
+		service("live", "test", old),
+		service("young", "deleted", metav1.Now()),
+		service("foreign", "deleted", old, metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "other", Controller: &isController}),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled", Namespace: metav1.NamespaceDefault, CreationTimestamp: old}},
+	)
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("get", "inferencejobs", func(action core.Action) (bool, runtime.Object, error) {
+		name := action.(core.GetAction).GetName()
+		if name == "test" {
+			return true, newJob(name, int32Ptr(1)), nil
+		}
+		return true, nil, errors.NewNotFound(schema.GroupResource{Resource: "inferencejobs"}, name)
+	})
+
+	sweeper := newOrphanSweeper(kubeclient, client, true)
+	orphans, err := sweeper.sweep()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(orphans) != 1 || orphans[0].kind != "Service" || orphans[0].name != "orphan" {
+		t.Fatalf("expected the orphan service, got %+v", orphans)
+	}
+	if _, err := kubeclient.CoreV1().Services(metav1.NamespaceDefault).Get("orphan", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected a dry run to keep the orphan, got %v", err)
+	}
+
+	sweeper.namespace = "tenant"
+	if orphans, err := sweeper.sweep(); err != nil || len(orphans) != 0 {
+		t.Fatalf("expected no orphans outside the namespace, got %+v, %v", orphans, err)
+	}
+
+	sweeper.namespace = metav1.NamespaceDefault
+	sweeper.dryRun = false
+	if _, err := sweeper.sweep(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := kubeclient.CoreV1().Services(metav1.NamespaceDefault).Get("orphan", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected the orphan to be removed, got %v", err)
+	}
+	services, _ := kubeclient.CoreV1().Services(metav1.NamespaceDefault).List(metav1.ListOptions{})
+	if len(services.Items) != 3 {
+		t.Errorf("expected the other services to be kept, got %d", len(services.Items))
+	}
+}
+
 func TestNotControlledByUs(t *testing.T) {
 	f := newFixture(t)
 	job := newJob("test", int32Ptr(1))
@@ -310,4 +911,1580 @@ func TestNotControlledByUs(t *testing.T) {
 	f.runExpectError(getKey(job, t))
 }
 
-func int32Ptr(i int32) *int32 { return &i }
+func TestDeploymentNameClaimant(t *testing.T) {
+	f := newFixture(t)
+	first := newJob("first", int32Ptr(1))
+	first.UID = "first"
+	first.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	second := newJob("second", int32Ptr(1))
+	second.UID = "second"
+	second.CreationTimestamp = metav1.Now()
+	second.Spec.DeploymentName = first.Spec.DeploymentName
+	f.jobLister = append(f.jobLister, first, second)
+
+	c, _, _ := f.newController()
+	if claimant, err := c.deploymentNameClaimant(first); err != nil || claimant != nil {
+		t.Errorf("expected first to own the deployment name, got %v, %v", claimant, err)
+	}
+	if claimant, err := c.deploymentNameClaimant(second); err != nil || claimant != first {
+		t.Errorf("expected second to conflict with first, got %v, %v", claimant, err)
+	}
+}
+
+func TestCacheWatchdogCheck(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.ResourceVersion = "1"
+	d := newDeployment(job)
+	d.ResourceVersion = "2"
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	// The Deployment never reaches the cache.
+	f.kubeobjects = append(f.kubeobjects, d)
+	c, _, _ := f.newController()
+	w := newCacheWatchdog(f.kubeclient, f.client, c.deploymentsLister, c.inferenceJobsLister, time.Minute)
+
+	start := time.Now()
+	for _, tc := range []struct {
+		now      time.Time
+		expected []string
+	}{
+		{now: start},
+		{now: start.Add(2 * time.Minute), expected: []string{"deployment/default/test-deployment"}},
+	} {
+		stale, err := w.check(tc.now)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(stale, tc.expected) {
+			t.Errorf("expected stale objects %v, got %v", tc.expected, stale)
+		}
+	}
+}
+
+func TestCacheWatchdogObserve(t *testing.T) {
+	w := &cacheWatchdog{maxStaleness: time.Minute, lags: map[string]cacheLag{}}
+	start := time.Now()
+
+	// The cache is behind, but within the allowed staleness.
+	live := map[string]string{"a": "2", "b": "5"}
+	if stale := w.observe(live, map[string]string{"a": "1", "b": "5"}, start); len(stale) != 0 {
+		t.Errorf("expected no stale objects, got %v", stale)
+	}
+	// The cached copy of a moved on, which counts as progress.
+	if stale := w.observe(live, map[string]string{"a": "3", "b": "5"}, start.Add(2*time.Minute)); len(stale) != 0 {
+		t.Errorf("expected no stale objects, got %v", stale)
+	}
+	// The cached copy of b never catches up.
+	live["b"] = "6"
+	w.observe(live, map[string]string{"a": "2", "b": "5"}, start.Add(3*time.Minute))
+	stale := w.observe(live, map[string]string{"a": "2", "b": "5"}, start.Add(5*time.Minute))
+	if !reflect.DeepEqual(stale, []string{"b"}) {
+		t.Errorf("expected b to be stale, got %v", stale)
+	}
+}
+
+func TestSurgedReplicas(t *testing.T) {
+	job := newJob("test", int32Ptr(3))
+	for _, tc := range []struct {
+		replicas, surge, expected int32
+	}{
+		{replicas: 3, surge: 0, expected: 3},
+		{replicas: 3, surge: 2, expected: 5},
+		// Held back by the downscale stabilization window with the surge.
+		{replicas: 5, surge: 2, expected: 5},
+		{replicas: 6, surge: 2, expected: 6},
+	} {
+		if got := surgedReplicas(job, int32Ptr(tc.replicas), tc.surge); *got != tc.expected {
+			t.Errorf("replicas %d with surge %d: expected %d, got %d", tc.replicas, tc.surge, tc.expected, *got)
+		}
+	}
+}
+
+func TestHibernatedDeployment(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(3))
+	d := newDeployment(job)
+	job.Annotations = map[string]string{HibernatedReplicasAnnotation: "3"}
+
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	f.deploymentLister = append(f.deploymentLister, d)
+	f.kubeobjects = append(f.kubeobjects, d)
+
+	// The Deployment is scaled to zero, the spec of the InferenceJob keeps
+	// its replicas.
+	expDeployment := newDeployment(job)
+	if *expDeployment.Spec.Replicas != 0 {
+		t.Fatalf("expected a hibernated deployment to have 0 replicas, got %d", *expDeployment.Spec.Replicas)
+	}
+	f.expectUpdateJobStatusAction(job, expDeployment)
+	// Without replicas the rollout completes right away.
+	status := f.actions[len(f.actions)-1].(core.UpdateAction).GetObject().(*samplecontroller.InferenceJob)
+	setCondition(&status.Status, newCondition(samplecontroller.Progressing, corev1.ConditionFalse, "RolloutComplete", ""))
+	for i := range status.Status.Conditions {
+		status.Status.Conditions[i].LastTransitionTime = metav1.Time{}
+	}
+	status.Status.DeploymentName = expDeployment.Name
+	f.expectApplyDeploymentAction(expDeployment)
+	f.run(getKey(job, t))
+
+	if !inferenceJobReady(job) {
+		t.Errorf("expected a hibernated member not to hold back its set")
+	}
+	if got := surgedReplicas(job, int32Ptr(0), 2); *got != 0 {
+		t.Errorf("expected a hibernated deployment not to be surged, got %d replicas", *got)
+	}
+}
+
+func TestSyncHibernation(t *testing.T) {
+	job := newJob("test", int32Ptr(3))
+	exempt := newJob("production", int32Ptr(3))
+	exempt.Labels = map[string]string{"environment": "production"}
+	f := newFixture(t)
+	f.jobLister = append(f.jobLister, job, exempt)
+	f.objects = append(f.objects, job, exempt)
+	c, _, _ := f.newController()
+	exemptSelector, _ := labels.Parse(defaultHibernationExemptSelector)
+	c.hibernation = &hibernationConfig{
+		Windows: []hibernationWindow{{end: 24 * time.Hour, location: time.UTC}},
+		exempt:  exemptSelector,
+	}
+
+	// Only the annotation is patched, spec.replicas is left to the owner
+	// of the InferenceJob.
+	c.syncHibernation()
+	c.hibernation.Windows = nil
+	job.Annotations = map[string]string{HibernatedReplicasAnnotation: "3"}
+	c.syncHibernation()
+
+	expected := []string{
+		`{"metadata":{"annotations":{"fabianoyoschitaki.io/hibernated-replicas":"3"}}}`,
+		`{"metadata":{"annotations":{"fabianoyoschitaki.io/hibernated-replicas":null}}}`,
+	}
+	actions := filterInformerActions(f.client.Actions())
+	if len(actions) != len(expected) {
+		t.Fatalf("expected %d patches, got %d: %+v", len(expected), len(actions), actions)
+	}
+	for i, action := range actions {
+		patch, ok := action.(core.PatchAction)
+		if !ok || patch.GetName() != job.Name {
+			t.Errorf("unexpected action %+v", action)
+			continue
+		}
+		if string(patch.GetPatch()) != expected[i] {
+			t.Errorf("expected patch %s, got %s", expected[i], patch.GetPatch())
+		}
+	}
+}
+
+func TestSetReadyCondition(t *testing.T) {
+	job := newJob("test", int32Ptr(1))
+	job.Spec.PostRolloutTest = &samplecontroller.PostRolloutTest{Image: "smoke-test"}
+	d := newDeployment(job)
+	d.Status = apps.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	revision := d.Annotations[TemplateHashAnnotation]
+
+	for _, tc := range []struct {
+		name     string
+		result   *samplecontroller.PostRolloutTestResult
+		expected bool
+	}{
+		{name: "untested", expected: false},
+		{name: "passed", result: &samplecontroller.PostRolloutTestResult{Revision: revision, Passed: true}, expected: true},
+		{name: "failed", result: &samplecontroller.PostRolloutTestResult{Revision: revision, Attempts: 3}, expected: false},
+		{name: "retrying", result: &samplecontroller.PostRolloutTestResult{Revision: revision, Attempts: 1}, expected: false},
+		{name: "previous revision", result: &samplecontroller.PostRolloutTestResult{Revision: "old", Passed: true}, expected: false},
+	} {
+		job := job.DeepCopy()
+		setReadyCondition(&job.Status, job.Spec.PostRolloutTest, d, tc.result)
+		if got := promotable(job); got != tc.expected {
+			t.Errorf("%s: expected promotable %v, got %v", tc.name, tc.expected, got)
+		}
+		// Only the last attempt fails the revision.
+		cond := getCondition(job.Status, samplecontroller.Ready)
+		if failed := cond.Reason == ErrPostRolloutTest; failed != (tc.name == "failed") {
+			t.Errorf("%s: unexpected Ready condition reason %q", tc.name, cond.Reason)
+		}
+	}
+}
+
+func TestPostRolloutTestRetries(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[requests])
+		requests++
+	}))
+	defer server.Close()
+
+	job := newJob("test", int32Ptr(1))
+	job.Spec.PostRolloutTest = &samplecontroller.PostRolloutTest{
+		HTTP:        &samplecontroller.HTTPRolloutTest{Port: int32(server.Listener.Addr().(*net.TCPAddr).Port)},
+		MaxAttempts: 2,
+	}
+	d := newDeployment(job)
+	d.Status = apps.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-0", Namespace: d.Namespace, Labels: d.Spec.Selector.MatchLabels},
+		Status: corev1.PodStatus{
+			PodIP:      "127.0.0.1",
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	f := newFixture(t)
+	f.kubeobjects = append(f.kubeobjects, pod)
+	c, _, _ := f.newController()
+	key := getKey(job, t)
+
+	// test runs the post-rollout test until the request in the background
+	// returned.
+	test := func() *samplecontroller.PostRolloutTestResult {
+		var result *samplecontroller.PostRolloutTestResult
+		err := wait.Poll(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+			var err error
+			result, err = c.postRolloutTest(key, job, d)
+			return result != job.Status.PostRolloutTest, err
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result
+	}
+
+	result := test()
+	if result.Passed || result.Attempts != 1 {
+		t.Fatalf("expected the first attempt to fail, got %+v", result)
+	}
+	job.Status.PostRolloutTest = result
+	// The retry waits for its backoff.
+	if got, err := c.postRolloutTest(key, job, d); err != nil || got != result {
+		t.Fatalf("expected no retry within the backoff, got %+v, %v", got, err)
+	}
+
+	result.CompletedAt = metav1.NewTime(result.CompletedAt.Add(-postRolloutTestBackoff(1)))
+	result = test()
+	if result.Passed || result.Attempts != 2 {
+		t.Fatalf("expected the second attempt to fail, got %+v", result)
+	}
+	job.Status.PostRolloutTest = result
+	// The last attempt failed, the revision isn't tested again.
+	result.CompletedAt = metav1.NewTime(result.CompletedAt.Add(-maxPostRolloutTestRetryInterval))
+	if got, err := c.postRolloutTest(key, job, d); err != nil || got != result {
+		t.Fatalf("expected no attempt past maxAttempts, got %+v, %v", got, err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestUpdateInferenceJobStatusReplicas(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	job := newJob("test", int32Ptr(3))
+	d := newDeployment(job)
+	job.Generation = 4
+	d.Generation = 2
+	d.Status = apps.DeploymentStatus{Replicas: 4, ReadyReplicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2, UnavailableReplicas: 2}
+
+	// The fake client doesn't find the job, the update is still recorded.
+	c.updateInferenceJobStatus(job, d, 0, nil)
+	actions := f.client.Actions()
+	if len(actions) == 0 {
+		t.Fatalf("expected a status update")
+	}
+	status := actions[len(actions)-1].(core.UpdateAction).GetObject().(*samplecontroller.InferenceJob).Status
+	if status.Replicas != 3 || status.AvailableReplicas != 2 || status.ReadyReplicas != 3 || status.UpdatedReplicas != 2 || status.UnavailableReplicas != 2 {
+		t.Errorf("expected the replicas of the deployment, got %+v", status)
+	}
+	if status.LabelSelector != "app=,controller=test" {
+		t.Errorf("expected the pod selector for the scale subresource, got %q", status.LabelSelector)
+	}
+	if status.LastSyncTime == nil || status.ObservedGeneration != 4 || status.DeploymentGeneration != 2 || status.TemplateHash != d.Annotations[TemplateHashAnnotation] {
+		t.Errorf("expected the synced generations and template hash, got %+v", status)
+	}
+}
+
+func TestSetDeploymentConditions(t *testing.T) {
+	job := newJob("test", int32Ptr(1))
+	d := newDeployment(job)
+	d.Status = apps.DeploymentStatus{
+		Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1,
+		Conditions: []apps.DeploymentCondition{{Type: apps.DeploymentAvailable, Status: corev1.ConditionTrue, Reason: "MinimumReplicasAvailable"}},
+	}
+	setCondition(&job.Status, newCondition(samplecontroller.Degraded, corev1.ConditionTrue, "SyncFailed", "boom"))
+
+	setDeploymentConditions(&job.Status, job, d)
+	for condType, expected := range map[samplecontroller.InferenceJobConditionType]corev1.ConditionStatus{
+		samplecontroller.Available:   corev1.ConditionTrue,
+		samplecontroller.Ready:       corev1.ConditionTrue,
+		samplecontroller.Progressing: corev1.ConditionFalse,
+	} {
+		if cond := getCondition(job.Status, condType); cond == nil || cond.Status != expected {
+			t.Errorf("expected %s %s, got %+v", condType, expected, cond)
+		}
+	}
+	if cond := getCondition(job.Status, samplecontroller.Degraded); cond != nil {
+		t.Errorf("expected a successful sync to clear Degraded, got %+v", cond)
+	}
+
+	d.Status.Conditions = append(d.Status.Conditions, apps.DeploymentCondition{Type: apps.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"})
+	setDeploymentConditions(&job.Status, job, d)
+	if cond := getCondition(job.Status, samplecontroller.Degraded); cond == nil || cond.Status != corev1.ConditionTrue {
+		t.Errorf("expected an exceeded progress deadline to be Degraded, got %+v", cond)
+	}
+}
+
+func TestInferenceJobPhase(t *testing.T) {
+	now := metav1.Now()
+	for _, tc := range []struct {
+		name       string
+		conditions []samplecontroller.InferenceJobCondition
+		available  int32
+		deleted    bool
+		expected   samplecontroller.InferenceJobPhase
+	}{
+		{name: "new", expected: samplecontroller.PhasePending},
+		{
+			name:       "rolling out",
+			conditions: []samplecontroller.InferenceJobCondition{newCondition(samplecontroller.Progressing, corev1.ConditionTrue, "RolloutInProgress", "")},
+			available:  1,
+			expected:   samplecontroller.PhaseDeploying,
+		},
+		{
+			name: "running",
+			conditions: []samplecontroller.InferenceJobCondition{
+				newCondition(samplecontroller.Available, corev1.ConditionTrue, "MinimumReplicasAvailable", ""),
+				newCondition(samplecontroller.Progressing, corev1.ConditionFalse, "RolloutComplete", ""),
+			},
+			available: 1,
+			expected:  samplecontroller.PhaseRunning,
+		},
+		{
+			name:       "crashing",
+			conditions: []samplecontroller.InferenceJobCondition{newCondition(samplecontroller.Degraded, corev1.ConditionTrue, "CrashLoopBackOff", "")},
+			available:  1,
+			expected:   samplecontroller.PhaseFailed,
+		},
+		{name: "deleted", deleted: true, expected: samplecontroller.PhaseTerminating},
+	} {
+		job := newJob("test", int32Ptr(1))
+		job.Status.Conditions = tc.conditions
+		job.Status.AvailableReplicas = tc.available
+		if tc.deleted {
+			job.DeletionTimestamp = &now
+		}
+		if phase := inferenceJobPhase(job); phase != tc.expected {
+			t.Errorf("%s: expected phase %s, got %s", tc.name, tc.expected, phase)
+		}
+	}
+}
+
+func TestSetFailingPodsCondition(t *testing.T) {
+	job := newJob("test", int32Ptr(1))
+	d := newDeployment(job)
+	d.Status.UnavailableReplicas = 1
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: metav1.NamespaceDefault, Labels: d.Spec.Template.Labels},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "server",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off restarting"}},
+		}}},
+	}
+	f := newFixture(t)
+	f.kubeobjects = append(f.kubeobjects, pod)
+	c, _, _ := f.newController()
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	status := job.Status.DeepCopy()
+	c.setFailingPodsCondition(job, status, d)
+	cond := getCondition(*status, samplecontroller.Degraded)
+	if cond == nil || cond.Reason != "CrashLoopBackOff" || cond.Message != "container server of pod test-pod: back-off restarting" {
+		t.Errorf("expected the pod failure in the Degraded condition, got %+v", cond)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected an event for the pod failure, got %d", len(recorder.Events))
+	}
+
+	c.handlePod(pod)
+	if key, _ := c.workqueue.Get(); key != "default/test" {
+		t.Errorf("expected the failing pod to enqueue its InferenceJob, got %v", key)
+	}
+}
+
+func TestNamespaceLimiter(t *testing.T) {
+	l := newNamespaceLimiter(1)
+	release, ok := l.tryAcquire("a")
+	if !ok {
+		t.Fatalf("expected a write slot in namespace a")
+	}
+	if _, ok := l.tryAcquire("a"); ok {
+		t.Errorf("expected namespace a to be throttled")
+	}
+	if _, ok := l.tryAcquire("b"); !ok {
+		t.Errorf("expected namespace b not to be throttled by a")
+	}
+	release()
+	if _, ok := l.tryAcquire("a"); !ok {
+		t.Errorf("expected a write slot in namespace a after release")
+	}
+}
+
+func TestSetResourceStatus(t *testing.T) {
+	job := newJob("test", int32Ptr(1))
+	d := newDeployment(job)
+	status := &samplecontroller.InferenceJobStatus{}
+	setResourceStatus(status, samplecontroller.ResourceStatus{Kind: "Deployment", Name: d.Name, LastError: "conflict"})
+	setResourceStatus(status, deploymentResourceStatus(d))
+
+	if len(status.Resources) != 1 {
+		t.Fatalf("expected 1 resource, got %d", len(status.Resources))
+	}
+	r := status.Resources[0]
+	if r.Name != d.Name || r.LastAppliedHash != d.Annotations[TemplateHashAnnotation] || r.LastError != "" || r.LastSyncTime.IsZero() {
+		t.Errorf("unexpected resource status %+v", r)
+	}
+}
+
+func TestExternalPolicyReview(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var review policyReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			t.Errorf("invalid review: %v", err)
+		}
+		json.NewEncoder(w).Encode(policyDecision{
+			Allowed: review.Deployment.Spec.Template.Spec.Containers[0].Image != "unapproved:latest",
+			Message: "image not approved",
+		})
+	}))
+	defer server.Close()
+	p := newExternalPolicy(server.URL, policyFailureFail, time.Second, time.Minute)
+
+	job := newJob("test", int32Ptr(1))
+	job.Spec.ImageToDeploy = "unapproved:latest"
+	for i := 0; i < 2; i++ {
+		decision, err := p.review(job, newDeployment(job))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if decision.Allowed || decision.Message != "image not approved" {
+			t.Errorf("expected the deployment to be denied, got %+v", decision)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the decision to be cached, got %d requests", requests)
+	}
+
+	job.Spec.ImageToDeploy = "approved:latest"
+	if decision, err := p.review(job, newDeployment(job)); err != nil || !decision.Allowed {
+		t.Errorf("expected the changed deployment to be allowed, got %+v, %v", decision, err)
+	}
+	if requests != 2 {
+		t.Errorf("expected the changed deployment to be reviewed again, got %d requests", requests)
+	}
+
+	server.Close()
+	p.forget(getKey(job, t))
+	if _, err := p.review(job, newDeployment(job)); err == nil {
+		t.Errorf("expected an error from the unavailable endpoint")
+	}
+}
+
+func TestClassRateLimiter(t *testing.T) {
+	backoffs, err := parseRetryBackoffs("quota=1m:1h")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := newClassRateLimiter(backoffs)
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+
+	r.observe("default/quota", errors.NewForbidden(deployments, "test", fmt.Errorf("exceeded quota: compute")))
+	if d := r.When("default/quota"); d != time.Minute {
+		t.Errorf("expected the quota backoff to start at 1m, got %s", d)
+	}
+	if d := r.When("default/quota"); d != 2*time.Minute {
+		t.Errorf("expected the quota backoff to double, got %s", d)
+	}
+	r.observe("default/conflict", errors.NewConflict(deployments, "test", fmt.Errorf("stale")))
+	if d := r.When("default/conflict"); d != 5*time.Millisecond {
+		t.Errorf("expected the conflict backoff to start at 5ms, got %s", d)
+	}
+	// Requeues add up whatever the class of the error.
+	r.observe("default/quota", errors.NewConflict(deployments, "test", fmt.Errorf("stale")))
+	r.When("default/quota")
+	r.observe("default/quota", fmt.Errorf("connection refused"))
+	r.When("default/quota")
+	if n := r.NumRequeues("default/quota"); n != 4 {
+		t.Errorf("expected 4 requeues across error classes, got %d", n)
+	}
+	r.Forget("default/quota")
+	if n := r.NumRequeues("default/quota"); n != 0 {
+		t.Errorf("expected no requeues after Forget, got %d", n)
+	}
+
+	if _, err := parseRetryBackoffs("network=1s:1m"); err == nil {
+		t.Errorf("expected an error for an unknown retry class")
+	}
+}
+
+func TestBucketRateLimiter(t *testing.T) {
+	now := time.Now()
+	b := newBucketRateLimiter(2, 2)
+	b.now = func() time.Time { return now }
+	for i, expected := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		if d := b.When("default/test"); d != expected {
+			t.Errorf("retry %d: expected delay %s, got %s", i, expected, d)
+		}
+	}
+	// The bucket refills at 2 tokens per second.
+	now = now.Add(2 * time.Second)
+	if d := b.When("default/test"); d != 0 {
+		t.Errorf("expected no delay once refilled, got %s", d)
+	}
+
+	if d := newBucketRateLimiter(0, 0).When("default/test"); d != 0 {
+		t.Errorf("expected no overall limit with 0 qps, got %s", d)
+	}
+	if entry := defaultRetryBackoff(time.Second, 0); entry != "default=1s:16m40s," {
+		t.Errorf("unexpected default retry backoff %q", entry)
+	}
+}
+
+func TestEventLabelAnnotations(t *testing.T) {
+	job := newJob("test", int32Ptr(1))
+	job.Labels = map[string]string{"team": "search", "tier": "gold"}
+
+	annotations := eventLabelAnnotations(job, defaultEventLabelKeys)
+	if !reflect.DeepEqual(annotations, map[string]string{"team": "search"}) {
+		t.Errorf("expected only the team label, got %v", annotations)
+	}
+	if annotations := eventLabelAnnotations(job, nil); annotations != nil {
+		t.Errorf("expected no annotations without label keys, got %v", annotations)
+	}
+}
+
+func TestMetricFamilies(t *testing.T) {
+	m := newMetricFamilies()
+	pods := []string{
+		"# TYPE requests_total counter\nrequests_total{code=\"200\"} 3\nrequests_total{code=\"500\"} 1\nqueue_depth 2 1712345678\n",
+		"# TYPE requests_total counter\nrequests_total{code=\"200\"} 4\nqueue_depth 5\n",
+	}
+	for _, pod := range pods {
+		if err := m.add(strings.NewReader(pod)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	out := &bytes.Buffer{}
+	m.write(out)
+	expected := "queue_depth 7\n# TYPE requests_total counter\nrequests_total{code=\"200\"} 7\nrequests_total{code=\"500\"} 1\n"
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestControllerMetrics(t *testing.T) {
+	m := newControllerMetrics()
+	m.observeReconcile(reconcileSuccess, 20*time.Millisecond)
+	m.observeReconcile(reconcileError, 2*time.Second)
+	m.deploymentCreated()
+	m.deploymentUpdated()
+	m.deploymentUpdated()
+	m.observeStatusUpdate(errors.NewConflict(schema.GroupResource{Resource: "inferencejobs"}, "test", fmt.Errorf("modified")))
+	m.observeStatusUpdate(fmt.Errorf("unavailable"))
+	m.observeStatusUpdate(nil)
+	m.observeStaleCache([]string{"deployment/a/x", "deployment/b/y"})
+	out := &bytes.Buffer{}
+	m.write(out, map[string]int{"b": 1, "a": 2})
+	for _, expected := range []string{
+		"inferencejob_reconciles_total{result=\"success\"} 1\n",
+		"inferencejob_reconciles_total{result=\"error\"} 1\n",
+		"inferencejob_reconcile_duration_seconds_bucket{le=\"0.01\"} 0\n",
+		"inferencejob_reconcile_duration_seconds_bucket{le=\"0.025\"} 1\n",
+		"inferencejob_reconcile_duration_seconds_bucket{le=\"2.5\"} 2\n",
+		"inferencejob_reconcile_duration_seconds_bucket{le=\"+Inf\"} 2\n",
+		"inferencejob_reconcile_duration_seconds_sum 2.02\n",
+		"inferencejob_reconcile_duration_seconds_count 2\n",
+		"inferencejob_deployments_created_total 1\n",
+		"inferencejob_deployments_updated_total 2\n",
+		"inferencejob_status_update_conflicts_total 1\n",
+		"inferencejob_stale_cache_objects{resource=\"deployment\"} 2\n",
+		"inferencejob_stale_cache_objects{resource=\"inferencejob\"} 0\n",
+		"inferencejobs{namespace=\"a\"} 2\ninferencejobs{namespace=\"b\"} 1\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestPollWatch(t *testing.T) {
+	w, err := pollWatch(10 * time.Millisecond)(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Stop()
+	select {
+	case event := <-w.ResultChan():
+		if event.Type != watch.Error || !errors.IsResourceExpired(errors.FromObject(event.Object)) {
+			t.Errorf("expected the watch to expire, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected the watch to expire after the poll interval")
+	}
+}
+
+func TestModelFit(t *testing.T) {
+	accelerators, err := parseAcceleratorMemory("nvidia.com/gpu.product", "Tesla-T4=16Gi, A100=80Gi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	job := newJob("test", int32Ptr(1))
+	gpus, size := int64(1), int64(20*1024*1024*1024)
+	job.Spec.GPUs = &gpus
+	job.Spec.ModelSizeBytes = &size
+	job.Spec.NodeSelector = map[string]string{"nvidia.com/gpu.product": "Tesla-T4"}
+	if msg := accelerators.ModelFit(job); msg != "model of 20Gi does not fit the 16Gi of memory of 1 Tesla-T4 GPUs" {
+		t.Errorf("unexpected message %q", msg)
+	}
+	gpus = 2
+	if msg := accelerators.ModelFit(job); msg != "" {
+		t.Errorf("expected the model to fit 2 GPUs, got %q", msg)
+	}
+	job.Spec.NodeSelector["nvidia.com/gpu.product"] = "unknown"
+	gpus = 1
+	if msg := accelerators.ModelFit(job); msg != "" {
+		t.Errorf("expected unknown accelerators to be skipped, got %q", msg)
+	}
+	if _, err := parseAcceleratorMemory("nvidia.com/gpu.product", "Tesla-T4"); err == nil {
+		t.Errorf("expected an error for a missing memory size")
+	}
+}
+
+func TestRunCleanupHooks(t *testing.T) {
+	var posted []string
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var job samplecontroller.InferenceJob
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			t.Errorf("unexpected body: %v", err)
+		}
+		posted = append(posted, job.Name)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	now := metav1.Now()
+	job.DeletionTimestamp = &now
+	job.Finalizers = []string{CleanupFinalizer, "example.com/other"}
+	f.objects = append(f.objects, job)
+	c, _, _ := f.newController()
+	c.cleanupHooks = []cleanupHook{newWebhookCleanup(server.URL, time.Second)}
+
+	if err := c.runCleanupHooks(job); err == nil {
+		t.Error("expected an error while the cleanup webhook fails")
+	}
+	if len(filterInformerActions(f.client.Actions())) != 0 {
+		t.Errorf("expected the finalizer to be kept, got %+v", f.client.Actions())
+	}
+
+	status = http.StatusOK
+	// The removal of the finalizer is checked through the recorded action.
+	c.runCleanupHooks(job)
+	if len(posted) != 2 || posted[1] != "test" {
+		t.Errorf("expected the InferenceJob to be posted twice, got %v", posted)
+	}
+	actions := filterInformerActions(f.client.Actions())
+	if len(actions) != 1 {
+		t.Fatalf("expected 1 action, got %+v", actions)
+	}
+	updated := actions[0].(core.UpdateAction).GetObject().(*samplecontroller.InferenceJob)
+	if !reflect.DeepEqual(updated.Finalizers, []string{"example.com/other"}) {
+		t.Errorf("expected only %s to be removed, got %v", CleanupFinalizer, updated.Finalizers)
+	}
+}
+
+func TestScheduleReconcileRequeueInterval(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	job := newJob("test", int32Ptr(1))
+
+	// The reconcile policy takes precedence over the requeue interval.
+	c.requeueInterval = time.Millisecond
+	hour := int32(3600)
+	job.Spec.ReconcilePolicy = &samplecontroller.ReconcilePolicy{MaxIntervalSeconds: &hour}
+	c.scheduleReconcile("default/test", job, time.Now())
+	time.Sleep(10 * time.Millisecond)
+	if n := c.workqueue.Len(); n != 0 {
+		t.Fatalf("expected nothing queued before the max interval, got %d", n)
+	}
+
+	job.Spec.ReconcilePolicy = nil
+	c.scheduleReconcile("default/test", job, time.Now())
+	for deadline := time.Now().Add(time.Second); c.workqueue.Len() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the InferenceJob to be queued after the requeue interval")
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	renamed := job.DeepCopy()
+	renamed.Spec.DeploymentName = "test-old"
+	old := newDeployment(renamed)
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	f.deploymentLister = append(f.deploymentLister, old)
+	f.kubeobjects = append(f.kubeobjects, old)
+	c, _, _ := f.newController()
+	c.dryRun = true
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	if err := c.syncHandler(context.Background(), getKey(job, t)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actions := filterInformerActions(f.client.Actions()); len(actions) != 0 {
+		t.Errorf("expected no InferenceJob writes, got %+v", actions)
+	}
+	if actions := filterInformerActions(f.kubeclient.Actions()); len(actions) != 0 {
+		t.Errorf("expected no Deployment writes, got %+v", actions)
+	}
+	if event := <-recorder.Events; event != "Normal DryRun Would create deployment test-deployment, delete superseded deployment test-old" {
+		t.Errorf("unexpected event %q", event)
+	}
+}
+
+func TestRunDrainsWorkqueue(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- c.Run(ctx, 1)
+	}()
+
+	// Wait for the workers to start.
+	c.workqueue.Add("default/first")
+	for deadline := time.Now().Add(5 * time.Second); c.workqueue.Len() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the workers to start")
+		}
+	}
+
+	c.workqueue.Add("default/second")
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to return after the workqueue was drained")
+	}
+	if n := c.workqueue.Len(); n != 0 {
+		t.Errorf("expected the workqueue to be drained, %d items left", n)
+	}
+	if err := c.syncHandler(ctx, "default/second"); err != context.Canceled {
+		t.Errorf("expected a cancelled sync, got %v", err)
+	}
+}
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func TestMarkFailed(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.Generation = 2
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	c, _, _ := f.newController()
+	c.maxRetries = 3
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	c.markFailed(getKey(job, t), fmt.Errorf("boom"))
+	if event := <-recorder.Events; event != "Warning RetriesExhausted Gave up after 3 retries, waiting for a spec change: boom" {
+		t.Errorf("unexpected event %q", event)
+	}
+	actions := filterInformerActions(f.client.Actions())
+	if len(actions) != 1 {
+		t.Fatalf("expected a status update, got %+v", actions)
+	}
+	failed := actions[0].(core.UpdateAction).GetObject().(*samplecontroller.InferenceJob)
+	if cond := getCondition(failed.Status, samplecontroller.Failed); cond == nil || cond.Status != corev1.ConditionTrue || cond.Message != "boom" {
+		t.Errorf("expected the last error in the Failed condition, got %+v", cond)
+	}
+	if failed.Status.FailedGeneration != 2 || failed.Status.Phase != samplecontroller.PhaseFailed {
+		t.Errorf("expected generation 2 to have failed, got %+v", failed.Status)
+	}
+
+	// The failed generation isn't synced again.
+	f = newFixture(t)
+	f.jobLister = append(f.jobLister, failed)
+	f.objects = append(f.objects, failed)
+	c, _, _ = f.newController()
+	if err := c.syncHandler(context.Background(), getKey(failed, t)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actions := filterInformerActions(f.client.Actions()); len(actions) != 0 {
+		t.Errorf("expected the failed InferenceJob to be left alone, got %+v", actions)
+	}
+	if actions := filterInformerActions(f.kubeclient.Actions()); len(actions) != 0 {
+		t.Errorf("expected no Deployment writes, got %+v", actions)
+	}
+	failed.Generation = 3
+	if gaveUp(failed) {
+		t.Error("expected a spec change to resume syncing")
+	}
+}
+
+func TestTraceLine(t *testing.T) {
+	line := traceLine("default/test", "scale deployment", "name", "test-deployment", "from", int32(1), "to", int32(3), "error", fmt.Errorf("boom"), "dangling")
+	if expected := `trace inferenceJob="default/test" step="scale deployment" name="test-deployment" from=1 to=3 error="boom"`; line != expected {
+		t.Errorf("expected %s, got %s", expected, line)
+	}
+
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	job := newJob("test", int32Ptr(1))
+	if c.traced(job) {
+		t.Error("expected an InferenceJob without the annotation not to be traced")
+	}
+	job.Annotations = map[string]string{TraceAnnotation: "true"}
+	if !c.traced(job) {
+		t.Error("expected an annotated InferenceJob to be traced")
+	}
+	c.traceAll = true
+	if !c.traced(newJob("other", int32Ptr(1))) {
+		t.Error("expected --trace to trace every InferenceJob")
+	}
+}
+
+func TestDeploymentWritesPastDeadline(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	c, _, _ := f.newController()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	desired := newDeployment(job)
+	desired.Spec.Replicas = int32Ptr(3)
+	if _, err := c.patchDeployment(ctx, desired); err != context.Canceled {
+		t.Errorf("expected the patch not to be sent past the deadline, got %v", err)
+	}
+	if _, err := c.applyDeployment(ctx, desired); err != context.Canceled {
+		t.Errorf("expected the apply not to be sent past the deadline, got %v", err)
+	}
+	if actions := filterInformerActions(f.kubeclient.Actions()); len(actions) != 0 {
+		t.Errorf("expected no Deployment writes, got %+v", actions)
+	}
+}
+
+func TestTrimmedListWatch(t *testing.T) {
+	deployment := newDeployment(newJob("test", int32Ptr(1)))
+	deployment.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationUpdate}}
+	deployment.Annotations = map[string]string{
+		"kubectl.kubernetes.io/last-applied-configuration": `{"kind":"Deployment"}`,
+		TemplateHashAnnotation:                             "563d1f4c",
+		"deployment.kubernetes.io/revision":                "3",
+	}
+	deployment.Status.CollisionCount = int32Ptr(1)
+	deployment.Status.Conditions = []apps.DeploymentCondition{{
+		Type:           apps.DeploymentProgressing,
+		Status:         corev1.ConditionTrue,
+		Reason:         "NewReplicaSetAvailable",
+		LastUpdateTime: metav1.Now(),
+	}}
+	client := k8sfake.NewSimpleClientset(deployment)
+	lw := trimmedListWatch(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.AppsV1().Deployments(metav1.NamespaceAll).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.AppsV1().Deployments(metav1.NamespaceAll).Watch(options)
+		},
+	})
+	checkTrimmed := func(d *apps.Deployment) {
+		if len(d.ManagedFields) != 0 {
+			t.Errorf("expected the managed fields to be dropped, got %+v", d.ManagedFields)
+		}
+		if !reflect.DeepEqual(d.Annotations, map[string]string{TemplateHashAnnotation: "563d1f4c"}) {
+			t.Errorf("expected only the controller's annotation to be kept, got %v", d.Annotations)
+		}
+		if d.Status.CollisionCount != nil || !d.Status.Conditions[0].LastUpdateTime.IsZero() {
+			t.Errorf("expected the unread status fields to be dropped, got %+v", d.Status)
+		}
+		if d.Status.Conditions[0].Reason != "NewReplicaSetAvailable" || len(d.Spec.Template.Spec.Containers) == 0 {
+			t.Errorf("expected the conditions and template to be kept, got %+v", d)
+		}
+	}
+
+	list, err := lw.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkTrimmed(&list.(*apps.DeploymentList).Items[0])
+
+	w, err := lw.Watch(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer w.Stop()
+	updated := deployment.DeepCopy()
+	updated.Spec.Replicas = int32Ptr(2)
+	if _, err := client.AppsV1().Deployments(updated.Namespace).Update(updated); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case event := <-w.ResultChan():
+		checkTrimmed(event.Object.(*apps.Deployment))
+	case <-time.After(time.Second):
+		t.Errorf("expected the update to be watched")
+	}
+}
+
+func TestOwnedDeployments(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.UID = "uid"
+	controlled := newDeployment(job)
+	released := newDeployment(job)
+	released.Name = "test-released"
+	released.OwnerReferences = nil
+	released.Labels = map[string]string{InferenceJobUIDLabel: "uid"}
+	other := newDeployment(newJob("other", int32Ptr(1)))
+	other.Name = "other-deployment"
+	f.deploymentLister = append(f.deploymentLister, controlled, released, other)
+	c, _, _ := f.newController()
+
+	deployments, err := c.ownedDeployments(job)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, d := range deployments {
+		names = append(names, d.Name)
+	}
+	sort.Strings(names)
+	if expected := []string{controlled.Name, released.Name}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestInferenceJobChanged(t *testing.T) {
+	old := newJob("test", int32Ptr(1))
+	old.ResourceVersion = "1"
+	old.Generation = 1
+
+	statusOnly := old.DeepCopy()
+	statusOnly.ResourceVersion = "2"
+	statusOnly.Status.AvailableReplicas = 1
+	if inferenceJobChanged(old, statusOnly) {
+		t.Error("expected a status update not to call for a sync")
+	}
+	if !inferenceJobChanged(old, old.DeepCopy()) {
+		t.Error("expected a resync to call for a sync")
+	}
+
+	specChange := statusOnly.DeepCopy()
+	specChange.Generation = 2
+	if !inferenceJobChanged(old, specChange) {
+		t.Error("expected a spec change to call for a sync")
+	}
+	relabelled := statusOnly.DeepCopy()
+	relabelled.Labels = map[string]string{"team": "ml"}
+	if !inferenceJobChanged(old, relabelled) {
+		t.Error("expected a label change to call for a sync")
+	}
+
+	old.Annotations = map[string]string{PromoteAnnotation: "true"}
+	old.Spec.PostRolloutTest = &samplecontroller.PostRolloutTest{}
+	ready := old.DeepCopy()
+	ready.ResourceVersion = "2"
+	setCondition(&ready.Status, newCondition(samplecontroller.Ready, corev1.ConditionTrue, "", ""))
+	if !inferenceJobChanged(old, ready) {
+		t.Error("expected an InferenceJob waiting for promotion to sync once Ready")
+	}
+}
+
+func TestStatusChanged(t *testing.T) {
+	job := newJob("test", int32Ptr(1))
+	job.Status.AvailableReplicas = 1
+	job.Status.Resources = []samplecontroller.ResourceStatus{{Kind: "Deployment", Name: "test", LastSyncTime: metav1.Now()}}
+
+	resynced := job.DeepCopy()
+	now := metav1.NewTime(time.Now().Add(time.Minute))
+	resynced.Status.LastSyncTime = &now
+	resynced.Status.Resources[0].LastSyncTime = now
+	if statusChanged(job.Status, resynced.Status) {
+		t.Error("expected renewed sync times not to change the status")
+	}
+	if job.Status.Resources[0].LastSyncTime.IsZero() {
+		t.Error("expected the compared statuses to be left alone")
+	}
+
+	scaled := resynced.DeepCopy()
+	scaled.Status.AvailableReplicas = 2
+	if !statusChanged(job.Status, scaled.Status) {
+		t.Error("expected new available replicas to change the status")
+	}
+}
+
+func TestObserveDeletedInferenceJob(t *testing.T) {
+	for _, finalizer := range []string{CleanupFinalizer, RetainFinalizer, "example.com/other"} {
+		f := newFixture(t)
+		job := newJob("test", int32Ptr(1))
+		now := metav1.Now()
+		job.DeletionTimestamp = &now
+		job.Finalizers = []string{finalizer}
+		d := newDeployment(job)
+		f.jobLister = append(f.jobLister, job)
+		f.objects = append(f.objects, job)
+		f.deploymentLister = append(f.deploymentLister, d)
+		f.kubeobjects = append(f.kubeobjects, d)
+		c, _, _ := f.newController()
+		c.observeOnly = true
+		c.cleanupHooks = []cleanupHook{newWebhookCleanup("http://127.0.0.1:0", time.Second)}
+
+		if err := c.syncHandler(context.Background(), getKey(job, t)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", finalizer, err)
+		}
+		if actions := filterInformerActions(f.client.Actions()); len(actions) != 0 {
+			t.Errorf("%s: expected no InferenceJob writes, got %+v", finalizer, actions)
+		}
+		if actions := filterInformerActions(f.kubeclient.Actions()); len(actions) != 0 {
+			t.Errorf("%s: expected no Deployment writes, got %+v", finalizer, actions)
+		}
+	}
+}
+
+func TestObserveInferenceJobSkipsUnchangedStatus(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	f.deploymentLister = append(f.deploymentLister, newDeployment(job))
+	f.objects = append(f.objects, job)
+	c, _, _ := f.newController()
+	c.observeOnly = true
+
+	if err := c.observeInferenceJob(job, job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	actions := filterInformerActions(f.client.Actions())
+	if len(actions) != 1 || !actions[0].Matches("update", "inferencejobs") {
+		t.Fatalf("expected the status to be written, got %+v", actions)
+	}
+	observed := actions[0].(core.UpdateAction).GetObject().(*samplecontroller.InferenceJob)
+	if cond := getCondition(observed.Status, samplecontroller.PendingChanges); cond == nil || cond.Status != corev1.ConditionFalse {
+		t.Errorf("expected no pending changes, got %+v", observed.Status.Conditions)
+	}
+
+	f.client.ClearActions()
+	if err := c.observeInferenceJob(observed, observed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actions := filterInformerActions(f.client.Actions()); len(actions) != 0 {
+		t.Errorf("expected the unchanged status not to be written, got %+v", actions)
+	}
+}
+
+func TestZoneSurge(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	job.Spec.MinReplicasPerZone = int32Ptr(2)
+	d := newDeployment(job)
+	node := func(name, zone string, ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{zoneLabel: zone}},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}}},
+		}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-a", Namespace: job.Namespace, Labels: d.Spec.Selector.MatchLabels},
+		Spec:       corev1.PodSpec{NodeName: "node-a"},
+	}
+	f.kubeobjects = append(f.kubeobjects, pod)
+	c, _, k8sI := f.newController()
+	recorder := record.NewFakeRecorder(10)
+	c.recorder = recorder
+
+	// Without access to nodes, no replicas are added.
+	if surge, err := c.zoneSurge(job, d); err != nil || surge != 0 {
+		t.Errorf("expected no surge without nodes, got %d, %v", surge, err)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, ErrZoneCheckUnavailable) {
+			t.Errorf("expected a %s event, got %q", ErrZoneCheckUnavailable, event)
+		}
+	default:
+		t.Errorf("expected a %s event", ErrZoneCheckUnavailable)
+	}
+
+	nodes := k8sI.Core().V1().Nodes()
+	c.watchNodes(nodes)
+	nodes.Informer().GetIndexer().Add(node("node-a", "a", corev1.ConditionTrue))
+	nodes.Informer().GetIndexer().Add(node("node-b", "b", corev1.ConditionFalse))
+	nodes.Informer().GetIndexer().Add(node("node-c", "c", corev1.ConditionTrue))
+	// Zone b is out: zone a is short of one replica and zone c of two.
+	if surge, err := c.zoneSurge(job, d); err != nil || surge != 3 {
+		t.Errorf("expected a surge of 3, got %d, %v", surge, err)
+	}
+
+	// The surged replicas have no pods yet, they don't add to the surge.
+	surged := job.DeepCopy()
+	surged.Status.ZoneSurge = 3
+	d.Spec.Replicas = int32Ptr(4)
+	if surge, err := c.zoneSurge(surged, d); err != nil || surge != 3 {
+		t.Errorf("expected the surge to stay 3 before the pods are created, got %d, %v", surge, err)
+	}
+	// Nor do they once scheduled to a zone already meeting the minimum.
+	for _, name := range []string{"test-b", "test-c", "test-d"} {
+		extra := pod.DeepCopy()
+		extra.Name = name
+		if _, err := f.kubeclient.CoreV1().Pods(job.Namespace).Create(extra); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if surge, err := c.zoneSurge(surged, d); err != nil || surge != 3 {
+		t.Errorf("expected the surge to stay 3 with the pods in zone a, got %d, %v", surge, err)
+	}
+	// The surge never exceeds the minimum of every available zone.
+	surged.Status.ZoneSurge = 10
+	if surge, err := c.zoneSurge(surged, d); err != nil || surge != 4 {
+		t.Errorf("expected the surge to be capped at 4, got %d, %v", surge, err)
+	}
+
+	nodes.Informer().GetIndexer().Update(node("node-b", "b", corev1.ConditionTrue))
+	if surge, err := c.zoneSurge(job, d); err != nil || surge != 0 {
+		t.Errorf("expected no surge once every zone is back, got %d, %v", surge, err)
+	}
+	for _, action := range f.kubeclient.Actions() {
+		if action.GetResource().Resource == "nodes" {
+			t.Errorf("expected nodes to be read from the cache, got %+v", action)
+		}
+	}
+}
+
+func TestSyncTimeStale(t *testing.T) {
+	now := time.Now()
+	var status samplecontroller.InferenceJobStatus
+	if !syncTimeStale(status, now) {
+		t.Error("expected a status never synced to be stale")
+	}
+	recent := metav1.NewTime(now.Add(-time.Minute))
+	status.LastSyncTime = &recent
+	if syncTimeStale(status, now) {
+		t.Error("expected a sync a minute ago not to be stale")
+	}
+	old := metav1.NewTime(now.Add(-lastSyncRefresh))
+	status.LastSyncTime = &old
+	if !syncTimeStale(status, now) {
+		t.Errorf("expected a sync %s ago to be stale", lastSyncRefresh)
+	}
+}
+
+func TestPriorityQueue(t *testing.T) {
+	priorities := map[string]int32{"default/prod": 10, "default/experiment": -1}
+	q := newPriorityQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond), func(item interface{}) int32 {
+		return priorities[item.(string)]
+	})
+	for _, key := range []string{"default/experiment", "default/first", "default/prod", "default/second", "default/first"} {
+		q.Add(key)
+	}
+	if n := q.Len(); n != 4 {
+		t.Fatalf("expected an item to be queued once, got %d items", n)
+	}
+	var order []string
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		order = append(order, item.(string))
+	}
+	if expected := []string{"default/prod", "default/first", "default/second", "default/experiment"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected %v, got %v", expected, order)
+	}
+
+	// An item added while being processed is queued again once done.
+	q.Add("default/prod")
+	if n := q.Len(); n != 0 {
+		t.Errorf("expected an item being processed not to be queued, got %d items", n)
+	}
+	for _, item := range order {
+		q.Done(item)
+	}
+	if n := q.Len(); n != 1 {
+		t.Errorf("expected the item to be queued again once done, got %d items", n)
+	}
+	q.Get()
+	q.Done("default/prod")
+
+	q.AddRateLimited("default/prod")
+	if q.NumRequeues("default/prod") != 1 {
+		t.Errorf("expected the retry to be counted")
+	}
+	item, _ := q.Get()
+	if item != "default/prod" {
+		t.Errorf("expected the delayed item, got %v", item)
+	}
+	q.Done(item)
+
+	q.AddAfter("default/prod", time.Hour)
+	q.ShutDown()
+	if _, shutdown := q.Get(); !shutdown {
+		t.Error("expected the waiting item to be dropped on shutdown")
+	}
+}
+
+func TestEnqueueInferenceJobAfter(t *testing.T) {
+	f := newFixture(t)
+	c, _, _ := f.newController()
+	job := newJob("test", int32Ptr(1))
+	for i := 0; i < 3; i++ {
+		c.enqueueInferenceJobAfter(job, 50*time.Millisecond)
+	}
+	if n := c.workqueue.Len(); n != 0 {
+		t.Errorf("expected the sync to wait for the settle window, got %d items", n)
+	}
+	for deadline := time.Now().Add(5 * time.Second); c.workqueue.Len() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the InferenceJob to be queued after the settle window")
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := c.workqueue.Len(); n != 1 {
+		t.Errorf("expected the burst to be synced once, got %d items", n)
+	}
+}
+
+func TestListInPages(t *testing.T) {
+	pages := map[string]*apps.DeploymentList{
+		"": {
+			ListMeta: metav1.ListMeta{ResourceVersion: "10", Continue: "2"},
+			Items:    []apps.Deployment{*newDeployment(newJob("first", int32Ptr(1)))},
+		},
+		"2": {
+			ListMeta: metav1.ListMeta{ResourceVersion: "10"},
+			Items:    []apps.Deployment{*newDeployment(newJob("second", int32Ptr(1)))},
+		},
+	}
+	expired := false
+	list := func(options metav1.ListOptions) (runtime.Object, error) {
+		if options.ResourceVersion != "" {
+			t.Errorf("expected the pages to be read from etcd, got resourceVersion %q", options.ResourceVersion)
+		}
+		if expired && options.Continue != "" {
+			return nil, errors.NewResourceExpired("continue token expired")
+		}
+		if options.Limit == 0 {
+			return &apps.DeploymentList{Items: append(pages[""].Items, pages["2"].Items...)}, nil
+		}
+		if options.Limit != 1 {
+			t.Errorf("expected pages of 1, got %d", options.Limit)
+		}
+		return pages[options.Continue].DeepCopy(), nil
+	}
+
+	for _, expired = range []bool{false, true} {
+		obj, err := listInPages(list, metav1.ListOptions{ResourceVersion: "0", Limit: 500}, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		deployments := obj.(*apps.DeploymentList)
+		if len(deployments.Items) != 2 || deployments.Items[0].Name != "first-deployment" || deployments.Items[1].Name != "second-deployment" {
+			t.Errorf("expected the items of every page, got %+v", deployments.Items)
+		}
+		if deployments.Continue != "" {
+			t.Errorf("expected a complete list, got continue %q", deployments.Continue)
+		}
+	}
+}
+
+func TestCreationExpectations(t *testing.T) {
+	f := newFixture(t)
+	job := newJob("test", int32Ptr(1))
+	f.jobLister = append(f.jobLister, job)
+	f.objects = append(f.objects, job)
+	c, _, _ := f.newController()
+
+	// The status update fails against the fake clientset, only the
+	// Deployment writes matter here.
+	c.syncHandler(context.Background(), getKey(job, t))
+	created := len(filterInformerActions(f.kubeclient.Actions()))
+	if created == 0 {
+		t.Fatal("expected the deployment to be created")
+	}
+	c.syncHandler(context.Background(), getKey(job, t))
+	if actions := filterInformerActions(f.kubeclient.Actions()); len(actions) != created {
+		t.Errorf("expected no second create before the informer reports the deployment, got %+v", actions[created:])
+	}
+
+	c.creations.observe(newDeployment(job))
+	if c.creations.pending(job.Namespace + "/" + job.Spec.DeploymentName) {
+		t.Error("expected the reported deployment to satisfy the expectation")
+	}
+}
+
+func TestShards(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	old := newShards(client, "default", "old", 0, 1)
+	old.renew()
+	if !old.owns("default/test") {
+		t.Fatal("expected the only shard to own every key")
+	}
+	standby := newShards(client, "default", "standby", 0, 1)
+	standby.renew()
+	if standby.owns("default/test") {
+		t.Error("expected a second replica of the shard to stand by")
+	}
+
+	// Scale to two shards: the old shard keeps its keys until it's gone.
+	index := shardOf("default/test", 2)
+	scaled := newShards(client, "default", "scaled", index, 2)
+	changed := false
+	scaled.onChange = func() { changed = true }
+	scaled.renew()
+	if scaled.owns("default/test") {
+		t.Error("expected the key to stay with the shard holding its lease first")
+	}
+	if !old.owns("default/test") {
+		t.Error("expected the old shard to keep its keys during the rollout")
+	}
+	old.release()
+	changed = false
+	scaled.renew()
+	if !scaled.owns("default/test") {
+		t.Error("expected the key to be handed over once the old shard released its lease")
+	}
+	if !changed {
+		t.Error("expected the handover to requeue the keys of the shard")
+	}
+	other := newShards(client, "default", "other", 1-index, 2)
+	other.renew()
+	if other.owns("default/test") {
+		t.Error("expected a key to belong to a single shard")
+	}
+}
+
+func TestShardsPrimary(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	run := func(s *shards) chan (<-chan struct{}) {
+		started := make(chan (<-chan struct{}), 2)
+		s.runPrimary(stopCh, func(stopCh <-chan struct{}) { started <- stopCh })
+		return started
+	}
+	expectStarted := func(started chan (<-chan struct{}), name string) <-chan struct{} {
+		select {
+		case workStop := <-started:
+			return workStop
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("expected the primary work of %s to start", name)
+			return nil
+		}
+	}
+	expectNotStarted := func(started chan (<-chan struct{}), name string) {
+		select {
+		case <-started:
+			t.Errorf("expected the primary work of %s not to start", name)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	first := newShards(client, "default", "first", 0, 1)
+	firstStarted := run(first)
+	expectNotStarted(firstStarted, "the shard before it holds its lease")
+	first.renew()
+	if !first.primary() {
+		t.Fatal("expected the first shard holding its lease to be primary")
+	}
+	firstStop := expectStarted(firstStarted, "the first shard")
+
+	standby := newShards(client, "default", "standby", 0, 1)
+	standbyStarted := run(standby)
+	standby.renew()
+	if standby.primary() {
+		t.Error("expected a standby replica of the first shard not to be primary")
+	}
+	expectNotStarted(standbyStarted, "the standby replica")
+
+	second := newShards(client, "default", "second", 1, 2)
+	secondStarted := run(second)
+	second.renew()
+	if second.primary() {
+		t.Error("expected the second shard not to be primary")
+	}
+	expectNotStarted(secondStarted, "the second shard")
+
+	first.release()
+	select {
+	case <-firstStop:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("expected the primary work to stop once the lease is released")
+	}
+	standby.renew()
+	if !standby.primary() {
+		t.Fatal("expected the standby replica to take over")
+	}
+	expectStarted(standbyStarted, "the standby replica")
+
+	var unsharded *shards
+	if !unsharded.primary() {
+		t.Error("expected an unsharded controller to be primary")
+	}
+	expectStarted(run(unsharded), "an unsharded controller")
+}
+
+func newJobSet(name string, members ...string) *samplecontroller.InferenceJobSet {
+	set := &samplecontroller.InferenceJobSet{
+		TypeMeta:   metav1.TypeMeta{APIVersion: samplecontroller.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault, UID: types.UID(name)},
+		Spec: samplecontroller.InferenceJobSetSpec{
+			Defaults: samplecontroller.InferenceJobSpec{Replicas: int32Ptr(1), ImageToDeploy: "model-server:v1"},
+		},
+	}
+	for _, member := range members {
+		set.Spec.Jobs = append(set.Spec.Jobs, samplecontroller.InferenceJobSetMember{Name: member})
+	}
+	return set
+}
+
+// newSetMember returns the InferenceJob of the member of the set, ready if
+// its replicas are available.
+func newSetMember(t *testing.T, set *samplecontroller.InferenceJobSet, member int, ready bool) *samplecontroller.InferenceJob {
+	job, err := newSetInferenceJob(set, set.Spec.Jobs[member])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ready {
+		job.Status.AvailableReplicas = *job.Spec.Replicas
+	}
+	return job
+}
+
+// runJobSet syncs the set with the given InferenceJobs and returns the
+// writes made.
+func runJobSet(t *testing.T, set *samplecontroller.InferenceJobSet, jobs ...*samplecontroller.InferenceJob) []core.Action {
+	objects := []runtime.Object{set}
+	for _, job := range jobs {
+		objects = append(objects, job)
+	}
+	client := fake.NewSimpleClientset(objects...)
+	i := informers.NewSharedInformerFactory(client, noResyncPeriodFunc())
+	c := NewJobSetController(client, &record.FakeRecorder{},
+		i.Samplecontroller().V1alpha1().InferenceJobs(), i.Samplecontroller().V1alpha1().InferenceJobSets())
+	i.Samplecontroller().V1alpha1().InferenceJobSets().Informer().GetIndexer().Add(set)
+	for _, job := range jobs {
+		i.Samplecontroller().V1alpha1().InferenceJobs().Informer().GetIndexer().Add(job)
+	}
+	if err := c.syncHandler(set.Namespace + "/" + set.Name); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return filterInformerActions(client.Actions())
+}
+
+func TestJobSetCreatesMembersInOrder(t *testing.T) {
+	set := newJobSet("recommender", "embeddings", "ranker")
+	embeddings := newSetMember(t, set, 0, false)
+	gvr := samplecontroller.SchemeGroupVersion.WithResource("inferencejobs")
+
+	// Only the first member is created.
+	actions := runJobSet(t, set)
+	expected := []core.Action{core.NewCreateAction(gvr, set.Namespace, embeddings)}
+	if len(actions) != len(expected) {
+		t.Fatalf("expected %d actions, got %+v", len(expected), actions)
+	}
+	checkAction(expected[0], actions[0], t)
+
+	// The second member waits for the first to be ready.
+	if actions := runJobSet(t, set, embeddings); len(actions) != 0 {
+		t.Errorf("expected no writes while the first member isn't ready, got %+v", actions)
+	}
+
+	// The first member is ready, the second one is created and counted.
+	ready := newSetMember(t, set, 0, true)
+	actions = runJobSet(t, set, ready)
+	if len(actions) != 2 {
+		t.Fatalf("expected 2 actions, got %+v", actions)
+	}
+	checkAction(core.NewCreateAction(gvr, set.Namespace, newSetMember(t, set, 1, false)), actions[0], t)
+	updated := set.DeepCopy()
+	updated.Status.ReadyJobs = 1
+	checkAction(core.NewUpdateAction(samplecontroller.SchemeGroupVersion.WithResource("inferencejobsets"), set.Namespace, updated), actions[1], t)
+}
+
+func TestJobSetUpdatesDriftedMember(t *testing.T) {
+	set := newJobSet("recommender", "embeddings")
+	job := newSetMember(t, set, 0, true)
+	job.Spec.ImageToDeploy = "model-server:v0"
+	job.Annotations = map[string]string{HibernatedReplicasAnnotation: "1"}
+
+	actions := runJobSet(t, set, job)
+	if len(actions) != 1 {
+		t.Fatalf("expected 1 action, got %+v", actions)
+	}
+	// Only the spec is reverted, the annotations are kept.
+	expected := job.DeepCopy()
+	expected.Spec = newSetMember(t, set, 0, false).Spec
+	checkAction(core.NewUpdateAction(samplecontroller.SchemeGroupVersion.WithResource("inferencejobs"), set.Namespace, expected), actions[0], t)
+}
+
+func TestJobSetDeletesRemovedMembers(t *testing.T) {
+	set := newJobSet("recommender", "embeddings", "ranker")
+	embeddings := newSetMember(t, set, 0, true)
+	ranker := newSetMember(t, set, 1, true)
+	// Another set's InferenceJob of the same label isn't touched.
+	foreign := newSetMember(t, newJobSet("other", "ranker"), 0, true)
+	foreign.Name = "recommender-legacy"
+	foreign.Labels[JobSetLabel] = set.Name
+	set.Spec.Jobs = set.Spec.Jobs[:1]
+
+	actions := runJobSet(t, set, embeddings, ranker, foreign)
+	if len(actions) != 2 {
+		t.Fatalf("expected 2 actions, got %+v", actions)
+	}
+	if !actions[0].Matches("delete", "inferencejobs") || actions[0].(core.DeleteAction).GetName() != ranker.Name {
+		t.Errorf("expected %s to be deleted, got %+v", ranker.Name, actions[0])
+	}
+	updated := set.DeepCopy()
+	updated.Status.ReadyJobs = 1
+	updated.Status.Ready = true
+	checkAction(core.NewUpdateAction(samplecontroller.SchemeGroupVersion.WithResource("inferencejobsets"), set.Namespace, updated), actions[1], t)
+}
+
+func TestMergeInferenceJobSpec(t *testing.T) {
+	defaults := samplecontroller.InferenceJobSpec{Replicas: int32Ptr(2), ImageToDeploy: "model-server:v1", DedicatedNodes: true, Priority: 10}
+	override := samplecontroller.InferenceJobSpec{ImageToDeploy: "model-server:v2"}
+
+	merged, err := mergeInferenceJobSpec(defaults, override, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := defaults
+	expected.ImageToDeploy = "model-server:v2"
+	if !reflect.DeepEqual(*merged, expected) {
+		t.Errorf("expected %+v, got %+v", expected, *merged)
+	}
+
+	// Empty values can only override defaults through clear.
+	merged, err = mergeInferenceJobSpec(defaults, override, []string{"dedicatedNodes", "priority"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected.DedicatedNodes = false
+	expected.Priority = 0
+	if !reflect.DeepEqual(*merged, expected) {
+		t.Errorf("expected %+v, got %+v", expected, *merged)
+	}
+
+	if _, err := mergeInferenceJobSpec(defaults, override, []string{"dedicated"}); err == nil {
+		t.Errorf("expected an error for an unknown field")
+	}
+}
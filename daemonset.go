@@ -0,0 +1,169 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// workloadType returns the workload type of the InferenceJob, defaulting
+// to Deployment.
+func workloadType(inferenceJob *samplev1alpha1.InferenceJob) samplev1alpha1.WorkloadType {
+	if inferenceJob.Spec.WorkloadType == "" {
+		return samplev1alpha1.WorkloadTypeDeployment
+	}
+	return inferenceJob.Spec.WorkloadType
+}
+
+// newDaemonSet renders the DaemonSet of an InferenceJob with
+// spec.workloadType DaemonSet. Its pods are the ones newDeployment renders,
+// one per node matching the node selector and affinity of the InferenceJob.
+func newDaemonSet(inferenceJob *samplev1alpha1.InferenceJob) *appsv1.DaemonSet {
+	deployment := newDeployment(inferenceJob)
+	return &appsv1.DaemonSet{
+		ObjectMeta: deployment.ObjectMeta,
+		Spec: appsv1.DaemonSetSpec{
+			Selector:             deployment.Spec.Selector,
+			Template:             deployment.Spec.Template,
+			RevisionHistoryLimit: deployment.Spec.RevisionHistoryLimit,
+		},
+	}
+}
+
+// syncDaemonSet reconciles the DaemonSet of an InferenceJob with
+// spec.workloadType DaemonSet, in place of its Deployment. The number of
+// pods follows the nodes, spec.replicas isn't reconciled.
+func (c *Controller) syncDaemonSet(key string, inferenceJob, named *samplev1alpha1.InferenceJob) error {
+	desired := newDaemonSet(named)
+	daemonSets := c.kubeclientset.AppsV1().DaemonSets(desired.Namespace)
+	daemonSet, err := daemonSets.Get(desired.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		daemonSet, err = c.writeDaemonSet(desired, daemonSets.Create)
+	}
+	if err == errWriteThrottled {
+		c.workqueue.AddAfter(key, writeThrottleRetry)
+		return nil
+	}
+	if err != nil {
+		c.recordResourceError(inferenceJob, "DaemonSet", desired.Name, err)
+		return err
+	}
+	if !metav1.IsControlledBy(daemonSet, inferenceJob) {
+		msg := fmt.Sprintf(MessageResourceExists, daemonSet.Name)
+		c.recorder.Event(inferenceJob, corev1.EventTypeWarning, ErrResourceExists, msg)
+		return fmt.Errorf(msg)
+	}
+
+	if daemonSetDrifted(inferenceJob, desired, daemonSet) {
+		klog.V(4).Infof("InferenceJob %s pod template has drifted from daemonset %s", inferenceJob.Name, daemonSet.Name)
+		// The selector of a DaemonSet is immutable, only the pod template
+		// and update settings are updated.
+		daemonSetCopy := daemonSet.DeepCopy()
+		daemonSetCopy.Labels = desired.Labels
+		daemonSetCopy.Annotations = desired.Annotations
+		daemonSetCopy.Spec.Template = desired.Spec.Template
+		daemonSetCopy.Spec.RevisionHistoryLimit = desired.Spec.RevisionHistoryLimit
+		daemonSet, err = c.writeDaemonSet(daemonSetCopy, daemonSets.Update)
+	}
+	if err == errWriteThrottled {
+		c.workqueue.AddAfter(key, writeThrottleRetry)
+		return nil
+	}
+	if err != nil {
+		c.recordResourceError(inferenceJob, "DaemonSet", desired.Name, err)
+		return err
+	}
+
+	// The Deployments or StatefulSet the InferenceJob ran in before are
+	// replaced.
+	if err := c.deleteControlledDeployments(inferenceJob); err != nil {
+		return err
+	}
+	if err := c.deleteWorkloads(inferenceJob, "StatefulSet", "Service"); err != nil {
+		return err
+	}
+	// DaemonSets aren't watched by the controller, poll until every
+	// scheduled pod is ready.
+	if daemonSet.Status.NumberReady != daemonSet.Status.DesiredNumberScheduled {
+		c.workqueue.AddAfter(key, statefulSetPollInterval)
+	}
+
+	if err := c.updateDaemonSetStatus(inferenceJob, daemonSet); err != nil {
+		return err
+	}
+	c.scheduleReconcile(key, inferenceJob, time.Now())
+	c.recorder.Event(inferenceJob, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	return nil
+}
+
+// daemonSetDrifted reports whether the pod template of the DaemonSet
+// differs from the desired one.
+func daemonSetDrifted(inferenceJob *samplev1alpha1.InferenceJob, desired, existing *appsv1.DaemonSet) bool {
+	if desired.Annotations[TemplateHashAnnotation] != existing.Annotations[TemplateHashAnnotation] {
+		return true
+	}
+	return driftCorrection(inferenceJob) && !equality.Semantic.DeepDerivative(desired.Spec.Template, existing.Spec.Template)
+}
+
+// writeDaemonSet creates or updates the DaemonSet holding a write slot of
+// its namespace.
+func (c *Controller) writeDaemonSet(daemonSet *appsv1.DaemonSet, write func(*appsv1.DaemonSet) (*appsv1.DaemonSet, error)) (*appsv1.DaemonSet, error) {
+	release, ok := c.deploymentWrites.tryAcquire(daemonSet.Namespace)
+	if !ok {
+		return nil, errWriteThrottled
+	}
+	defer release()
+	return write(daemonSet)
+}
+
+// updateDaemonSetStatus updates the status of an InferenceJob running in a
+// DaemonSet. The nodes running a ready pod are also reported as available
+// replicas.
+func (c *Controller) updateDaemonSetStatus(inferenceJob *samplev1alpha1.InferenceJob, daemonSet *appsv1.DaemonSet) error {
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	inferenceJobCopy.Status.Replicas = daemonSet.Status.DesiredNumberScheduled
+	inferenceJobCopy.Status.AvailableReplicas = daemonSet.Status.NumberReady
+	inferenceJobCopy.Status.ReadyReplicas = daemonSet.Status.NumberReady
+	inferenceJobCopy.Status.UpdatedReplicas = daemonSet.Status.UpdatedNumberScheduled
+	inferenceJobCopy.Status.UnavailableReplicas = daemonSet.Status.NumberUnavailable
+	inferenceJobCopy.Status.NumberReady = daemonSet.Status.NumberReady
+	inferenceJobCopy.Status.LabelSelector = metav1.FormatLabelSelector(daemonSet.Spec.Selector)
+	inferenceJobCopy.Status.DeploymentGeneration = 0
+	inferenceJobCopy.Status.DeploymentName = ""
+	inferenceJobCopy.Status.TemplateHash = daemonSet.Annotations[TemplateHashAnnotation]
+	inferenceJobCopy.Status.Address = ""
+	inferenceJobCopy.Status.URL = ""
+	inferenceJobCopy.Status.PendingScaleDown = nil
+	inferenceJobCopy.Status.ZoneSurge = 0
+	inferenceJobCopy.Status.PostRolloutTest = nil
+	inferenceJobCopy.Status.Resources = []samplev1alpha1.ResourceStatus{
+		{Kind: "DaemonSet", Name: daemonSet.Name, LastAppliedHash: daemonSet.Annotations[TemplateHashAnnotation], LastSyncTime: metav1.Now()},
+	}
+	setReplicaConditions(&inferenceJobCopy.Status, daemonSet.Status.NumberReady, daemonSet.Status.DesiredNumberScheduled)
+	return c.writeInferenceJobStatus(inferenceJob, inferenceJobCopy)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog"
+)
+
+// defaultEventLabelKeys are the labels of InferenceJobs copied onto their
+// Events unless --event-label-keys is set.
+var defaultEventLabelKeys = []string{"team", "app"}
+
+// eventLabelAnnotations returns the labels of object among keys, which are
+// attached to its Events as annotations so event pipelines can route them to
+// the owning team.
+func eventLabelAnnotations(object runtime.Object, keys []string) map[string]string {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return nil
+	}
+	var annotations map[string]string
+	for _, key := range keys {
+		if value, ok := accessor.GetLabels()[key]; ok {
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
+
+// logEvent logs an Event like record.EventBroadcaster.StartLogging, with its
+// annotations appended as key=value fields.
+func logEvent(e *corev1.Event) {
+	keys := make([]string, 0, len(e.Annotations))
+	for key := range e.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf(" %s=%q", key, e.Annotations[key]))
+	}
+	klog.Infof("Event(%#v): type: '%v' reason: '%v' %v%s", e.InvolvedObject, e.Type, e.Reason, e.Message, strings.Join(fields, ""))
+}
+
+// setEventLabelKeys sets the labels of InferenceJobs copied onto their
+// Events.
+func (c *Controller) setEventLabelKeys(keys []string) {
+	if r, ok := c.recorder.(*templatingRecorder); ok {
+		r.labelKeys = keys
+	}
+}
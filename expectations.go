@@ -0,0 +1,77 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// creationTimeout is how long a created Deployment is waited for before it
+// is created again, in case its watch event was missed.
+const creationTimeout = 5 * time.Minute
+
+// creationExpectations tracks the Deployments created but not yet seen by
+// the informer, like the expectations of the ReplicaSet controller. A sync
+// running before the informer caught up would otherwise create them again.
+type creationExpectations struct {
+	mu      sync.Mutex
+	created map[string]time.Time
+}
+
+func newCreationExpectations() *creationExpectations {
+	return &creationExpectations{created: map[string]time.Time{}}
+}
+
+// expect records the creation of the Deployment with the given
+// namespace/name key.
+func (e *creationExpectations) expect(key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.created[key] = time.Now()
+}
+
+// observe drops the expectation of a Deployment reported by the informer.
+func (e *creationExpectations) observe(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.created, key)
+}
+
+// pending returns whether the Deployment with the given key was created
+// less than creationTimeout ago and the informer hasn't reported it yet.
+func (e *creationExpectations) pending(key string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	created, ok := e.created[key]
+	if !ok {
+		return false
+	}
+	if time.Since(created) > creationTimeout {
+		delete(e.created, key)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// policyFailureFail denies Deployments the external policy endpoint
+	// couldn't review.
+	policyFailureFail = "Fail"
+	// policyFailureIgnore deploys Deployments the external policy endpoint
+	// couldn't review.
+	policyFailureIgnore = "Ignore"
+
+	// ErrPolicyDenied is used as part of the Event 'reason' when the
+	// external policy endpoint denies the Deployment of a InferenceJob.
+	ErrPolicyDenied = "PolicyDenied"
+	// MessagePolicyDenied is the message used for Events when the external
+	// policy endpoint denies the Deployment of a InferenceJob.
+	MessagePolicyDenied = "Deployment %q denied by external policy: %s"
+	// MessagePolicyUnavailable is the message used for Events when the
+	// external policy endpoint fails and the failure policy is Fail.
+	MessagePolicyUnavailable = "Deployment %q not reviewed by external policy: %s"
+)
+
+// policyReview is posted to the external policy endpoint with the Deployment
+// rendered for a InferenceJob.
+type policyReview struct {
+	InferenceJob policyReviewSubject `json:"inferenceJob"`
+	Deployment   *appsv1.Deployment  `json:"deployment"`
+}
+
+type policyReviewSubject struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
+}
+
+// policyDecision is the response of the external policy endpoint.
+type policyDecision struct {
+	Allowed bool `json:"allowed"`
+	// Message explains a denial.
+	Message string `json:"message,omitempty"`
+}
+
+type cachedDecision struct {
+	hash     string
+	decision policyDecision
+	expires  time.Time
+}
+
+// externalPolicy reviews rendered Deployments with an external HTTP policy
+// endpoint, e.g. a model governance service. Decisions are cached per
+// InferenceJob for as long as the rendered Deployment doesn't change.
+type externalPolicy struct {
+	url string
+	// failurePolicy is policyFailureFail or policyFailureIgnore.
+	failurePolicy string
+	ttl           time.Duration
+	client        *http.Client
+
+	mu        sync.Mutex
+	decisions map[string]cachedDecision
+}
+
+func newExternalPolicy(url, failurePolicy string, timeout, ttl time.Duration) *externalPolicy {
+	return &externalPolicy{
+		url:           url,
+		failurePolicy: failurePolicy,
+		ttl:           ttl,
+		client:        &http.Client{Timeout: timeout},
+		decisions:     map[string]cachedDecision{},
+	}
+}
+
+// review returns the decision of the endpoint on the Deployment rendered for
+// the InferenceJob, from the cache if it was reviewed before.
+func (p *externalPolicy) review(inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment) (policyDecision, error) {
+	body, err := json.Marshal(policyReview{
+		InferenceJob: policyReviewSubject{Namespace: inferenceJob.Namespace, Name: inferenceJob.Name, UID: inferenceJob.UID},
+		Deployment:   deployment,
+	})
+	if err != nil {
+		return policyDecision{}, err
+	}
+	h := fnv.New32a()
+	h.Write(body)
+	hash := fmt.Sprintf("%08x", h.Sum32())
+	key := inferenceJob.Namespace + "/" + inferenceJob.Name
+
+	p.mu.Lock()
+	cached, ok := p.decisions[key]
+	p.mu.Unlock()
+	if ok && cached.hash == hash && time.Now().Before(cached.expires) {
+		return cached.decision, nil
+	}
+
+	resp, err := p.client.Post(p.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return policyDecision{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return policyDecision{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var decision policyDecision
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return policyDecision{}, fmt.Errorf("invalid response: %s", err.Error())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.decisions[key] = cachedDecision{hash: hash, decision: decision, expires: time.Now().Add(p.ttl)}
+	return decision, nil
+}
+
+// forget drops the cached decision of a deleted InferenceJob.
+func (p *externalPolicy) forget(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.decisions, key)
+}
+
+// reviewDeployment has the external policy endpoint, if configured, review
+// the Deployment rendered for the InferenceJob. It returns false if the
+// Deployment must not be created or updated, in which case the InferenceJob
+// is marked PolicyDenied and reviewed again once the decision expires.
+func (c *Controller) reviewDeployment(key string, inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment) (bool, error) {
+	if c.externalPolicy == nil {
+		return true, nil
+	}
+	decision, err := c.externalPolicy.review(inferenceJob, deployment)
+	switch {
+	case err != nil && c.externalPolicy.failurePolicy == policyFailureIgnore:
+		// Fail open, the error is only surfaced in the logs.
+		utilruntime.HandleError(fmt.Errorf("%s: external policy review failed, deploying anyway: %s", key, err.Error()))
+		return true, nil
+	case err != nil:
+		msg := fmt.Sprintf(MessagePolicyUnavailable, deployment.Name, err.Error())
+		if markErr := c.markPolicyDenied(inferenceJob, "PolicyEndpointUnavailable", msg); markErr != nil {
+			return false, markErr
+		}
+		return false, fmt.Errorf("%s: external policy review failed: %s", key, err.Error())
+	case !decision.Allowed:
+		c.workqueue.AddAfter(key, c.externalPolicy.ttl)
+		return false, c.markPolicyDenied(inferenceJob, "ExternalPolicyDenied", fmt.Sprintf(MessagePolicyDenied, deployment.Name, decision.Message))
+	}
+	return true, nil
+}
+
+// markPolicyDenied sets the PolicyDenied condition of the InferenceJob.
+func (c *Controller) markPolicyDenied(inferenceJob *samplev1alpha1.InferenceJob, reason, msg string) error {
+	condMsg := c.messages.render(reason, msg, inferenceJob)
+	if cond := getCondition(inferenceJob.Status, samplev1alpha1.PolicyDenied); cond != nil && cond.Reason == reason && cond.Message == condMsg {
+		return nil
+	}
+	c.recorder.Event(inferenceJob, corev1.EventTypeWarning, ErrPolicyDenied, msg)
+
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	setCondition(&inferenceJobCopy.Status, newCondition(samplev1alpha1.PolicyDenied, corev1.ConditionTrue, reason, condMsg))
+	_, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).UpdateStatus(inferenceJobCopy)
+	return err
+}
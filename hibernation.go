@@ -0,0 +1,236 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// HibernatedReplicasAnnotation marks an InferenceJob hibernating for a
+	// window and records its replicas when the window started. Its workload
+	// is rendered with zero replicas while it is set, see tierReplicas;
+	// spec.replicas is left to the InferenceJobSet or autoscaler owning it.
+	HibernatedReplicasAnnotation = "fabianoyoschitaki.io/hibernated-replicas"
+
+	// defaultHibernationExemptSelector selects the InferenceJobs never
+	// hibernated if the config doesn't say otherwise.
+	defaultHibernationExemptSelector = "environment=production"
+	// hibernationInterval is how often InferenceJobs are checked against
+	// the hibernation windows.
+	hibernationInterval = time.Minute
+)
+
+// hibernationConfig schedules the off-hours windows InferenceJobs are
+// scaled to zero in.
+type hibernationConfig struct {
+	Windows []hibernationWindow `json:"windows"`
+	// ExemptSelector is a label selector of the InferenceJobs never
+	// hibernated. Defaults to environment=production.
+	ExemptSelector *string `json:"exemptSelector,omitempty"`
+
+	exempt labels.Selector
+}
+
+// hibernationWindow is a daily window, e.g. from 20:00 to 07:00. Windows
+// ending before they start span midnight.
+type hibernationWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Days the window starts on, e.g. Sat, Sun. Every day if empty.
+	Days []string `json:"days,omitempty"`
+	// Timezone is the IANA time zone of the window. Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Namespaces the window applies to. All namespaces if empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	start, end time.Duration
+	location   *time.Location
+}
+
+// loadHibernationConfig reads a YAML or JSON hibernation config.
+func loadHibernationConfig(path string) (*hibernationConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	config := &hibernationConfig{}
+	if err := yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(config); err != nil {
+		return nil, fmt.Errorf("error parsing hibernation config %s: %s", path, err.Error())
+	}
+	exempt := defaultHibernationExemptSelector
+	if config.ExemptSelector != nil {
+		exempt = *config.ExemptSelector
+	}
+	if config.exempt, err = labels.Parse(exempt); err != nil {
+		return nil, fmt.Errorf("invalid hibernation exempt selector: %s", err.Error())
+	}
+	for i := range config.Windows {
+		w := &config.Windows[i]
+		if w.start, err = parseTimeOfDay(w.Start); err != nil {
+			return nil, err
+		}
+		if w.end, err = parseTimeOfDay(w.End); err != nil {
+			return nil, err
+		}
+		if w.location, err = time.LoadLocation(w.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid hibernation window timezone: %s", err.Error())
+		}
+	}
+	return config, nil
+}
+
+// parseTimeOfDay parses HH:MM into the time since midnight.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// hibernating reports whether InferenceJobs in the namespace are in a
+// hibernation window at now.
+func (h *hibernationConfig) hibernating(namespace string, now time.Time) bool {
+	for i := range h.Windows {
+		if h.Windows[i].covers(namespace, now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *hibernationWindow) covers(namespace string, now time.Time) bool {
+	if len(w.Namespaces) > 0 && !containsString(w.Namespaces, namespace) {
+		return false
+	}
+	now = now.In(w.location)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, w.location)
+	sinceMidnight := now.Sub(midnight)
+	if w.start <= w.end {
+		return w.startsOn(now.Weekday()) && sinceMidnight >= w.start && sinceMidnight < w.end
+	}
+	// Spanning midnight, the window started either today or yesterday.
+	return w.startsOn(now.Weekday()) && sinceMidnight >= w.start ||
+		w.startsOn(now.AddDate(0, 0, -1).Weekday()) && sinceMidnight < w.end
+}
+
+func (w *hibernationWindow) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if strings.EqualFold(d, day.String()[:3]) || strings.EqualFold(d, day.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// syncHibernation marks the eligible InferenceJobs hibernating with
+// HibernatedReplicasAnnotation when their hibernation window starts, which
+// scales their workloads to zero, and removes it when the window ends, which
+// brings them back to their spec.replicas, including changes made during
+// the window.
+func (c *Controller) syncHibernation() {
+	inferenceJobs, err := c.inferenceJobsLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	now := time.Now()
+	for _, inferenceJob := range inferenceJobs {
+		if inferenceJob.DeletionTimestamp != nil || c.observing(inferenceJob.Namespace) ||
+			!c.shards.owns(inferenceJob.Namespace+"/"+inferenceJob.Name) {
+			continue
+		}
+		hibernate := c.hibernation.hibernating(inferenceJob.Namespace, now) &&
+			!c.hibernation.exempt.Matches(labels.Set(inferenceJob.Labels))
+		var err error
+		switch {
+		case hibernate && !hibernated(inferenceJob):
+			err = c.hibernate(inferenceJob)
+		case !hibernate && hibernated(inferenceJob):
+			err = c.wakeUp(inferenceJob)
+		}
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("error updating hibernation of inferenceJob %s/%s: %s", inferenceJob.Namespace, inferenceJob.Name, err.Error()))
+		}
+	}
+}
+
+// hibernated reports whether the InferenceJob is in a hibernation window.
+func hibernated(inferenceJob *samplev1alpha1.InferenceJob) bool {
+	_, ok := inferenceJob.Annotations[HibernatedReplicasAnnotation]
+	return ok
+}
+
+func (c *Controller) hibernate(inferenceJob *samplev1alpha1.InferenceJob) error {
+	replicas := int32(1)
+	if inferenceJob.Spec.Replicas != nil {
+		replicas = *inferenceJob.Spec.Replicas
+	}
+	klog.Infof("Hibernating inferenceJob %s/%s with %d replicas", inferenceJob.Namespace, inferenceJob.Name, replicas)
+	return c.patchHibernation(inferenceJob, strconv.Itoa(int(replicas)))
+}
+
+func (c *Controller) wakeUp(inferenceJob *samplev1alpha1.InferenceJob) error {
+	replicas := int32(1)
+	if inferenceJob.Spec.Replicas != nil {
+		replicas = *inferenceJob.Spec.Replicas
+	}
+	klog.Infof("Restoring inferenceJob %s/%s to %d replicas after hibernation", inferenceJob.Namespace, inferenceJob.Name, replicas)
+	return c.patchHibernation(inferenceJob, nil)
+}
+
+// patchHibernation sets the HibernatedReplicasAnnotation of the
+// InferenceJob, removing it if recorded is nil. The spec isn't touched.
+func (c *Controller) patchHibernation(inferenceJob *samplev1alpha1.InferenceJob, recorded interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{HibernatedReplicasAnnotation: recorded},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).Patch(inferenceJob.Name, types.MergePatchType, patch)
+	return err
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// controllerVersion identifies the controller build, set at build time with
+// -ldflags "-X main.controllerVersion=<version>".
+var controllerVersion = "dev"
+
+// fieldManager is the name the controller's writes are attributed to. It
+// prefixes the user agent of the clients, which the API server uses as the
+// field manager of their requests.
+const fieldManager = "inferencejob-controller"
+
+const (
+	// ControllerVersionAnnotation is set on the objects the controller
+	// writes to the version of the controller build.
+	ControllerVersionAnnotation = "fabianoyoschitaki.io/controller-version"
+	// InferenceJobUIDLabel is set on the objects generated for an
+	// InferenceJob to its UID.
+	InferenceJobUIDLabel = "fabianoyoschitaki.io/inference-job-uid"
+	// AppliedGenerationAnnotation is set on the objects generated for an
+	// InferenceJob to the generation of the InferenceJob they were rendered
+	// from.
+	AppliedGenerationAnnotation = "fabianoyoschitaki.io/applied-generation"
+)
+
+// userAgent returns the user agent of the controller's clients.
+func userAgent() string {
+	return fieldManager + "/" + controllerVersion
+}
+
+// stampIdentity labels and annotates an object generated for the
+// InferenceJob with the controller build and the InferenceJob generation it
+// was rendered from.
+func stampIdentity(meta *metav1.ObjectMeta, inferenceJob *samplev1alpha1.InferenceJob) {
+	if meta.Labels == nil {
+		meta.Labels = map[string]string{}
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Labels[InferenceJobUIDLabel] = string(inferenceJob.UID)
+	meta.Annotations[ControllerVersionAnnotation] = controllerVersion
+	meta.Annotations[AppliedGenerationAnnotation] = strconv.FormatInt(inferenceJob.Generation, 10)
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// ImportAnnotation requests the import of an unmanaged Deployment. The
+	// value is the name of the InferenceJob to create, or "true" to name it
+	// after the Deployment.
+	ImportAnnotation = "fabianoyoschitaki.io/import"
+
+	// SuccessImported is used as part of the Event 'reason' when a
+	// Deployment is imported into a InferenceJob.
+	SuccessImported = "Imported"
+	// MessageImported is the message used for an Event fired when a
+	// Deployment is imported into a InferenceJob.
+	MessageImported = "Imported Deployment %q"
+)
+
+// enqueueImport queues a Deployment annotated for import that isn't
+// controlled by anything yet.
+func (c *Controller) enqueueImport(obj interface{}) {
+	deployment, ok := obj.(*appsv1.Deployment)
+	if !ok || deployment.Annotations[ImportAnnotation] == "" || metav1.GetControllerOf(deployment) != nil {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(deployment)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if !c.shards.owns(key) {
+		return
+	}
+	c.importqueue.Add(key)
+}
+
+func (c *Controller) runImportWorker() {
+	for c.processNextImport() {
+	}
+}
+
+func (c *Controller) processNextImport() bool {
+	obj, shutdown := c.importqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.importqueue.Done(obj)
+
+	key := obj.(string)
+	if err := c.importDeployment(key); err != nil {
+		c.importqueue.AddRateLimited(key)
+		utilruntime.HandleError(fmt.Errorf("error importing deployment '%s': %s, requeuing", key, err.Error()))
+		return true
+	}
+	c.importqueue.Forget(obj)
+	return true
+}
+
+// importDeployment creates a InferenceJob matching the Deployment and hands
+// the Deployment over to it by adding a controller reference. The import
+// annotation is removed in the same patch.
+func (c *Controller) importDeployment(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return nil
+	}
+	deployment, err := c.deploymentsLister.Deployments(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if deployment.Annotations[ImportAnnotation] == "" || metav1.GetControllerOf(deployment) != nil {
+		return nil
+	}
+	if c.observing(namespace) {
+		klog.V(4).Infof("Not importing deployment %s, namespace %s is observed only", key, namespace)
+		return nil
+	}
+
+	inferenceJob := newInferenceJobFromDeployment(deployment)
+	created, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(namespace).Create(inferenceJob)
+	if errors.IsAlreadyExists(err) {
+		// A previous attempt failed after creating the InferenceJob.
+		created, err = c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(namespace).Get(inferenceJob.Name, metav1.GetOptions{})
+		if err == nil && created.Spec.DeploymentName != deployment.Name {
+			return fmt.Errorf("inferenceJob %s already exists and manages deployment %s", created.Name, created.Spec.DeploymentName)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	ownerRefs := append([]metav1.OwnerReference{}, deployment.OwnerReferences...)
+	ownerRefs = append(ownerRefs, *metav1.NewControllerRef(created, samplev1alpha1.SchemeGroupVersion.WithKind("InferenceJob")))
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": ownerRefs,
+			"annotations":     map[string]interface{}{ImportAnnotation: nil},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.kubeclientset.AppsV1().Deployments(namespace).Patch(name, types.MergePatchType, patch); err != nil {
+		return err
+	}
+
+	klog.Infof("Imported deployment %s into inferenceJob %s", key, created.Name)
+	c.recorder.Event(created, corev1.EventTypeNormal, SuccessImported, fmt.Sprintf(MessageImported, deployment.Name))
+	return nil
+}
+
+// newInferenceJobFromDeployment derives a InferenceJob spec from the fields of
+// the Deployment the InferenceJob API can express.
+func newInferenceJobFromDeployment(deployment *appsv1.Deployment) *samplev1alpha1.InferenceJob {
+	name := deployment.Annotations[ImportAnnotation]
+	if name == "true" {
+		name = deployment.Name
+	}
+	spec := samplev1alpha1.InferenceJobSpec{
+		DeploymentName: deployment.Name,
+		Replicas:       deployment.Spec.Replicas,
+		ImageToDeploy:  deploymentImage(deployment),
+	}
+	if len(deployment.Spec.Template.Spec.Containers) > 0 {
+		if gpus, ok := deployment.Spec.Template.Spec.Containers[0].Resources.Limits[gpuResourceName]; ok {
+			count := gpus.Value()
+			spec.GPUs = &count
+		}
+	}
+	return &samplev1alpha1.InferenceJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: deployment.Namespace,
+			Labels:    deployment.Labels,
+		},
+		Spec: spec,
+	}
+}
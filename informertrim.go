@@ -0,0 +1,159 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cachedDeploymentAnnotations are the annotations of Deployments the
+// controller reads, the others are dropped by trimDeployment.
+var cachedDeploymentAnnotations = []string{TemplateHashAnnotation, ImportAnnotation}
+
+// trimDeployment drops the fields of a Deployment the controller never
+// reads before it is cached: its managed fields, the annotations other than
+// cachedDeploymentAnnotations, such as the configuration kubectl last
+// applied, and the collision count and condition timestamps of its status.
+// The pod template is kept whole, drift correction compares every field of
+// it. Deployments are only written with server-side apply, so the dropped
+// fields are never written back.
+func trimDeployment(deployment *appsv1.Deployment) {
+	deployment.ManagedFields = nil
+	var annotations map[string]string
+	for _, key := range cachedDeploymentAnnotations {
+		if value, ok := deployment.Annotations[key]; ok {
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[key] = value
+		}
+	}
+	deployment.Annotations = annotations
+	deployment.Status.CollisionCount = nil
+	for i := range deployment.Status.Conditions {
+		deployment.Status.Conditions[i].LastUpdateTime = metav1.Time{}
+		deployment.Status.Conditions[i].LastTransitionTime = metav1.Time{}
+	}
+}
+
+// trimmedListWatch trims the Deployments listed and watched by lw, see
+// trimDeployment.
+func trimmedListWatch(lw *cache.ListWatch) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			list, err := lw.ListFunc(options)
+			if err != nil {
+				return nil, err
+			}
+			if deployments, ok := list.(*appsv1.DeploymentList); ok {
+				for i := range deployments.Items {
+					trimDeployment(&deployments.Items[i])
+				}
+			}
+			return list, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			w, err := lw.WatchFunc(options)
+			if err != nil {
+				return nil, err
+			}
+			return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+				if deployment, ok := event.Object.(*appsv1.Deployment); ok {
+					trimDeployment(deployment)
+				}
+				return event, true
+			}), nil
+		},
+	}
+}
+
+// pagedListWatch makes lw list in pages of pageSize, so the initial list of
+// a large cluster is made of requests that each complete in time rather than
+// one that times out. Unlike the reflector's own paging, it reads from etcd:
+// the watch cache serving resourceVersion "0" ignores the limit. lw is
+// returned as is if pageSize is 0.
+func pagedListWatch(lw *cache.ListWatch, pageSize int64) *cache.ListWatch {
+	if pageSize <= 0 {
+		return lw
+	}
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return listInPages(lw.ListFunc, options, pageSize)
+		},
+		WatchFunc: lw.WatchFunc,
+	}
+}
+
+// listInPages lists in pages of pageSize and returns the items of every page
+// in the last one. If the continue token expires in between, everything is
+// listed at once instead.
+func listInPages(list cache.ListFunc, options metav1.ListOptions, pageSize int64) (runtime.Object, error) {
+	options.ResourceVersion = ""
+	options.Limit = pageSize
+	options.Continue = ""
+	var items []runtime.Object
+	for {
+		page, err := list(options)
+		if errors.IsResourceExpired(err) && options.Continue != "" {
+			options.Limit, options.Continue = 0, ""
+			return list(options)
+		}
+		if err != nil {
+			return nil, err
+		}
+		pageItems, err := meta.ExtractList(page)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, pageItems...)
+		listMeta, err := meta.ListAccessor(page)
+		if err != nil {
+			return nil, err
+		}
+		if listMeta.GetContinue() == "" {
+			return page, meta.SetList(page, items)
+		}
+		options.Continue = listMeta.GetContinue()
+	}
+}
+
+// useTrimmedDeploymentInformer makes the informer factory cache trimmed
+// Deployments, see trimDeployment, listed in pages of listPageSize, see
+// pagedListWatch. Only the namespace is watched if set. It must be called
+// before the informer is first requested.
+func useTrimmedDeploymentInformer(kubeInformerFactory kubeinformers.SharedInformerFactory, namespace string, listPageSize int64) {
+	kubeInformerFactory.InformerFor(&appsv1.Deployment{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return cache.NewSharedIndexInformer(trimmedListWatch(pagedListWatch(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.AppsV1().Deployments(namespace).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.AppsV1().Deployments(namespace).Watch(options)
+			},
+		}, listPageSize)), &appsv1.Deployment{}, resync, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	})
+}
@@ -0,0 +1,440 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
+	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions/samplecontroller/v1alpha1"
+	listers "k8s.io/sample-controller/pkg/generated/listers/samplecontroller/v1alpha1"
+)
+
+const (
+	// JobSetLabel is set on every InferenceJob created for a InferenceJobSet
+	// to the name of the set.
+	JobSetLabel = "fabianoyoschitaki.io/jobset"
+
+	// JobSetMemberCreated is used as part of the Event 'reason' when a
+	// InferenceJobSet creates one of its InferenceJobs.
+	JobSetMemberCreated = "MemberCreated"
+	// MessageJobSetMemberCreated is the message used for an Event fired when a
+	// InferenceJobSet creates one of its InferenceJobs.
+	MessageJobSetMemberCreated = "Created InferenceJob %q"
+)
+
+// JobSetController is the controller implementation for InferenceJobSet
+// resources. It renders each member of a set into an InferenceJob, which is
+// then reconciled into a Deployment by Controller.
+type JobSetController struct {
+	sampleclientset clientset.Interface
+
+	inferenceJobsLister    listers.InferenceJobLister
+	inferenceJobsSynced    cache.InformerSynced
+	inferenceJobSetsLister listers.InferenceJobSetLister
+	inferenceJobSetsSynced cache.InformerSynced
+
+	// workqueue is replaced by every Run, the InferenceJobSets are only
+	// synced on the primary shard, see shards.runPrimary.
+	mu        sync.Mutex
+	workqueue workqueue.RateLimitingInterface
+	recorder  record.EventRecorder
+}
+
+// NewJobSetController returns a new InferenceJobSet controller. It records
+// events through the given recorder so it can share the broadcaster of the
+// InferenceJob controller.
+func NewJobSetController(
+	sampleclientset clientset.Interface,
+	recorder record.EventRecorder,
+	inferenceJobInformer informers.InferenceJobInformer,
+	inferenceJobSetInformer informers.InferenceJobSetInformer) *JobSetController {
+
+	controller := &JobSetController{
+		sampleclientset:        sampleclientset,
+		inferenceJobsLister:    inferenceJobInformer.Lister(),
+		inferenceJobsSynced:    inferenceJobInformer.Informer().HasSynced,
+		inferenceJobSetsLister: inferenceJobSetInformer.Lister(),
+		inferenceJobSetsSynced: inferenceJobSetInformer.Informer().HasSynced,
+		workqueue:              newJobSetQueue(),
+		recorder:               recorder,
+	}
+
+	klog.Info("Setting up InferenceJobSet event handlers")
+	inferenceJobSetInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.enqueueInferenceJobSet,
+		UpdateFunc: func(old, new interface{}) {
+			controller.enqueueInferenceJobSet(new)
+		},
+	})
+	// Member InferenceJobs report readiness through their status, so every
+	// change to them may unblock the next step of the rollout.
+	inferenceJobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleInferenceJob,
+		UpdateFunc: func(old, new interface{}) {
+			controller.handleInferenceJob(new)
+		},
+		DeleteFunc: controller.handleInferenceJob,
+	})
+
+	return controller
+}
+
+func newJobSetQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "InferenceJobSets")
+}
+
+// queue returns the workqueue of the current Run.
+func (c *JobSetController) queue() workqueue.RateLimitingInterface {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.workqueue
+}
+
+// Run waits for the informer caches to sync and starts workers. It blocks
+// until stopCh is closed and may be called again afterwards, the
+// InferenceJobSets are then all synced again.
+func (c *JobSetController) Run(threadiness int, stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+	c.mu.Lock()
+	if c.workqueue.ShuttingDown() {
+		c.workqueue = newJobSetQueue()
+	}
+	queue := c.workqueue
+	c.mu.Unlock()
+	defer queue.ShutDown()
+
+	klog.Info("Starting InferenceJobSet controller")
+	if ok := cache.WaitForCacheSync(stopCh, c.inferenceJobsSynced, c.inferenceJobSetsSynced); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+	// Changes made while another replica synced the sets were dropped.
+	sets, err := c.inferenceJobSetsLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, set := range sets {
+		c.enqueueInferenceJobSet(set)
+	}
+
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(func() { c.runWorker(queue) }, time.Second, stopCh)
+	}
+
+	<-stopCh
+	klog.Info("Shutting down InferenceJobSet workers")
+	return nil
+}
+
+func (c *JobSetController) runWorker(queue workqueue.RateLimitingInterface) {
+	for c.processNextWorkItem(queue) {
+	}
+}
+
+func (c *JobSetController) processNextWorkItem(queue workqueue.RateLimitingInterface) bool {
+	obj, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+
+	err := func(obj interface{}) error {
+		defer queue.Done(obj)
+		key, ok := obj.(string)
+		if !ok {
+			queue.Forget(obj)
+			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+			return nil
+		}
+		if err := c.syncHandler(key); err != nil {
+			queue.AddRateLimited(key)
+			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+		}
+		queue.Forget(obj)
+		klog.Infof("Successfully synced '%s'", key)
+		return nil
+	}(obj)
+
+	if err != nil {
+		utilruntime.HandleError(err)
+	}
+	return true
+}
+
+// syncHandler walks the members of the InferenceJobSet in order, creating or
+// updating their InferenceJobs, and stops at the first member that isn't
+// ready yet. InferenceJobs of members that were removed from the set are
+// deleted. Deleting the set itself removes all members through garbage
+// collection of the owner references.
+func (c *JobSetController) syncHandler(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		return nil
+	}
+
+	set, err := c.inferenceJobSetsLister.InferenceJobSets(namespace).Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			utilruntime.HandleError(fmt.Errorf("inferenceJobSet '%s' in work queue no longer exists", key))
+			return nil
+		}
+		return err
+	}
+
+	jobs := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(namespace)
+	wanted := map[string]bool{}
+	var ready int32
+	blocked := false
+	for _, member := range set.Spec.Jobs {
+		desired, err := newSetInferenceJob(set, member)
+		if err != nil {
+			c.recorder.Event(set, corev1.EventTypeWarning, "InvalidMember", err.Error())
+			return nil
+		}
+		wanted[desired.Name] = true
+		if blocked {
+			continue
+		}
+
+		job, err := c.inferenceJobsLister.InferenceJobs(namespace).Get(desired.Name)
+		if errors.IsNotFound(err) {
+			if _, err := jobs.Create(desired); err != nil {
+				return err
+			}
+			c.recorder.Event(set, corev1.EventTypeNormal, JobSetMemberCreated, fmt.Sprintf(MessageJobSetMemberCreated, desired.Name))
+			blocked = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !metav1.IsControlledBy(job, set) {
+			msg := fmt.Sprintf(MessageResourceExists, job.Name)
+			c.recorder.Event(set, corev1.EventTypeWarning, ErrResourceExists, msg)
+			return fmt.Errorf(msg)
+		}
+		if !equality.Semantic.DeepEqual(job.Spec, desired.Spec) {
+			jobCopy := job.DeepCopy()
+			jobCopy.Spec = desired.Spec
+			if _, err := jobs.Update(jobCopy); err != nil {
+				return err
+			}
+			blocked = true
+			continue
+		}
+		if !inferenceJobReady(job) {
+			blocked = true
+			continue
+		}
+		ready++
+	}
+
+	// Remove InferenceJobs of members that are no longer part of the set.
+	selector := labels.SelectorFromSet(labels.Set{JobSetLabel: set.Name})
+	owned, err := c.inferenceJobsLister.InferenceJobs(namespace).List(selector)
+	if err != nil {
+		return err
+	}
+	for _, job := range owned {
+		if wanted[job.Name] || !metav1.IsControlledBy(job, set) {
+			continue
+		}
+		if err := jobs.Delete(job.Name, nil); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return c.updateInferenceJobSetStatus(set, ready)
+}
+
+func (c *JobSetController) updateInferenceJobSetStatus(set *samplev1alpha1.InferenceJobSet, ready int32) error {
+	setCopy := set.DeepCopy()
+	setCopy.Status.ReadyJobs = ready
+	setCopy.Status.Ready = int(ready) == len(set.Spec.Jobs)
+	if reflect.DeepEqual(setCopy.Status, set.Status) {
+		return nil
+	}
+	_, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobSets(set.Namespace).Update(setCopy)
+	return err
+}
+
+func (c *JobSetController) enqueueInferenceJobSet(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue().Add(key)
+}
+
+// handleInferenceJob enqueues the InferenceJobSet controlling the given
+// InferenceJob, if any.
+func (c *JobSetController) handleInferenceJob(obj interface{}) {
+	object, ok := obj.(metav1.Object)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
+			return
+		}
+		if object, ok = tombstone.Obj.(metav1.Object); !ok {
+			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
+			return
+		}
+	}
+	ownerRef := metav1.GetControllerOf(object)
+	if ownerRef == nil || ownerRef.Kind != "InferenceJobSet" {
+		return
+	}
+	set, err := c.inferenceJobSetsLister.InferenceJobSets(object.GetNamespace()).Get(ownerRef.Name)
+	if err != nil {
+		klog.V(4).Infof("ignoring orphaned object '%s' of inferenceJobSet '%s'", object.GetSelfLink(), ownerRef.Name)
+		return
+	}
+	c.enqueueInferenceJobSet(set)
+}
+
+// newSetInferenceJob renders a member of the set into an InferenceJob, filling
+// the fields the member leaves empty from the set defaults.
+func newSetInferenceJob(set *samplev1alpha1.InferenceJobSet, member samplev1alpha1.InferenceJobSetMember) (*samplev1alpha1.InferenceJob, error) {
+	if member.Name == "" {
+		return nil, fmt.Errorf("member name must be specified")
+	}
+	spec, err := mergeInferenceJobSpec(set.Spec.Defaults, member.Spec, member.Clear)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%s", set.Name, member.Name)
+	if spec.DeploymentName == "" {
+		spec.DeploymentName = name
+	}
+	return &samplev1alpha1.InferenceJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: set.Namespace,
+			Labels:    map[string]string{JobSetLabel: set.Name},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(set, samplev1alpha1.SchemeGroupVersion.WithKind("InferenceJobSet")),
+			},
+		},
+		Spec: *spec,
+	}, nil
+}
+
+// mergeInferenceJobSpec overlays the top-level fields set on override onto
+// defaults. Empty fields of override, which can't be told apart from unset
+// ones, keep their default unless listed in clear. Working on the JSON form
+// keeps the merge in step with new spec fields without having to list them
+// here.
+func mergeInferenceJobSpec(defaults, override samplev1alpha1.InferenceJobSpec, clear []string) (*samplev1alpha1.InferenceJobSpec, error) {
+	base, err := specFields(defaults)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := specFields(override)
+	if err != nil {
+		return nil, err
+	}
+	known := specFieldNames()
+	for _, k := range clear {
+		if !known[k] {
+			return nil, fmt.Errorf("unknown spec field %q to clear", k)
+		}
+		delete(base, k)
+	}
+	for k, v := range fields {
+		if !isEmptyJSONValue(v) {
+			base[k] = v
+		}
+	}
+	data, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	merged := &samplev1alpha1.InferenceJobSpec{}
+	if err := json.Unmarshal(data, merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// specFieldNames returns the JSON names of the InferenceJobSpec fields.
+func specFieldNames() map[string]bool {
+	names := map[string]bool{}
+	t := reflect.TypeOf(samplev1alpha1.InferenceJobSpec{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+func specFields(spec samplev1alpha1.InferenceJobSpec) (map[string]interface{}, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+func isEmptyJSONValue(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case bool:
+		return !t
+	case []interface{}:
+		return len(t) == 0
+	case map[string]interface{}:
+		return len(t) == 0
+	}
+	return false
+}
+
+// inferenceJobReady reports whether all replicas the InferenceJob runs with
+// are available. Hibernating and tiered members run with fewer replicas
+// than their spec asks for and don't hold the set back.
+func inferenceJobReady(job *samplev1alpha1.InferenceJob) bool {
+	replicas := int32(1)
+	if r := tierReplicas(job); r != nil {
+		replicas = *r
+	}
+	return job.Status.AvailableReplicas >= replicas
+}
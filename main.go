@@ -18,38 +18,174 @@ package main
 
 import (
 	"flag"
+	"os"
+	"regexp"
+	"strings"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
 
 	// Uncomment the following line to load the gcp plugin (only required to authenticate against GKE clusters).
 	// _ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/certs"
 	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
 	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions"
+	"k8s.io/sample-controller/pkg/policy"
 	"k8s.io/sample-controller/pkg/signals"
 )
 
 var (
 	masterURL  string
 	kubeconfig string
+
+	certSecretName     string
+	certNamespace      string
+	certDNSNames       string
+	validatingWebhooks string
+	mutatingWebhooks   string
+
+	podLoadMetric string
+	podLoadPort   int
+	podLoadPath   string
+
+	webhookBindAddress string
+	jobNamePattern     string
+	requiredLabels     string
+
+	metricsBindAddress string
+
+	modelRegistryBindAddress string
+	modelRegistryToken       string
+
+	cacheWatchdogInterval time.Duration
+	cacheMaxStaleness     time.Duration
+	cacheWatchdogExit     bool
+
+	promotionConfigPath string
+
+	deploymentNameTemplate  string
+	statefulSetNameTemplate string
+	daemonSetNameTemplate   string
+	serviceNameTemplate     string
+
+	messageTemplatesConfigMap string
+
+	mode              string
+	enforceNamespaces string
+
+	namespaceWriteConcurrency int
+
+	hibernationConfigPath string
+
+	policyEndpoint      string
+	policyFailurePolicy string
+	policyTimeout       time.Duration
+	policyCacheTTL      time.Duration
+
+	retryBackoffs  string
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	retryQPS       float64
+	retryBurst     int
+
+	eventLabelKeys string
+
+	metricsPushURL      string
+	metricsPushInterval time.Duration
+	metricsPushPort     int
+	metricsPushPath     string
+
+	pollInterval time.Duration
+
+	acceleratorNodeLabel string
+	acceleratorMemory    string
+
+	orphanSweepInterval time.Duration
+	orphanSweepDryRun   bool
+
+	clusterDomain string
+
+	watchPods bool
+
+	workers        int
+	resyncPeriod   time.Duration
+	kubeAPIQPS     float64
+	kubeAPIBurst   int
+	kubeAPITimeout time.Duration
+
+	cleanupWebhookURL     string
+	cleanupWebhookTimeout time.Duration
+
+	watchNamespace string
+
+	requeueInterval time.Duration
+
+	dryRun bool
+
+	shutdownTimeout time.Duration
+
+	maxRetries int
+
+	traceAll bool
+
+	syncTimeout time.Duration
+
+	settleWindow time.Duration
+
+	listPageSize int64
+
+	shardCount          int
+	shardIndex          int
+	shardLeaseNamespace string
 )
 
 func main() {
 	flag.Parse()
+	if workers < 1 {
+		klog.Fatalf("--workers must be at least 1, got %d", workers)
+	}
+	if shardCount < 1 || shardIndex < 0 || shardIndex >= shardCount {
+		klog.Fatalf("--shard-index must be between 0 and --shard-count minus 1, got %d of %d", shardIndex, shardCount)
+	}
 
 	// set up signals so we handle the first shutdown signal gracefully
-	stopCh := signals.SetupSignalHandler()
+	ctx := signals.SetupSignalContext()
+	stopCh := ctx.Done()
 
 	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
 	if err != nil {
 		klog.Fatalf("Error building kubeconfig: %s", err.Error())
 	}
+	// Attribute all writes to the controller build.
+	cfg.UserAgent = userAgent()
+	cfg.QPS = float32(kubeAPIQPS)
+	cfg.Burst = kubeAPIBurst
+
+	// The informers watch through clients without a timeout, watches are
+	// long-running requests the API server ends itself.
+	kubeWatchClient, err := kubernetes.NewForConfig(protobufConfig(cfg))
+	if err != nil {
+		klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
+	}
+	exampleWatchClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatalf("Error building example clientset: %s", err.Error())
+	}
 
-	kubeClient, err := kubernetes.NewForConfig(cfg)
+	// Every other request gives up after the timeout, so a stuck
+	// connection to the API server can't wedge a worker.
+	cfg.Timeout = kubeAPITimeout
+	kubeClient, err := kubernetes.NewForConfig(protobufConfig(cfg))
 	if err != nil {
 		klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
 	}
@@ -59,19 +195,224 @@ func main() {
 		klog.Fatalf("Error building example clientset: %s", err.Error())
 	}
 
-	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
-	exampleInformerFactory := informers.NewSharedInformerFactory(exampleClient, time.Second*30)
+	if flag.Arg(0) == "cleanup-orphans" {
+		if err := cleanupOrphans(kubeClient, exampleClient, flag.Args()[1:]); err != nil {
+			klog.Fatalf("Error cleaning up orphaned resources: %s", err.Error())
+		}
+		return
+	}
+	if flag.Arg(0) == "restart" {
+		if err := restartInferenceJobs(exampleClient, flag.Args()[1:]); err != nil {
+			klog.Fatalf("Error restarting InferenceJobs: %s", err.Error())
+		}
+		return
+	}
+
+	var rotator *certs.Rotator
+	if certSecretName != "" {
+		rotator = certs.NewRotator(kubeClient, certNamespace, certSecretName, splitList(certDNSNames))
+		rotator.ValidatingWebhooks = splitList(validatingWebhooks)
+		rotator.MutatingWebhooks = splitList(mutatingWebhooks)
+		if err = rotator.Run(time.Hour, stopCh); err != nil {
+			klog.Fatalf("Error setting up serving certificates: %s", err.Error())
+		}
+	}
+
+	if watchNamespace != metav1.NamespaceAll {
+		klog.Infof("Watching namespace %s only", watchNamespace)
+	}
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeWatchClient, resyncPeriod,
+		kubeinformers.WithNamespace(watchNamespace))
+	exampleInformerFactory := informers.NewSharedInformerFactoryWithOptions(exampleWatchClient, resyncPeriod,
+		informers.WithNamespace(watchNamespace))
+	// Only the pods of InferenceJobs are watched.
+	podInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeWatchClient, resyncPeriod,
+		kubeinformers.WithNamespace(watchNamespace),
+		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = podControllerLabel
+		}))
+	if pollInterval > 0 {
+		klog.Infof("Polling the API server every %s instead of watching", pollInterval)
+		usePollingInformers(kubeInformerFactory, exampleInformerFactory, watchNamespace, pollInterval, listPageSize)
+		usePollingPodInformer(podInformerFactory, watchNamespace, pollInterval)
+	} else {
+		useTrimmedDeploymentInformer(kubeInformerFactory, watchNamespace, listPageSize)
+	}
 
 	controller := NewController(kubeClient, exampleClient,
 		kubeInformerFactory.Apps().V1().Deployments(),
 		exampleInformerFactory.Samplecontroller().V1alpha1().InferenceJobs())
+	if podLoadMetric != "" {
+		controller.podLoad = newScrapedPodLoad(podLoadPort, podLoadPath, podLoadMetric)
+	}
+	if metricsPushURL != "" {
+		controller.metricsPush = newMetricsPusher(metricsPushURL, metricsPushPort, metricsPushPath, metricsPushInterval)
+	}
+	controller.clusterDomain = clusterDomain
+	controller.requeueInterval = requeueInterval
+	controller.shutdownTimeout = shutdownTimeout
+	controller.syncTimeout = syncTimeout
+	controller.settleWindow = settleWindow
+	if shardCount > 1 {
+		identity, err := os.Hostname()
+		if err != nil {
+			klog.Fatalf("Error getting the shard lease identity: %s", err.Error())
+		}
+		controller.shards = newShards(kubeClient, shardLeaseNamespace, identity, shardIndex, shardCount)
+	}
+	controller.maxRetries = maxRetries
+	controller.traceAll = traceAll
+	if watchPods {
+		controller.watchPods(podInformerFactory.Core().V1().Pods())
+	}
+	// Nodes are only needed for spec.minReplicasPerZone, which is ignored
+	// without cluster-wide access to them.
+	if ok, err := canWatchNodes(kubeClient); err != nil {
+		klog.Warningf("Error checking access to nodes, not watching them: %s", err.Error())
+	} else if !ok {
+		klog.Warning("Not allowed to watch nodes, spec.minReplicasPerZone is ignored")
+	} else {
+		controller.watchNodes(kubeInformerFactory.Core().V1().Nodes())
+	}
+	if orphanSweepInterval > 0 {
+		controller.orphans = newOrphanSweeper(kubeClient, exampleClient, orphanSweepDryRun)
+		controller.orphans.namespace = watchNamespace
+		controller.orphanSweepInterval = orphanSweepInterval
+	}
+
+	controller.nameTemplates = samplev1alpha1.NameTemplates{
+		Deployment:  deploymentNameTemplate,
+		StatefulSet: statefulSetNameTemplate,
+		DaemonSet:   daemonSetNameTemplate,
+		Service:     serviceNameTemplate,
+	}
+	backoffs, err := parseRetryBackoffs(defaultRetryBackoff(retryBaseDelay, retryMaxDelay) + retryBackoffs)
+	if err != nil {
+		klog.Fatalf("Error parsing retry backoffs: %s", err.Error())
+	}
+	controller.retryLimiter.configure(backoffs)
+	controller.retryLimiter.limitOverall(retryQPS, retryBurst)
+	controller.setEventLabelKeys(splitList(eventLabelKeys))
+	controller.deploymentWrites = newNamespaceLimiter(namespaceWriteConcurrency)
+	switch mode {
+	case modeEnforce:
+	case modeObserve:
+		controller.observeOnly = true
+		for _, namespace := range splitList(enforceNamespaces) {
+			controller.enforcedNamespaces[namespace] = true
+		}
+	default:
+		klog.Fatalf("Invalid mode %q, must be %s or %s", mode, modeEnforce, modeObserve)
+	}
+	if dryRun {
+		klog.Info("Running in dry-run mode, no changes will be made")
+		controller.dryRun = true
+		if controller.orphans != nil {
+			controller.orphans.dryRun = true
+		}
+	}
+	if messageTemplatesConfigMap != "" {
+		namespace, name, err := cache.SplitMetaNamespaceKey(messageTemplatesConfigMap)
+		if err != nil {
+			klog.Fatalf("Error parsing message templates configmap: %s", err.Error())
+		}
+		go wait.Until(func() {
+			controller.messages.syncFromConfigMap(kubeClient, namespace, name)
+		}, time.Minute, stopCh)
+	}
+	if hibernationConfigPath != "" {
+		if controller.hibernation, err = loadHibernationConfig(hibernationConfigPath); err != nil {
+			klog.Fatalf("Error loading hibernation config: %s", err.Error())
+		}
+	}
+	if policyEndpoint != "" {
+		if policyFailurePolicy != policyFailureFail && policyFailurePolicy != policyFailureIgnore {
+			klog.Fatalf("Invalid policy failure policy %q, must be %s or %s", policyFailurePolicy, policyFailureFail, policyFailureIgnore)
+		}
+		controller.externalPolicy = newExternalPolicy(policyEndpoint, policyFailurePolicy, policyTimeout, policyCacheTTL)
+	}
+	if cleanupWebhookURL != "" {
+		controller.cleanupHooks = append(controller.cleanupHooks, newWebhookCleanup(cleanupWebhookURL, cleanupWebhookTimeout))
+	}
+	if promotionConfigPath != "" {
+		if controller.promotion, err = loadPromotionConfig(promotionConfigPath); err != nil {
+			klog.Fatalf("Error loading promotion config: %s", err.Error())
+		}
+	}
+
+	var namePattern *regexp.Regexp
+	if jobNamePattern != "" {
+		if namePattern, err = regexp.Compile(jobNamePattern); err != nil {
+			klog.Fatalf("Error parsing job name pattern: %s", err.Error())
+		}
+	}
+	var webhookRules []policy.Rule
+	if namePattern != nil || requiredLabels != "" {
+		naming := policy.NamingConvention(namePattern, splitList(requiredLabels))
+		controller.policy.Register(naming)
+		webhookRules = append(webhookRules, naming)
+	}
+	if acceleratorMemory != "" {
+		if controller.accelerators, err = parseAcceleratorMemory(acceleratorNodeLabel, acceleratorMemory); err != nil {
+			klog.Fatalf("Error parsing accelerator memory: %s", err.Error())
+		}
+		webhookRules = append(webhookRules, policy.ModelFit(controller.accelerators))
+	}
+	if webhookBindAddress != "" && len(webhookRules) > 0 {
+		if rotator == nil {
+			klog.Fatalf("Serving webhooks requires --cert-secret")
+		}
+		serveWebhooks(webhookBindAddress, &validatingWebhook{policy: policy.NewEngine(webhookRules...)}, rotator.GetCertificate, stopCh)
+	}
+
+	if metricsBindAddress != "" {
+		serveMetrics(metricsBindAddress, controller, stopCh)
+	}
+
+	if modelRegistryBindAddress != "" && !dryRun {
+		serveModelRegistry(modelRegistryBindAddress, &modelRegistryReceiver{
+			sampleclientset:     exampleClient,
+			inferenceJobsLister: exampleInformerFactory.Samplecontroller().V1alpha1().InferenceJobs().Lister(),
+			recorder:            controller.recorder,
+			token:               modelRegistryToken,
+		}, stopCh)
+	}
+
+	jobSetController := NewJobSetController(exampleClient, controller.recorder,
+		exampleInformerFactory.Samplecontroller().V1alpha1().InferenceJobs(),
+		exampleInformerFactory.Samplecontroller().V1alpha1().InferenceJobSets())
 
 	// notice that there is no need to run Start methods in a separate goroutine. (i.e. go kubeInformerFactory.Start(stopCh)
 	// Start method is non-blocking and runs all registered informers in a dedicated goroutine.
 	kubeInformerFactory.Start(stopCh)
 	exampleInformerFactory.Start(stopCh)
+	podInformerFactory.Start(stopCh)
+
+	// Polling caches lag behind by design, the watchdog would report them
+	// as stale.
+	if cacheWatchdogInterval > 0 && pollInterval == 0 {
+		watchdog := newCacheWatchdog(kubeClient, exampleClient,
+			kubeInformerFactory.Apps().V1().Deployments().Lister(),
+			exampleInformerFactory.Samplecontroller().V1alpha1().InferenceJobs().Lister(),
+			cacheMaxStaleness)
+		watchdog.namespace = watchNamespace
+		watchdog.metrics = controller.metrics
+		watchdog.exitOnStale = cacheWatchdogExit
+		go watchdog.Run(cacheWatchdogInterval, stopCh)
+	}
+
+	// InferenceJobSets write InferenceJobs, there is nothing to report. They
+	// aren't sharded, the replica holding the Lease of the first shard syncs
+	// all of them.
+	if !dryRun {
+		controller.shards.runPrimary(stopCh, func(stopCh <-chan struct{}) {
+			if err := jobSetController.Run(workers, stopCh); err != nil {
+				klog.Fatalf("Error running InferenceJobSet controller: %s", err.Error())
+			}
+		})
+	}
 
-	if err = controller.Run(2, stopCh); err != nil {
+	if err = controller.Run(ctx, workers); err != nil {
 		klog.Fatalf("Error running controller: %s", err.Error())
 	}
 }
@@ -79,4 +420,93 @@ func main() {
 func init() {
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	flag.StringVar(&certSecretName, "cert-secret", "", "Name of the Secret holding the self-signed CA and serving certificate. Certificate rotation is disabled if empty.")
+	flag.StringVar(&certNamespace, "cert-namespace", "default", "Namespace of the certificate Secret.")
+	flag.StringVar(&certDNSNames, "cert-dns-names", "", "Comma-separated DNS names the serving certificate is issued for, e.g. sample-controller.default.svc.")
+	flag.StringVar(&validatingWebhooks, "validating-webhook-configurations", "", "Comma-separated ValidatingWebhookConfigurations to inject the CA bundle into.")
+	flag.StringVar(&mutatingWebhooks, "mutating-webhook-configurations", "", "Comma-separated MutatingWebhookConfigurations to inject the CA bundle into.")
+	flag.StringVar(&podLoadMetric, "pod-load-metric", "", "Name of the request rate metric scraped from model server pods to order scale-downs. Disabled if empty.")
+	flag.IntVar(&podLoadPort, "pod-load-port", 8080, "Port the model server exposes metrics on.")
+	flag.StringVar(&podLoadPath, "pod-load-path", "/metrics", "HTTP path the model server exposes metrics on.")
+	flag.StringVar(&webhookBindAddress, "webhook-bind-address", "", "Address the validating admission webhook is served on, e.g. :8443. Requires --cert-secret. Disabled if empty.")
+	flag.StringVar(&jobNamePattern, "job-name-pattern", "", "Regular expression InferenceJob names must match.")
+	flag.StringVar(&requiredLabels, "required-labels", "", "Comma-separated labels every InferenceJob must carry, e.g. team,cost-center.")
+	flag.StringVar(&metricsBindAddress, "metrics-bind-address", "", "Address Prometheus metrics are served on at /metrics, e.g. :8080. Disabled if empty.")
+	flag.StringVar(&modelRegistryBindAddress, "model-registry-bind-address", "", "Address model registry version events are received on, e.g. :8081. Disabled if empty.")
+	flag.StringVar(&modelRegistryToken, "model-registry-token", "", "Bearer token the model registry must present. Requests are not authenticated if empty.")
+	flag.DurationVar(&cacheWatchdogInterval, "cache-watchdog-interval", 5*time.Minute, "How often informer caches are compared with objects read from the API server. Disabled if 0.")
+	flag.DurationVar(&cacheMaxStaleness, "cache-max-staleness", 10*time.Minute, "How long a cached object may lag behind the API server before the caches are considered stale.")
+	flag.BoolVar(&cacheWatchdogExit, "cache-watchdog-exit", false, "Exit when the informer caches are stale so they are re-listed on restart. Stale caches are only reported in inferencejob_stale_cache_objects otherwise.")
+	flag.StringVar(&promotionConfigPath, "promotion-config", "", "Path to the YAML or JSON config mapping namespaces InferenceJobs may be promoted to onto the rewrites applied. Promotion is disabled if empty.")
+	flag.StringVar(&deploymentNameTemplate, "deployment-name-template", defaultDeploymentNameTemplate, "Template of the names of Deployments of InferenceJobs without spec.deploymentName, executed with .JobName, .Namespace and .Version.")
+	flag.StringVar(&statefulSetNameTemplate, "statefulset-name-template", "", "Template of the names of StatefulSets of InferenceJobs without spec.deploymentName. The Deployment name is used if empty.")
+	flag.StringVar(&daemonSetNameTemplate, "daemonset-name-template", "", "Template of the names of DaemonSets of InferenceJobs without spec.deploymentName. The Deployment name is used if empty.")
+	flag.StringVar(&serviceNameTemplate, "service-name-template", "", "Template of the names of the headless Services of StatefulSets, e.g. {{.JobName}}-svc. The StatefulSet name is used if empty.")
+	flag.StringVar(&messageTemplatesConfigMap, "message-templates-configmap", "", "namespace/name of a ConfigMap of templates overriding Event and condition messages, keyed by reason. Built-in messages are used if empty.")
+	flag.StringVar(&mode, "mode", modeEnforce, "enforce to manage the Deployments of InferenceJobs, observe to only report the changes it would make in the PendingChanges condition.")
+	flag.StringVar(&enforceNamespaces, "enforce-namespaces", "", "Comma-separated namespaces managed even in observe mode.")
+	flag.IntVar(&namespaceWriteConcurrency, "namespace-write-concurrency", 0, "Maximum number of concurrent Deployment writes per namespace. Unlimited if 0.")
+	flag.StringVar(&hibernationConfigPath, "hibernation-config", "", "Path to the YAML or JSON config of the off-hours windows InferenceJobs are scaled to zero in. Hibernation is disabled if empty.")
+	flag.StringVar(&policyEndpoint, "policy-endpoint", "", "URL of an external policy endpoint rendered Deployments are posted to before they are created or updated. Disabled if empty.")
+	flag.StringVar(&policyFailurePolicy, "policy-failure-policy", policyFailureFail, "Fail to hold Deployments the policy endpoint couldn't review, Ignore to deploy them.")
+	flag.DurationVar(&policyTimeout, "policy-timeout", 5*time.Second, "Timeout of requests to the policy endpoint.")
+	flag.DurationVar(&policyCacheTTL, "policy-cache-ttl", 5*time.Minute, "How long policy decisions are reused while the rendered Deployment doesn't change.")
+	flag.StringVar(&retryBackoffs, "retry-backoffs", "", "Comma-separated class=base:max backoff curves of failed syncs overriding the defaults, e.g. quota=1m:1h. Classes are default, throttled, webhook, quota and conflict.")
+	flag.DurationVar(&retryBaseDelay, "retry-base-delay", 0, "Base delay of the default retry class, shorthand for --retry-backoffs default=base:max. Defaults to 5ms.")
+	flag.DurationVar(&retryMaxDelay, "retry-max-delay", 0, "Max delay of the default retry class. Defaults to 1000s.")
+	flag.Float64Var(&retryQPS, "retry-qps", defaultRetryQPS, "Overall rate of retries of failed syncs across all InferenceJobs, on top of their per-item backoff. Disabled if 0.")
+	flag.IntVar(&retryBurst, "retry-burst", defaultRetryBurst, "Burst of retries of failed syncs across all InferenceJobs.")
+	flag.StringVar(&eventLabelKeys, "event-label-keys", strings.Join(defaultEventLabelKeys, ","), "Comma-separated labels of InferenceJobs attached to their Events as annotations and logged with them. Disabled if empty.")
+	flag.StringVar(&metricsPushURL, "metrics-push-url", "", "Base URL of a Pushgateway compatible endpoint the metrics scraped from the pods of each InferenceJob are summed and pushed to. Disabled if empty.")
+	flag.DurationVar(&metricsPushInterval, "metrics-push-interval", time.Minute, "How often metrics are scraped and pushed.")
+	flag.IntVar(&metricsPushPort, "metrics-push-port", 8080, "Port the model server exposes metrics on for pushing.")
+	flag.StringVar(&metricsPushPath, "metrics-push-path", "/metrics", "HTTP path the model server exposes metrics on for pushing.")
+	flag.DurationVar(&pollInterval, "poll-interval", 0, "Poll the API server with LIST this often instead of watching, for restricted watch permissions or unreliable API servers. Watches are used if 0.")
+	flag.StringVar(&acceleratorNodeLabel, "accelerator-node-label", "nvidia.com/gpu.product", "Node label the GPU type of InferenceJobs is read from in their node selector.")
+	flag.StringVar(&acceleratorMemory, "accelerator-memory", "", "Comma-separated type=memory GPU memory sizes, e.g. Tesla-T4=16Gi, InferenceJobs are checked to fit spec.modelSizeBytes in. Disabled if empty.")
+	flag.DurationVar(&orphanSweepInterval, "orphan-sweep-interval", 0, "How often to remove the Services, HorizontalPodAutoscalers and ConfigMaps left behind by deleted InferenceJobs. Disabled if 0, see also the cleanup-orphans subcommand.")
+	flag.BoolVar(&orphanSweepDryRun, "orphan-sweep-dry-run", false, "Only log the orphaned resources found by the background sweep instead of removing them.")
+	flag.StringVar(&clusterDomain, "cluster-domain", defaultClusterDomain, "DNS domain of the cluster the addresses of InferenceJobs are reported in.")
+	flag.BoolVar(&watchPods, "watch-pods", true, "Watch the pods of InferenceJobs to report containers failing to start in their Degraded condition as soon as it happens.")
+	flag.IntVar(&workers, "workers", 2, "Number of InferenceJobs and InferenceJobSets synced concurrently.")
+	flag.DurationVar(&resyncPeriod, "resync-period", 30*time.Second, "How often the informers resync, making every InferenceJob sync again.")
+	flag.Float64Var(&kubeAPIQPS, "kube-api-qps", 5, "Queries per second to the API server.")
+	flag.IntVar(&kubeAPIBurst, "kube-api-burst", 10, "Burst of queries to the API server.")
+	flag.DurationVar(&kubeAPITimeout, "kube-api-timeout", 30*time.Second, "Timeout of requests to the API server other than the watches of the informers. No timeout if 0.")
+	flag.StringVar(&cleanupWebhookURL, "cleanup-webhook-url", "", "URL deleted InferenceJobs are posted to before they disappear, e.g. to deregister their model or flush caches. Their deletion waits for a 2xx response. Disabled if empty.")
+	flag.DurationVar(&cleanupWebhookTimeout, "cleanup-webhook-timeout", 10*time.Second, "Timeout of requests to the cleanup webhook.")
+	flag.StringVar(&watchNamespace, "namespace", metav1.NamespaceAll, "Namespace to watch and manage InferenceJobs in, e.g. to run a controller per tenant with a Role instead of a ClusterRole. All namespaces if empty.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Only log and record Events describing the Deployments that would be created, updated or deleted, without writing anything else, e.g. to validate a migration. InferenceJobSets and the model registry are not served.")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", defaultShutdownTimeout, "How long to keep syncing the queued InferenceJobs on shutdown before cancelling the syncs in progress.")
+	flag.DurationVar(&requeueInterval, "requeue-interval", 0, "Reconcile every InferenceJob again this long after its last sync to pick up external changes no watch reports. spec.reconcilePolicy.maxIntervalSeconds takes precedence. Disabled if 0.")
+	flag.IntVar(&maxRetries, "max-retries", 0, "Number of times a failing InferenceJob is retried before it is marked Failed and left alone until its spec changes. Retried forever if 0.")
+	flag.BoolVar(&traceAll, "trace", false, "Log each sync step of every InferenceJob with its context, as if they were all annotated with "+TraceAnnotation+"=true.")
+	flag.DurationVar(&syncTimeout, "sync-timeout", defaultSyncTimeout, "Deadline of a single sync of an InferenceJob. Deployment writes aren't started past it and the sync is retried. No deadline if 0.")
+	flag.DurationVar(&settleWindow, "settle-window", 0, "How long to wait after an InferenceJob is updated before syncing it, so a burst of updates, e.g. from CI, is synced once in its latest state. Synced right away if 0.")
+	flag.Int64Var(&listPageSize, "list-page-size", 500, "Number of Deployments per request when the informer lists them, so the initial list of a large cluster doesn't time out. Pages are read from etcd, if 0 every Deployment is listed at once from the watch cache of the API server.")
+	flag.IntVar(&shardCount, "shard-count", 1, "Number of controller replicas InferenceJobs are split between by the hash of their namespace/name. Every replica needs the same value and its own --shard-index.")
+	flag.IntVar(&shardIndex, "shard-index", 0, "Shard of the InferenceJobs this replica syncs, from 0 to --shard-count minus 1. The first shard also syncs InferenceJobSets and sweeps orphaned resources.")
+	flag.StringVar(&shardLeaseNamespace, "shard-lease-namespace", "default", "Namespace of the Leases shards hold to hand InferenceJobs over safely when --shard-count changes.")
+}
+
+// protobufConfig returns a copy of cfg talking protobuf to the API server,
+// cheaper to encode and decode than JSON for the Deployments, pods and
+// Events of every InferenceJob. Custom resources are only served as JSON,
+// the clientset of InferenceJobs keeps cfg.
+func protobufConfig(cfg *rest.Config) *rest.Config {
+	cfg = rest.CopyConfig(cfg)
+	cfg.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	cfg.ContentType = runtime.ContentTypeProtobuf
+	return cfg
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var out []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
 }
@@ -0,0 +1,157 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+// messageTemplateData is the data message templates are executed with.
+type messageTemplateData struct {
+	// Reason is the Event or condition reason the template is keyed by.
+	Reason string
+	// Message is the message built in by the controller.
+	Message   string
+	Namespace string
+	Name      string
+}
+
+// messageCatalog holds the text/template templates overriding Event and
+// condition messages, keyed by their reason, e.g.
+//
+//	ErrResourceExists: '{{.Message}}, see https://runbooks.example.com/{{.Reason}}'
+//
+// Messages without a template are left unchanged.
+type messageCatalog struct {
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+}
+
+func newMessageCatalog() *messageCatalog {
+	return &messageCatalog{templates: map[string]*template.Template{}}
+}
+
+// load replaces the templates with the given ones. Nothing is replaced if
+// any of them fails to parse.
+func (m *messageCatalog) load(data map[string]string) error {
+	templates := make(map[string]*template.Template, len(data))
+	for reason, text := range data {
+		tmpl, err := template.New(reason).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return fmt.Errorf("invalid message template for %s: %s", reason, err.Error())
+		}
+		templates[reason] = tmpl
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.templates = templates
+	return nil
+}
+
+// render returns the message to use for reason, falling back to message if
+// there is no template for it or it fails to execute.
+func (m *messageCatalog) render(reason, message string, object runtime.Object) string {
+	if m == nil {
+		return message
+	}
+	m.mu.RLock()
+	tmpl := m.templates[reason]
+	m.mu.RUnlock()
+	if tmpl == nil {
+		return message
+	}
+
+	data := messageTemplateData{Reason: reason, Message: message}
+	if accessor, err := meta.Accessor(object); err == nil {
+		data.Namespace = accessor.GetNamespace()
+		data.Name = accessor.GetName()
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		utilruntime.HandleError(fmt.Errorf("error executing message template for %s: %s", reason, err.Error()))
+		return message
+	}
+	return buf.String()
+}
+
+// syncFromConfigMap loads the templates from the data of a ConfigMap. The
+// built-in messages are restored when the ConfigMap is deleted, invalid
+// templates keep the previous ones in place.
+func (m *messageCatalog) syncFromConfigMap(kubeclientset kubernetes.Interface, namespace, name string) {
+	configMap, err := kubeclientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	data := map[string]string{}
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		utilruntime.HandleError(fmt.Errorf("error reading message templates from configmap %s/%s: %s", namespace, name, err.Error()))
+		return
+	default:
+		data = configMap.Data
+	}
+	if err := m.load(data); err != nil {
+		utilruntime.HandleError(fmt.Errorf("error loading message templates from configmap %s/%s: %s", namespace, name, err.Error()))
+		return
+	}
+	klog.V(4).Infof("Loaded %d message templates from configmap %s/%s", len(data), namespace, name)
+}
+
+// templatingRecorder renders the messages of the Events it records through
+// a messageCatalog and annotates them with the labels of the object among
+// labelKeys.
+type templatingRecorder struct {
+	record.EventRecorder
+	messages  *messageCatalog
+	labelKeys []string
+}
+
+func (r *templatingRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if annotations := eventLabelAnnotations(object, r.labelKeys); len(annotations) > 0 {
+		r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", r.messages.render(reason, message, object))
+		return
+	}
+	r.EventRecorder.Event(object, eventtype, reason, r.messages.render(reason, message, object))
+}
+
+func (r *templatingRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *templatingRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.EventRecorder.PastEventf(object, timestamp, eventtype, reason, "%s", r.messages.render(reason, fmt.Sprintf(messageFmt, args...), object))
+}
+
+func (r *templatingRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if labelAnnotations := eventLabelAnnotations(object, r.labelKeys); len(labelAnnotations) > 0 {
+		for k, v := range annotations {
+			labelAnnotations[k] = v
+		}
+		annotations = labelAnnotations
+	}
+	r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", r.messages.render(reason, fmt.Sprintf(messageFmt, args...), object))
+}
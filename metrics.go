@@ -0,0 +1,206 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog"
+)
+
+const (
+	metricsPath = "/metrics"
+
+	reconcileSuccess = "success"
+	reconcileError   = "error"
+)
+
+// reconcileDurationBuckets are the upper bounds, in seconds, of the buckets
+// of the reconcile duration histogram.
+var reconcileDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// controllerMetrics holds the counters and histograms of the controller,
+// exposed in the Prometheus text format by serveMetrics. The InferenceJob
+// counts are taken from the informer cache when scraped.
+type controllerMetrics struct {
+	mu                 sync.Mutex
+	reconciles         map[string]float64
+	durationBuckets    []float64
+	durationSum        float64
+	durationCount      float64
+	deploymentsCreated float64
+	deploymentsUpdated float64
+	statusConflicts    float64
+	// staleCacheObjects counts the objects of each resource the cache
+	// watchdog found lagging behind in its latest check.
+	staleCacheObjects map[string]float64
+}
+
+func newControllerMetrics() *controllerMetrics {
+	return &controllerMetrics{
+		reconciles:        map[string]float64{},
+		durationBuckets:   make([]float64, len(reconcileDurationBuckets)),
+		staleCacheObjects: map[string]float64{},
+	}
+}
+
+// observeReconcile records a sync of an InferenceJob and how long it took.
+func (m *controllerMetrics) observeReconcile(result string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconciles[result]++
+	seconds := d.Seconds()
+	for i, le := range reconcileDurationBuckets {
+		if seconds <= le {
+			m.durationBuckets[i]++
+		}
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+func (m *controllerMetrics) deploymentCreated() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deploymentsCreated++
+}
+
+func (m *controllerMetrics) deploymentUpdated() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deploymentsUpdated++
+}
+
+// observeStatusUpdate counts the status updates rejected because the
+// InferenceJob changed since it was read.
+func (m *controllerMetrics) observeStatusUpdate(err error) {
+	if !errors.IsConflict(err) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statusConflicts++
+}
+
+// observeStaleCache records the stale objects found by a check of the cache
+// watchdog, keyed by resource/namespace/name.
+func (m *controllerMetrics) observeStaleCache(stale []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, resource := range watchdogResources {
+		m.staleCacheObjects[resource] = 0
+	}
+	for _, key := range stale {
+		m.staleCacheObjects[strings.SplitN(key, "/", 2)[0]]++
+	}
+}
+
+// write writes the metrics in the Prometheus text format, along with the
+// number of InferenceJobs of every namespace.
+func (m *controllerMetrics) write(w io.Writer, inferenceJobs map[string]int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP inferencejob_reconciles_total Syncs of InferenceJobs by result.\n")
+	fmt.Fprintf(w, "# TYPE inferencejob_reconciles_total counter\n")
+	for _, result := range []string{reconcileSuccess, reconcileError} {
+		fmt.Fprintf(w, "inferencejob_reconciles_total{result=%q} %s\n", result, formatSample(m.reconciles[result]))
+	}
+
+	fmt.Fprintf(w, "# HELP inferencejob_reconcile_duration_seconds Duration of the syncs of InferenceJobs.\n")
+	fmt.Fprintf(w, "# TYPE inferencejob_reconcile_duration_seconds histogram\n")
+	for i, le := range reconcileDurationBuckets {
+		fmt.Fprintf(w, "inferencejob_reconcile_duration_seconds_bucket{le=%q} %s\n", formatSample(le), formatSample(m.durationBuckets[i]))
+	}
+	fmt.Fprintf(w, "inferencejob_reconcile_duration_seconds_bucket{le=\"+Inf\"} %s\n", formatSample(m.durationCount))
+	fmt.Fprintf(w, "inferencejob_reconcile_duration_seconds_sum %s\n", formatSample(m.durationSum))
+	fmt.Fprintf(w, "inferencejob_reconcile_duration_seconds_count %s\n", formatSample(m.durationCount))
+
+	fmt.Fprintf(w, "# HELP inferencejob_deployments_created_total Deployments created for InferenceJobs.\n")
+	fmt.Fprintf(w, "# TYPE inferencejob_deployments_created_total counter\n")
+	fmt.Fprintf(w, "inferencejob_deployments_created_total %s\n", formatSample(m.deploymentsCreated))
+	fmt.Fprintf(w, "# HELP inferencejob_deployments_updated_total Deployments of InferenceJobs patched.\n")
+	fmt.Fprintf(w, "# TYPE inferencejob_deployments_updated_total counter\n")
+	fmt.Fprintf(w, "inferencejob_deployments_updated_total %s\n", formatSample(m.deploymentsUpdated))
+	fmt.Fprintf(w, "# HELP inferencejob_status_update_conflicts_total Status updates of InferenceJobs that conflicted.\n")
+	fmt.Fprintf(w, "# TYPE inferencejob_status_update_conflicts_total counter\n")
+	fmt.Fprintf(w, "inferencejob_status_update_conflicts_total %s\n", formatSample(m.statusConflicts))
+	fmt.Fprintf(w, "# HELP inferencejob_stale_cache_objects Sampled objects whose cached copy lags behind the API server for longer than --cache-max-staleness.\n")
+	fmt.Fprintf(w, "# TYPE inferencejob_stale_cache_objects gauge\n")
+	for _, resource := range watchdogResources {
+		fmt.Fprintf(w, "inferencejob_stale_cache_objects{resource=%q} %s\n", resource, formatSample(m.staleCacheObjects[resource]))
+	}
+
+	namespaces := make([]string, 0, len(inferenceJobs))
+	for ns := range inferenceJobs {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	fmt.Fprintf(w, "# HELP inferencejobs InferenceJobs by namespace.\n")
+	fmt.Fprintf(w, "# TYPE inferencejobs gauge\n")
+	for _, ns := range namespaces {
+		fmt.Fprintf(w, "inferencejobs{namespace=%q} %d\n", ns, inferenceJobs[ns])
+	}
+}
+
+func formatSample(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// serveMetricsHTTP serves the metrics of the controller.
+func (c *Controller) serveMetricsHTTP(w http.ResponseWriter, r *http.Request) {
+	inferenceJobs, err := c.inferenceJobsLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	counts := map[string]int{}
+	for _, inferenceJob := range inferenceJobs {
+		counts[inferenceJob.Namespace]++
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.metrics.write(w, counts)
+}
+
+// serveMetrics serves the metrics of the controller over plain HTTP until
+// stopCh is closed.
+func serveMetrics(addr string, c *Controller, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, c.serveMetricsHTTP)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-stopCh
+		server.Close()
+	}()
+	go func() {
+		klog.Infof("Serving metrics on %s", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.Fatalf("Error serving metrics: %s", err.Error())
+		}
+	}()
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// metricsPusher scrapes the model server metrics of the pods of every
+// InferenceJob and pushes their sum per series to a Pushgateway compatible
+// endpoint, for clusters without Prometheus scraping the pods.
+type metricsPusher struct {
+	// url is the base URL of the endpoint. The metrics of a InferenceJob
+	// are put to <url>/metrics/job/inferencejob/namespace/<namespace>/inferencejob/<name>.
+	url      string
+	port     int
+	path     string
+	interval time.Duration
+	client   *http.Client
+}
+
+func newMetricsPusher(url string, port int, path string, interval time.Duration) *metricsPusher {
+	return &metricsPusher{
+		url:      strings.TrimSuffix(url, "/"),
+		port:     port,
+		path:     path,
+		interval: interval,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// metricFamilies sums the samples of the scraped pods per series, keeping
+// the TYPE of each metric.
+type metricFamilies struct {
+	types   map[string]string
+	samples map[string]float64
+}
+
+func newMetricFamilies() *metricFamilies {
+	return &metricFamilies{types: map[string]string{}, samples: map[string]float64{}}
+}
+
+// add parses metrics in the Prometheus text format and adds their samples.
+// Timestamps and unparsable lines are dropped.
+func (m *metricFamilies) add(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) == 4 && fields[1] == "TYPE" {
+				if _, ok := m.types[fields[2]]; !ok {
+					m.types[fields[2]] = fields[3]
+				}
+			}
+			continue
+		}
+		series, rest := line, ""
+		if i := strings.LastIndex(line, "}"); i >= 0 {
+			series, rest = line[:i+1], line[i+1:]
+		} else if i := strings.IndexAny(line, " \t"); i >= 0 {
+			series, rest = line[:i], line[i:]
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		m.samples[series] += v
+	}
+	return scanner.Err()
+}
+
+// write writes the summed samples in the Prometheus text format.
+func (m *metricFamilies) write(w io.Writer) {
+	series := make([]string, 0, len(m.samples))
+	for s := range m.samples {
+		series = append(series, s)
+	}
+	sort.Strings(series)
+	typed := map[string]bool{}
+	for _, s := range series {
+		name := s
+		if i := strings.Index(s, "{"); i >= 0 {
+			name = s[:i]
+		}
+		family := name
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if base := strings.TrimSuffix(name, suffix); base != name && m.types[base] != "" {
+				family = base
+			}
+		}
+		if t, ok := m.types[family]; ok && !typed[family] {
+			fmt.Fprintf(w, "# TYPE %s %s\n", family, t)
+			typed[family] = true
+		}
+		fmt.Fprintf(w, "%s %s\n", s, strconv.FormatFloat(m.samples[s], 'g', -1, 64))
+	}
+}
+
+// scrape adds the metrics of a pod.
+func (p *metricsPusher) scrape(pod *corev1.Pod, metrics *metricFamilies) error {
+	if pod.Status.PodIP == "" {
+		return fmt.Errorf("pod %s has no IP", pod.Name)
+	}
+	resp, err := p.client.Get(fmt.Sprintf("http://%s:%d%s", pod.Status.PodIP, p.port, p.path))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("scraping pod %s: unexpected status %d", pod.Name, resp.StatusCode)
+	}
+	return metrics.add(resp.Body)
+}
+
+// push replaces the metrics of the InferenceJob at the endpoint.
+func (p *metricsPusher) push(inferenceJob *samplev1alpha1.InferenceJob, metrics *metricFamilies) error {
+	body := &bytes.Buffer{}
+	metrics.write(body)
+	target := fmt.Sprintf("%s/metrics/job/inferencejob/namespace/%s/inferencejob/%s", p.url, url.PathEscape(inferenceJob.Namespace), url.PathEscape(inferenceJob.Name))
+	req, err := http.NewRequest(http.MethodPut, target, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// pushMetrics scrapes the running pods of every InferenceJob and pushes
+// their metrics. Pods failing to be scraped are skipped.
+func (c *Controller) pushMetrics() {
+	inferenceJobs, err := c.inferenceJobsLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, inferenceJob := range inferenceJobs {
+		if !c.shards.owns(inferenceJob.Namespace + "/" + inferenceJob.Name) {
+			continue
+		}
+		deploymentName, err := c.deploymentName(inferenceJob)
+		if err != nil {
+			continue
+		}
+		deployment, err := c.deploymentsLister.Deployments(inferenceJob.Namespace).Get(deploymentName)
+		if err != nil || !metav1.IsControlledBy(deployment, inferenceJob) {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+		if err != nil {
+			utilruntime.HandleError(err)
+			continue
+		}
+		pods, err := c.kubeclientset.CoreV1().Pods(deployment.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("error listing pods of inferenceJob %s/%s: %s", inferenceJob.Namespace, inferenceJob.Name, err.Error()))
+			continue
+		}
+		metrics := newMetricFamilies()
+		scraped := 0
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+				continue
+			}
+			if err := c.metricsPush.scrape(pod, metrics); err != nil {
+				klog.V(4).Infof("Skipping metrics of pod %s/%s: %s", pod.Namespace, pod.Name, err.Error())
+				continue
+			}
+			scraped++
+		}
+		if scraped == 0 {
+			continue
+		}
+		if err := c.metricsPush.push(inferenceJob, metrics); err != nil {
+			utilruntime.HandleError(fmt.Errorf("error pushing metrics of inferenceJob %s/%s: %s", inferenceJob.Namespace, inferenceJob.Name, err.Error()))
+		}
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/policy"
+)
+
+const (
+	// ErrModelTooLarge is used as part of the Event 'reason' when the model
+	// of a InferenceJob doesn't fit the memory of its GPUs.
+	ErrModelTooLarge = "ModelTooLarge"
+)
+
+// parseAcceleratorMemory parses a comma-separated list of type=memory GPU
+// memory sizes, e.g. Tesla-T4=16Gi.
+func parseAcceleratorMemory(nodeLabel, value string) (*policy.AcceleratorMemory, error) {
+	accelerators := &policy.AcceleratorMemory{NodeLabel: nodeLabel, Memory: map[string]resource.Quantity{}}
+	for _, entry := range splitList(value) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid accelerator memory %q, must be type=memory", entry)
+		}
+		memory, err := resource.ParseQuantity(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory of accelerator %s: %s", parts[0], err.Error())
+		}
+		accelerators.Memory[parts[0]] = memory
+	}
+	return accelerators, nil
+}
+
+// checkModelFit returns false if the model of the InferenceJob doesn't fit
+// the memory of its GPUs, in which case the InferenceJob is marked
+// ModelTooLarge rather than deployed with pods failing to load the model.
+func (c *Controller) checkModelFit(inferenceJob *samplev1alpha1.InferenceJob) (bool, error) {
+	if c.accelerators == nil {
+		return true, nil
+	}
+	msg := c.accelerators.ModelFit(inferenceJob)
+	if msg == "" {
+		return true, nil
+	}
+	condMsg := c.messages.render(ErrModelTooLarge, msg, inferenceJob)
+	if cond := getCondition(inferenceJob.Status, samplev1alpha1.ModelTooLarge); cond != nil && cond.Message == condMsg {
+		return false, nil
+	}
+	c.recorder.Event(inferenceJob, corev1.EventTypeWarning, ErrModelTooLarge, msg)
+
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	setCondition(&inferenceJobCopy.Status, newCondition(samplev1alpha1.ModelTooLarge, corev1.ConditionTrue, "InsufficientGPUMemory", condMsg))
+	_, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).UpdateStatus(inferenceJobCopy)
+	return false, err
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// deploymentNameIndex indexes InferenceJobs by the namespace/name key of
+	// the Deployment they manage.
+	deploymentNameIndex = "deploymentName"
+
+	// ErrNameConflict is used as part of the Event 'reason' when a
+	// InferenceJob fails to sync because another InferenceJob claimed its
+	// deployment name first.
+	ErrNameConflict = "NameConflict"
+	// MessageNameConflict is the message used for Events when a InferenceJob
+	// fails to sync because another InferenceJob claimed its deployment
+	// name first.
+	MessageNameConflict = "Deployment %q is already claimed by InferenceJob %q"
+)
+
+func indexByDeploymentName(obj interface{}) ([]string, error) {
+	inferenceJob, ok := obj.(*samplev1alpha1.InferenceJob)
+	if !ok || inferenceJob.Spec.DeploymentName == "" {
+		return nil, nil
+	}
+	return []string{inferenceJob.Namespace + "/" + inferenceJob.Spec.DeploymentName}, nil
+}
+
+// deploymentNameClaimant returns the InferenceJob the deployment name of
+// inferenceJob belongs to if that isn't inferenceJob itself. The claimant
+// controlling an existing Deployment keeps it, otherwise the oldest claimant
+// wins.
+func (c *Controller) deploymentNameClaimant(inferenceJob *samplev1alpha1.InferenceJob) (*samplev1alpha1.InferenceJob, error) {
+	objs, err := c.inferenceJobsIndexer.ByIndex(deploymentNameIndex, inferenceJob.Namespace+"/"+inferenceJob.Spec.DeploymentName)
+	if err != nil {
+		return nil, err
+	}
+	if len(objs) < 2 {
+		return nil, nil
+	}
+
+	var controllerRef *metav1.OwnerReference
+	deployment, err := c.deploymentsLister.Deployments(inferenceJob.Namespace).Get(inferenceJob.Spec.DeploymentName)
+	if err == nil {
+		controllerRef = metav1.GetControllerOf(deployment)
+	} else if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	var claimant *samplev1alpha1.InferenceJob
+	for _, obj := range objs {
+		other := obj.(*samplev1alpha1.InferenceJob)
+		if controllerRef != nil && controllerRef.UID == other.UID {
+			claimant = other
+			break
+		}
+		if claimant == nil || claimedBefore(other, claimant) {
+			claimant = other
+		}
+	}
+	if claimant.UID == inferenceJob.UID {
+		return nil, nil
+	}
+	return claimant, nil
+}
+
+// claimedBefore orders InferenceJobs by creation, breaking ties by name.
+func claimedBefore(a, b *samplev1alpha1.InferenceJob) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+// markNameConflict reports in the NameConflict condition that the deployment
+// name of inferenceJob is claimed by another InferenceJob. It isn't retried,
+// the conflict is checked again on the next resync of the InferenceJob.
+func (c *Controller) markNameConflict(inferenceJob *samplev1alpha1.InferenceJob, deploymentName string, claimant *samplev1alpha1.InferenceJob) error {
+	msg := fmt.Sprintf(MessageNameConflict, deploymentName, claimant.Name)
+	condMsg := c.messages.render("DeploymentNameClaimed", msg, inferenceJob)
+	if cond := getCondition(inferenceJob.Status, samplev1alpha1.NameConflict); cond != nil && cond.Message == condMsg {
+		return nil
+	}
+	c.recorder.Event(inferenceJob, corev1.EventTypeWarning, ErrNameConflict, msg)
+
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	setCondition(&inferenceJobCopy.Status, newCondition(samplev1alpha1.NameConflict, corev1.ConditionTrue, "DeploymentNameClaimed", condMsg))
+	_, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).UpdateStatus(inferenceJobCopy)
+	return err
+}
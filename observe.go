@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// modeEnforce makes the controller manage the Deployments of
+	// InferenceJobs.
+	modeEnforce = "enforce"
+	// modeObserve makes the controller only report what it would change,
+	// except in the namespaces enforced explicitly.
+	modeObserve = "observe"
+)
+
+const (
+	// DryRun is used as part of the Event 'reason' when the controller runs
+	// with --dry-run and would change the workloads of a InferenceJob.
+	DryRun = "DryRun"
+)
+
+// observing reports whether the workloads in the namespace are only
+// observed and never written to.
+func (c *Controller) observing(namespace string) bool {
+	return c.dryRun || c.observeOnly && !c.enforcedNamespaces[namespace]
+}
+
+// observeInferenceJob records the status of the InferenceJob from its
+// Deployment, which may not be controlled by it yet, and lists the changes
+// enforcing the InferenceJob would make in the PendingChanges condition.
+func (c *Controller) observeInferenceJob(inferenceJob, named *samplev1alpha1.InferenceJob) error {
+	var changes []string
+	var availableReplicas int32
+	var deploymentStatus appsv1.DeploymentStatus
+	var labelSelector string
+	deploymentName := named.Spec.DeploymentName
+	deployment, err := c.deploymentsLister.Deployments(inferenceJob.Namespace).Get(deploymentName)
+	switch {
+	case errors.IsNotFound(err):
+		changes = append(changes, fmt.Sprintf("create deployment %s", deploymentName))
+	case err != nil:
+		return err
+	default:
+		availableReplicas = deployment.Status.AvailableReplicas
+		deploymentStatus = deployment.Status
+		labelSelector = metav1.FormatLabelSelector(deployment.Spec.Selector)
+		if !metav1.IsControlledBy(deployment, inferenceJob) {
+			changes = append(changes, fmt.Sprintf("take over deployment %s", deploymentName))
+		}
+		desired := newDeployment(named)
+		preserveSelector(desired, deployment)
+		if desired.Spec.Replicas != nil && deployment.Spec.Replicas != nil && *desired.Spec.Replicas != *deployment.Spec.Replicas {
+			changes = append(changes, fmt.Sprintf("scale deployment %s from %d to %d replicas", deploymentName, *deployment.Spec.Replicas, *desired.Spec.Replicas))
+		}
+		if templateDrifted(desired, deployment) {
+			changes = append(changes, fmt.Sprintf("update the pod template of deployment %s", deploymentName))
+		}
+		if strategyDrifted(desired, deployment) {
+			changes = append(changes, fmt.Sprintf("update the rollout strategy of deployment %s", deploymentName))
+		}
+		if revisionHistoryLimitDrifted(desired, deployment) {
+			changes = append(changes, fmt.Sprintf("update the revision history limit of deployment %s", deploymentName))
+		}
+	}
+	superseded, err := c.supersededDeployments(inferenceJob, deploymentName)
+	if err != nil {
+		return err
+	}
+	for _, name := range superseded {
+		changes = append(changes, fmt.Sprintf("delete superseded deployment %s", name))
+	}
+
+	if c.dryRun {
+		// Nothing is written but Events, not even the status.
+		if len(changes) > 0 {
+			msg := "Would " + strings.Join(changes, ", ")
+			klog.Infof("Dry run: InferenceJob %s/%s: %s", inferenceJob.Namespace, inferenceJob.Name, msg)
+			c.recorder.Event(inferenceJob, corev1.EventTypeNormal, DryRun, msg)
+		}
+		return nil
+	}
+
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	inferenceJobCopy.Status.AvailableReplicas = availableReplicas
+	inferenceJobCopy.Status.ReadyReplicas = deploymentStatus.ReadyReplicas
+	inferenceJobCopy.Status.UpdatedReplicas = deploymentStatus.UpdatedReplicas
+	inferenceJobCopy.Status.UnavailableReplicas = deploymentStatus.UnavailableReplicas
+	inferenceJobCopy.Status.LabelSelector = labelSelector
+	removeCondition(&inferenceJobCopy.Status, samplev1alpha1.NameConflict)
+	c.setPolicyCondition(inferenceJobCopy)
+	if len(changes) > 0 {
+		setCondition(&inferenceJobCopy.Status, newCondition(samplev1alpha1.PendingChanges, corev1.ConditionTrue, "ObserveMode", "Would "+strings.Join(changes, ", ")))
+	} else {
+		setCondition(&inferenceJobCopy.Status, newCondition(samplev1alpha1.PendingChanges, corev1.ConditionFalse, "ObserveMode", ""))
+	}
+	return c.putInferenceJobStatus(inferenceJob, inferenceJobCopy)
+}
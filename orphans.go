@@ -0,0 +1,212 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
+)
+
+const (
+	// InferenceJobLabel is set on the Services, HorizontalPodAutoscalers and
+	// ConfigMaps created for an InferenceJob to its name, so they can be
+	// found again if the controller crashed before setting their owner
+	// reference.
+	InferenceJobLabel = "fabianoyoschitaki.io/inference-job"
+
+	// orphanMinAge is how old a resource must be before it's considered
+	// orphaned, so InferenceJobs being created aren't raced.
+	orphanMinAge = 10 * time.Minute
+)
+
+// orphan is a resource labeled for an InferenceJob that no longer exists.
+type orphan struct {
+	kind      string
+	namespace string
+	name      string
+	delete    func() error
+}
+
+// orphanSweeper removes the resources labeled with InferenceJobLabel whose
+// InferenceJob no longer exists. Resources controlled by anything else
+// than an InferenceJob are left alone.
+type orphanSweeper struct {
+	kubeclientset   kubernetes.Interface
+	sampleclientset clientset.Interface
+	// dryRun only logs the orphans found.
+	dryRun bool
+	minAge time.Duration
+	// namespace limits the sweep to a namespace, all namespaces if empty.
+	namespace string
+}
+
+func newOrphanSweeper(kubeclientset kubernetes.Interface, sampleclientset clientset.Interface, dryRun bool) *orphanSweeper {
+	return &orphanSweeper{
+		kubeclientset:   kubeclientset,
+		sampleclientset: sampleclientset,
+		dryRun:          dryRun,
+		minAge:          orphanMinAge,
+	}
+}
+
+// run sweeps the orphans in the background, errors are only logged.
+func (s *orphanSweeper) run() {
+	if _, err := s.sweep(); err != nil {
+		utilruntime.HandleError(fmt.Errorf("error sweeping orphaned resources: %s", err.Error()))
+	}
+}
+
+// sweep removes the orphans in all namespaces and returns them. Nothing is
+// removed in dry-run mode.
+func (s *orphanSweeper) sweep() ([]orphan, error) {
+	orphans, err := s.find(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orphans {
+		if s.dryRun {
+			klog.Infof("Would remove orphaned %s %s/%s (dry run)", o.kind, o.namespace, o.name)
+			continue
+		}
+		klog.Infof("Removing orphaned %s %s/%s", o.kind, o.namespace, o.name)
+		if err := o.delete(); err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("error removing orphaned %s %s/%s: %s", o.kind, o.namespace, o.name, err.Error())
+		}
+	}
+	return orphans, nil
+}
+
+// find lists the orphaned Services, HorizontalPodAutoscalers and
+// ConfigMaps.
+func (s *orphanSweeper) find(now time.Time) ([]orphan, error) {
+	opts := metav1.ListOptions{LabelSelector: InferenceJobLabel}
+	core := s.kubeclientset.CoreV1()
+	autoscaling := s.kubeclientset.AutoscalingV1()
+	// InferenceJobs are looked up once per sweep.
+	exists := map[string]bool{}
+	var orphans []orphan
+	check := func(kind string, meta metav1.Object, delete func() error) error {
+		if !s.orphaned(meta, now) {
+			return nil
+		}
+		key := meta.GetNamespace() + "/" + meta.GetLabels()[InferenceJobLabel]
+		found, ok := exists[key]
+		if !ok {
+			_, err := s.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(meta.GetNamespace()).Get(meta.GetLabels()[InferenceJobLabel], metav1.GetOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			found = err == nil
+			exists[key] = found
+		}
+		if !found {
+			orphans = append(orphans, orphan{kind: kind, namespace: meta.GetNamespace(), name: meta.GetName(), delete: delete})
+		}
+		return nil
+	}
+
+	services, err := core.Services(s.namespace).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range services.Items {
+		service := &services.Items[i]
+		err := check("Service", service, func() error {
+			return core.Services(service.Namespace).Delete(service.Name, nil)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	hpas, err := autoscaling.HorizontalPodAutoscalers(s.namespace).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hpas.Items {
+		hpa := &hpas.Items[i]
+		err := check("HorizontalPodAutoscaler", hpa, func() error {
+			return autoscaling.HorizontalPodAutoscalers(hpa.Namespace).Delete(hpa.Name, nil)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	configMaps, err := core.ConfigMaps(s.namespace).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range configMaps.Items {
+		configMap := &configMaps.Items[i]
+		err := check("ConfigMap", configMap, func() error {
+			return core.ConfigMaps(configMap.Namespace).Delete(configMap.Name, nil)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return orphans, nil
+}
+
+// orphaned reports whether the resource may be an orphan: it is old enough,
+// not being deleted and controlled by nothing but an InferenceJob.
+func (s *orphanSweeper) orphaned(meta metav1.Object, now time.Time) bool {
+	if meta.GetLabels()[InferenceJobLabel] == "" || meta.GetDeletionTimestamp() != nil {
+		return false
+	}
+	if now.Sub(meta.GetCreationTimestamp().Time) < s.minAge {
+		return false
+	}
+	if ref := metav1.GetControllerOf(meta); ref != nil && (ref.Kind != "InferenceJob" || ref.APIVersion != samplev1alpha1.SchemeGroupVersion.String()) {
+		return false
+	}
+	return true
+}
+
+// cleanupOrphans runs the cleanup-orphans subcommand, removing the orphans
+// once.
+func cleanupOrphans(kubeclientset kubernetes.Interface, sampleclientset clientset.Interface, args []string) error {
+	flags := flag.NewFlagSet("cleanup-orphans", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Only list the orphaned resources instead of removing them.")
+	minAge := flags.Duration("min-age", orphanMinAge, "Minimum age of the resources to consider orphaned.")
+	namespace := flags.String("namespace", metav1.NamespaceAll, "Namespace to look for orphaned resources in. All namespaces if empty.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sweeper := newOrphanSweeper(kubeclientset, sampleclientset, *dryRun)
+	sweeper.minAge = *minAge
+	sweeper.namespace = *namespace
+	orphans, err := sweeper.sweep()
+	if err != nil {
+		return err
+	}
+	verb := "Removed"
+	if *dryRun {
+		verb = "Found"
+	}
+	fmt.Printf("%s %d orphaned resources\n", verb, len(orphans))
+	return nil
+}
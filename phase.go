@@ -0,0 +1,44 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// inferenceJobPhase summarizes the lifecycle of an InferenceJob from its
+// conditions.
+func inferenceJobPhase(inferenceJob *samplev1alpha1.InferenceJob) samplev1alpha1.InferenceJobPhase {
+	conditionTrue := func(condType samplev1alpha1.InferenceJobConditionType) bool {
+		cond := getCondition(inferenceJob.Status, condType)
+		return cond != nil && cond.Status == corev1.ConditionTrue
+	}
+	switch {
+	case inferenceJob.DeletionTimestamp != nil:
+		return samplev1alpha1.PhaseTerminating
+	case conditionTrue(samplev1alpha1.Degraded), conditionTrue(samplev1alpha1.Failed):
+		return samplev1alpha1.PhaseFailed
+	case conditionTrue(samplev1alpha1.Available) && !conditionTrue(samplev1alpha1.Progressing):
+		return samplev1alpha1.PhaseRunning
+	case inferenceJob.Status.AvailableReplicas == 0:
+		return samplev1alpha1.PhasePending
+	default:
+		return samplev1alpha1.PhaseDeploying
+	}
+}
@@ -15,7 +15,7 @@ limitations under the License.
 */
 
 // +k8s:deepcopy-gen=package
-// +groupName=samplecontroller.k8s.io
+// +groupName=fabianoyoschitaki.io
 
 // Package v1alpha1 is the v1alpha1 version of the API.
 package v1alpha1
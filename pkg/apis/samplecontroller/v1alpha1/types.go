@@ -17,7 +17,10 @@ limitations under the License.
 package v1alpha1
 
 import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // +genclient
@@ -34,14 +37,603 @@ type InferenceJob struct {
 
 // InferenceJobSpec is the spec for a InferenceJob resource
 type InferenceJobSpec struct {
-	DeploymentName string `json:"deploymentName"`
+	// DeploymentName is the name of the generated Deployment. If empty, the
+	// name is rendered from the Deployment name template.
+	DeploymentName string `json:"deploymentName,omitempty"`
 	Replicas       *int32 `json:"replicas"`
 	ImageToDeploy  string `json:"imageToDeploy"`
+
+	// DedicatedNodes, when true, restricts the job's pods to a node group
+	// reserved for this InferenceJob. The pods tolerate the dedicated taint
+	// and select the dedicated label, both keyed by DedicatedNodeLabelKey
+	// with <namespace>.<name> of the InferenceJob as value. Values longer
+	// than 63 characters are truncated and suffixed with a hash.
+	DedicatedNodes bool `json:"dedicatedNodes,omitempty"`
+
+	// Alerting routes alerts about this InferenceJob to its owning team.
+	Alerting *AlertingSpec `json:"alerting,omitempty"`
+
+	// PrePullImages, when true, pulls a new image onto the target nodes
+	// before the Deployment is rolled out to it, so the rollout doesn't wait
+	// on image pulls.
+	PrePullImages bool `json:"prePullImages,omitempty"`
+
+	// GPUs is the number of nvidia.com/gpu devices requested by the
+	// inference container.
+	GPUs *int64 `json:"gpus,omitempty"`
+
+	// ThreadTuning, when true, sizes the thread pools of common runtimes
+	// (GOMAXPROCS, OpenMP, MKL, TensorFlow) to the CPU limit of the
+	// inference container instead of the CPU count of the node.
+	ThreadTuning bool `json:"threadTuning,omitempty"`
+
+	// NodeSelector is set on the generated pods to restrict them to
+	// matching nodes, e.g. a GPU node pool.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations are set on the generated pods so they can schedule onto
+	// tainted nodes, e.g. GPU nodes.
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity is set on the generated pods, e.g. to spread replicas across
+	// zones or co-locate them with feature store pods.
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// Autoscaling tunes how replica changes are applied.
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// Env is set on the inference container, e.g. the model path.
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// EnvFrom populates the environment of the inference container from
+	// ConfigMaps and Secrets, e.g. credentials.
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+
+	// Tier sets how much capacity is kept for the job: all replicas when
+	// hot (the default), a single replica when warm and none when cold.
+	// The Deployment is kept in every tier so it can be reactivated by
+	// changing the tier.
+	Tier InferenceTier `json:"tier,omitempty"`
+
+	// Volumes are added to the generated pods, e.g. a PVC holding the model
+	// or an emptyDir for scratch space.
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+
+	// VolumeMounts mount Volumes into the inference container.
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+
+	// ModelURI locates the model artifact served by the container. It is
+	// passed to the container in the MODEL_URI environment variable.
+	ModelURI string `json:"modelURI,omitempty"`
+
+	// AutoUpdate, if set, follows new model versions announced by the model
+	// registry for the model named by the ModelIDLabel label.
+	AutoUpdate *AutoUpdateSpec `json:"autoUpdate,omitempty"`
+
+	// HealthCheck is a shorthand deriving the readiness and liveness probes
+	// of the inference container from an HTTP endpoint. ReadinessProbe and
+	// LivenessProbe take precedence over it.
+	HealthCheck *HealthCheckSpec `json:"healthCheck,omitempty"`
+
+	// ReadinessProbe is set on the inference container.
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+
+	// LivenessProbe is set on the inference container.
+	LivenessProbe *corev1.Probe `json:"livenessProbe,omitempty"`
+
+	// ImagePullSecrets are set on the generated pods to pull images from
+	// private registries.
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// ServiceAccountName is the service account the generated pods run as,
+	// e.g. one bound to a cloud identity with access to the model store.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Ports are declared on the inference container so Services and probes
+	// can refer to them by name.
+	Ports []corev1.ContainerPort `json:"ports,omitempty"`
+
+	// Command overrides the entrypoint of the inference container image.
+	Command []string `json:"command,omitempty"`
+
+	// Args overrides the arguments of the inference container image, e.g.
+	// the model name, batch size or worker count.
+	Args []string `json:"args,omitempty"`
+
+	// NameTemplates override the controller's templates for the names of
+	// the generated objects. DeploymentName takes precedence over them.
+	NameTemplates *NameTemplates `json:"nameTemplates,omitempty"`
+
+	// PodLabels are added to the labels of the generated pods, on top of
+	// the labels of the InferenceJob itself.
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+
+	// PodAnnotations are added to the annotations of the generated pods.
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+
+	// DeletionPolicy decides what happens to the generated Deployments when
+	// the InferenceJob is deleted. Defaults to Delete.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// RetentionHours is how long Deployments retained by the Retain
+	// deletion policy are kept before they are removed. Defaults to 24.
+	RetentionHours int32 `json:"retentionHours,omitempty"`
+
+	// InitContainers run before the inference container, e.g. to fetch
+	// tokenizer files or warm caches.
+	InitContainers []corev1.Container `json:"initContainers,omitempty"`
+
+	// ReconcilePolicy tunes how often the InferenceJob is reconciled.
+	ReconcilePolicy *ReconcilePolicy `json:"reconcilePolicy,omitempty"`
+
+	// ExtraContainers run alongside the inference container, e.g. logging
+	// agents, metrics exporters or request proxies.
+	ExtraContainers []corev1.Container `json:"extraContainers,omitempty"`
+
+	// PriorityClassName is the priority class of the pods, letting
+	// production inference outrank batch workloads under node pressure.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// MinReplicasPerZone is the number of ready replicas every available
+	// zone keeps while another zone is out. The Deployment is scaled up
+	// temporarily to make up for replicas lost in the outage. It is ignored
+	// if the controller isn't allowed to watch nodes.
+	MinReplicasPerZone *int32 `json:"minReplicasPerZone,omitempty"`
+
+	// RuntimeClassName is the RuntimeClass the pods run with, e.g. nvidia
+	// on GPU nodes.
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+
+	// PostRolloutTest is run after each rollout of the Deployment. The
+	// InferenceJob only becomes Ready, and is only promoted, once it passes.
+	PostRolloutTest *PostRolloutTest `json:"postRolloutTest,omitempty"`
+
+	// SpreadTopologyKeys are node labels, e.g.
+	// failure-domain.beta.kubernetes.io/zone or kubernetes.io/hostname, the
+	// pods are spread across. The Kubernetes API the controller is built
+	// against predates topologySpreadConstraints, so spreading is rendered
+	// as preferred pod anti-affinity and is best effort.
+	SpreadTopologyKeys []string `json:"spreadTopologyKeys,omitempty"`
+
+	// ImagePullPolicy of the inference container. Defaults to Always for
+	// untagged images and the latest tag, IfNotPresent otherwise.
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	// TerminationGracePeriodSeconds is how long pods get to finish in-flight
+	// requests before they are killed on scale-down or rollout.
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// PreStop is run in the inference container before it is stopped, e.g.
+	// to sleep until the endpoints are updated or to drain requests.
+	PreStop *corev1.Handler `json:"preStop,omitempty"`
+
+	// Template is the base of the pod template of the Deployment, for pod
+	// settings the spec has no field for. The controller still sets the
+	// selector labels and the image of the first container, the inference
+	// container, which is added if missing. Fields set in the spec take
+	// precedence over the template.
+	Template *corev1.PodTemplateSpec `json:"template,omitempty"`
+
+	// Strategy is the rollout strategy of the Deployment, e.g. Recreate for
+	// models too large to run two copies per node. Defaults to a rolling
+	// update with 25% surge and unavailability.
+	Strategy *appsv1.DeploymentStrategy `json:"strategy,omitempty"`
+
+	// RevisionHistoryLimit is the number of old ReplicaSets of the
+	// Deployment to keep. Defaults to 10.
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// Transformer is a pre- and post-processing container run next to the
+	// inference container, e.g. for feature transformation.
+	Transformer *TransformerSpec `json:"transformer,omitempty"`
+
+	// DNSPolicy of the pods. Defaults to ClusterFirst.
+	DNSPolicy corev1.DNSPolicy `json:"dnsPolicy,omitempty"`
+
+	// DNSConfig adds nameservers, search domains and resolver options to
+	// the DNS config of the pods.
+	DNSConfig *corev1.PodDNSConfig `json:"dnsConfig,omitempty"`
+
+	// HostAliases are added to the hosts file of the pods, e.g. for
+	// internal registries missing from cluster DNS.
+	HostAliases []corev1.HostAlias `json:"hostAliases,omitempty"`
+
+	// SchedulerName hands the pods to a custom scheduler, e.g. a gang or
+	// GPU-aware one. Defaults to the default scheduler.
+	SchedulerName string `json:"schedulerName,omitempty"`
+
+	// WorkloadType is the kind of workload running the pods, Deployment,
+	// StatefulSet for stable network identities and per-replica volumes, or
+	// DaemonSet for one pod per node. Defaults to Deployment. Zone surges,
+	// pre-pulls, post-rollout tests and scale-down ordering only apply to
+	// Deployments, spec.replicas is ignored by DaemonSets.
+	WorkloadType WorkloadType `json:"workloadType,omitempty"`
+
+	// VolumeClaimTemplates are claimed once per replica, e.g. for model
+	// caches. Only used by StatefulSets.
+	VolumeClaimTemplates []corev1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
+
+	// ModelSizeBytes is the size of the model loaded onto the GPUs. The
+	// InferenceJob isn't deployed if it doesn't fit the memory of its GPUs.
+	// Set from the model registry for InferenceJobs following a model.
+	ModelSizeBytes *int64 `json:"modelSizeBytes,omitempty"`
+
+	// AdoptExisting lets the InferenceJob take over a Deployment of the same
+	// name that no controller owns, e.g. one created before it. Adoptions
+	// are reported with an Adopted Event. Without it, or if another owner
+	// controls the Deployment, an ErrResourceExists Event is reported
+	// instead and the sync retried.
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+
+	// Priority orders the syncs waiting in the controller's queue, higher
+	// first, e.g. so production InferenceJobs are reconciled before
+	// experiments after a controller restart or a mass update. InferenceJobs
+	// of the same priority are synced in the order they were queued.
+	// Defaults to 0, negative values are synced after the default.
+	Priority int32 `json:"priority,omitempty"`
+}
+
+// DedicatedNodeLabelKey is the node label and taint key used to reserve nodes
+// for a single InferenceJob when spec.dedicatedNodes is set.
+const DedicatedNodeLabelKey = "fabianoyoschitaki.io/dedicated"
+
+// ModelIDLabel identifies the registry model an InferenceJob serves.
+const ModelIDLabel = "fabianoyoschitaki.io/model-id"
+
+// RestartedAtAnnotation requests a rolling restart of the pods of an
+// InferenceJob, e.g. after a mounted model file changed in place. Its value,
+// usually a timestamp, is copied to the pod template, so every change rolls
+// the pods according to the rollout strategy. The restart subcommand of the
+// controller sets it on the InferenceJobs matching a label selector.
+const RestartedAtAnnotation = "samplecontroller.k8s.io/restartedAt"
+
+// AutoUpdateSpec selects the model versions an InferenceJob follows.
+type AutoUpdateSpec struct {
+	// Track is the registry stage to follow, e.g. "production". Versions
+	// announced without a stage are followed by jobs tracking "latest".
+	Track string `json:"track"`
+}
+
+// HealthCheckSpec describes the HTTP health endpoint of a model server.
+type HealthCheckSpec struct {
+	// Path is the HTTP path of the health endpoint, e.g. /healthz.
+	Path string `json:"path"`
+	// Port is the number or name of the container port the health endpoint
+	// is served on.
+	Port intstr.IntOrString `json:"port"`
+	// StartupSeconds is how long the model server may take to load its
+	// model before liveness failures restart it. Startup probes aren't
+	// available in the API version targeted, so this delays the liveness
+	// probe instead.
+	StartupSeconds int32 `json:"startupSeconds,omitempty"`
+}
+
+// NameTemplates are text/template templates for the names of the objects
+// generated for an InferenceJob. They are executed with .JobName,
+// .Namespace and .Version, the tag or digest of the image. Rendered names
+// longer than 63 characters are truncated and suffixed with a hash.
+type NameTemplates struct {
+	// Deployment is the template of the Deployment name, e.g.
+	// "{{.JobName}}-{{.Version}}" to roll out each version as a new
+	// Deployment. Deployments of previous versions are deleted once the
+	// current one is available.
+	Deployment string `json:"deployment,omitempty"`
+	// StatefulSet and DaemonSet are the templates of the workload name with
+	// spec.workloadType StatefulSet or DaemonSet. They default to the
+	// Deployment name.
+	StatefulSet string `json:"statefulSet,omitempty"`
+	DaemonSet   string `json:"daemonSet,omitempty"`
+	// Service is the template of the name of the headless Service of the
+	// StatefulSet, e.g. "{{.JobName}}-svc". It defaults to the StatefulSet
+	// name and is only read when the StatefulSet is created, its Service
+	// can't be changed later.
+	Service string `json:"service,omitempty"`
+}
+
+// TransformerSpec describes the transformer container of an InferenceJob.
+// It shares the pod, and so the network namespace, with the inference
+// container.
+type TransformerSpec struct {
+	// Image of the transformer.
+	Image   string   `json:"image"`
+	Command []string `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	// Env of the transformer. The inference container's env isn't passed
+	// on.
+	Env       []corev1.EnvVar             `json:"env,omitempty"`
+	Ports     []corev1.ContainerPort      `json:"ports,omitempty"`
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// ReconcilePolicy overrides the controller's reconcile timing for a single
+// InferenceJob.
+type ReconcilePolicy struct {
+	// MinIntervalSeconds is the least time between two reconciles. Changes
+	// made in between are applied once it has passed.
+	MinIntervalSeconds *int32 `json:"minIntervalSeconds,omitempty"`
+	// MaxIntervalSeconds is the most time between two reconciles, even if
+	// nothing changed.
+	MaxIntervalSeconds *int32 `json:"maxIntervalSeconds,omitempty"`
+	// DisableDriftCorrection stops the controller from reverting changes
+	// made to the pod template of the Deployment. Replica counts are still
+	// reconciled.
+	DisableDriftCorrection bool `json:"disableDriftCorrection,omitempty"`
+}
+
+// PostRolloutTest checks a rollout of an InferenceJob, either with an HTTP
+// request to one of its pods or by running a test Job. HTTP takes
+// precedence if both are set.
+type PostRolloutTest struct {
+	HTTP *HTTPRolloutTest `json:"http,omitempty"`
+	// Image is run as a Job, the test passes if the Job succeeds. The
+	// Deployment name and pod selector are passed in the
+	// INFERENCE_DEPLOYMENT and INFERENCE_SELECTOR environment variables.
+	Image string   `json:"image,omitempty"`
+	Args  []string `json:"args,omitempty"`
+	// TimeoutSeconds bounds the request or Job. Defaults to 60.
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// MaxAttempts is how often a failing test is run, with a backoff in
+	// between, before the revision is marked failed. Defaults to 3.
+	MaxAttempts int32 `json:"maxAttempts,omitempty"`
+}
+
+// HTTPRolloutTest sends a request to a pod of the rollout.
+type HTTPRolloutTest struct {
+	Path string `json:"path,omitempty"`
+	Port int32  `json:"port"`
+	// Method defaults to POST if a body is set and GET otherwise.
+	Method string `json:"method,omitempty"`
+	Body   string `json:"body,omitempty"`
+	// ExpectedStatus defaults to 200.
+	ExpectedStatus int32 `json:"expectedStatus,omitempty"`
+	// ExpectedBodyPattern is a regular expression the response body must
+	// match.
+	ExpectedBodyPattern string `json:"expectedBodyPattern,omitempty"`
+}
+
+// DeletionPolicy is what happens to the children of a deleted InferenceJob.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete garbage collects the children with the
+	// InferenceJob.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps the children running for the retention
+	// period. Recreating the InferenceJob within it adopts them again.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+)
+
+// WorkloadType is the kind of workload running the pods of an InferenceJob.
+type WorkloadType string
+
+const (
+	// WorkloadTypeDeployment runs the pods in a Deployment.
+	WorkloadTypeDeployment WorkloadType = "Deployment"
+	// WorkloadTypeStatefulSet runs the pods in a StatefulSet governed by a
+	// headless Service of the same name.
+	WorkloadTypeStatefulSet WorkloadType = "StatefulSet"
+	// WorkloadTypeDaemonSet runs one pod per node selected by the
+	// InferenceJob in a DaemonSet.
+	WorkloadTypeDaemonSet WorkloadType = "DaemonSet"
+)
+
+// InferenceTier is the capacity tier of an InferenceJob.
+type InferenceTier string
+
+const (
+	TierHot  InferenceTier = "hot"
+	TierWarm InferenceTier = "warm"
+	TierCold InferenceTier = "cold"
+)
+
+// AutoscalingSpec tunes how replica changes are applied to the Deployment.
+type AutoscalingSpec struct {
+	// DownscaleStabilizationSeconds delays replica reductions: a lower
+	// replica count is only applied once it has been requested for this
+	// long. Increases are applied right away.
+	DownscaleStabilizationSeconds *int32 `json:"downscaleStabilizationSeconds,omitempty"`
+}
+
+// AlertingSpec lists the receivers alerts for an InferenceJob are routed to.
+// The receivers are rendered as annotations on the Deployment and its pods
+// so PrometheusRule labels and Alertmanager routes can match on them.
+type AlertingSpec struct {
+	Receivers []AlertReceiver `json:"receivers,omitempty"`
+}
+
+// AlertReceiverType is the kind of destination of an AlertReceiver.
+type AlertReceiverType string
+
+const (
+	AlertReceiverEmail     AlertReceiverType = "email"
+	AlertReceiverSlack     AlertReceiverType = "slack"
+	AlertReceiverPagerDuty AlertReceiverType = "pagerduty"
+)
+
+// AlertReceiver is a single alert destination.
+type AlertReceiver struct {
+	Type AlertReceiverType `json:"type"`
+	// Target is the email address, Slack channel or PagerDuty routing key.
+	Target string `json:"target"`
 }
 
 // InferenceJobStatus is the status for a InferenceJob resource
 type InferenceJobStatus struct {
+	// Replicas is the number of pods the workload was last asked to run,
+	// after tiers, stabilization and zone surges were applied.
+	Replicas          int32 `json:"replicas,omitempty"`
 	AvailableReplicas int32 `json:"availableReplicas"`
+	// ReadyReplicas, UpdatedReplicas and UnavailableReplicas are copied
+	// from the status of the workload to follow the progress of rollouts.
+	ReadyReplicas       int32 `json:"readyReplicas,omitempty"`
+	UpdatedReplicas     int32 `json:"updatedReplicas,omitempty"`
+	UnavailableReplicas int32 `json:"unavailableReplicas,omitempty"`
+
+	// Conditions represent the latest available observations of the
+	// InferenceJob's state.
+	Conditions []InferenceJobCondition `json:"conditions,omitempty"`
+
+	// PendingScaleDown is a replica reduction held back by the downscale
+	// stabilization window.
+	PendingScaleDown *PendingScaleDown `json:"pendingScaleDown,omitempty"`
+
+	// ZoneSurge is the number of replicas added while a zone outage leaves
+	// other zones under spec.minReplicasPerZone.
+	ZoneSurge int32 `json:"zoneSurge,omitempty"`
+
+	// PostRolloutTest is the result of the latest post-rollout test.
+	PostRolloutTest *PostRolloutTestResult `json:"postRolloutTest,omitempty"`
+
+	// Resources lists the outcome of the latest sync of each child managed
+	// for the InferenceJob.
+	Resources []ResourceStatus `json:"resources,omitempty"`
+
+	// NumberReady is the number of nodes running a ready pod of the
+	// InferenceJob, for spec.workloadType DaemonSet.
+	NumberReady int32 `json:"numberReady,omitempty"`
+
+	// Phase summarizes the lifecycle of the InferenceJob.
+	Phase InferenceJobPhase `json:"phase,omitempty"`
+
+	// Address is the cluster DNS name of the Service in front of the
+	// InferenceJob, and URL the inference endpoint behind it. Both are
+	// empty while the InferenceJob isn't exposed by a Service.
+	Address string `json:"address,omitempty"`
+	URL     string `json:"url,omitempty"`
+
+	// LabelSelector selects the pods of the InferenceJob, in the string
+	// form used by the scale subresource.
+	LabelSelector string `json:"labelSelector,omitempty"`
+
+	// LastSyncTime is when the controller last converged the InferenceJob,
+	// and ObservedGeneration the generation of the InferenceJob it
+	// converged. The workload is up to date with the spec when the
+	// ObservedGeneration matches metadata.generation. Syncs that don't
+	// change the rest of the status only renew LastSyncTime every 5 minutes.
+	LastSyncTime       *metav1.Time `json:"lastSyncTime,omitempty"`
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	// DeploymentGeneration is the generation of the Deployment when the
+	// InferenceJob was last synced, and TemplateHash the hash of the pod
+	// template applied to the workload.
+	DeploymentGeneration int64  `json:"deploymentGeneration,omitempty"`
+	TemplateHash         string `json:"templateHash,omitempty"`
+	// DeploymentName is the name of the last Deployment of the InferenceJob
+	// to become fully available. It moves to a renamed Deployment once the
+	// previous one has been deleted.
+	DeploymentName string `json:"deploymentName,omitempty"`
+	// FailedGeneration is the generation of the InferenceJob the controller
+	// gave up syncing, see the Failed condition.
+	FailedGeneration int64 `json:"failedGeneration,omitempty"`
+}
+
+// InferenceJobPhase is a summary of the lifecycle of an InferenceJob.
+type InferenceJobPhase string
+
+const (
+	// PhasePending is set until the first pod is available.
+	PhasePending InferenceJobPhase = "Pending"
+	// PhaseDeploying is set while a rollout is in progress.
+	PhaseDeploying InferenceJobPhase = "Deploying"
+	// PhaseRunning is set once the latest rollout completed and the
+	// InferenceJob is available.
+	PhaseRunning InferenceJobPhase = "Running"
+	// PhaseFailed is set while the InferenceJob is Degraded, e.g. its pods
+	// crash or its rollout exceeded its progress deadline.
+	PhaseFailed InferenceJobPhase = "Failed"
+	// PhaseTerminating is set once the InferenceJob is being deleted.
+	PhaseTerminating InferenceJobPhase = "Terminating"
+)
+
+// ResourceStatus is the outcome of the latest sync of a child of an
+// InferenceJob.
+type ResourceStatus struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// LastAppliedHash is the hash of the pod template the child was last
+	// rendered from.
+	LastAppliedHash string      `json:"lastAppliedHash,omitempty"`
+	LastSyncTime    metav1.Time `json:"lastSyncTime"`
+	// LastError is the error of the latest sync, empty if it succeeded.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// PostRolloutTestResult records the outcome of a post-rollout test.
+type PostRolloutTestResult struct {
+	// Revision identifies the pod template tested.
+	Revision string `json:"revision"`
+	Passed   bool   `json:"passed"`
+	Message  string `json:"message,omitempty"`
+	// LatencyMilliseconds is how long the request or Job took.
+	LatencyMilliseconds int64       `json:"latencyMilliseconds"`
+	CompletedAt         metav1.Time `json:"completedAt"`
+	// Attempts is how often the revision was tested.
+	Attempts int32 `json:"attempts,omitempty"`
+}
+
+// PendingScaleDown records a replica reduction waiting for the downscale
+// stabilization window to pass.
+type PendingScaleDown struct {
+	// Replicas is the pending target.
+	Replicas int32 `json:"replicas"`
+	// Since is when the target was first observed.
+	Since metav1.Time `json:"since"`
+}
+
+// InferenceJobConditionType is a valid value for InferenceJobCondition.Type
+type InferenceJobConditionType string
+
+const (
+	// PolicyViolations is true when the spec violates one or more of the
+	// controller's lint policies. The message lists the violations.
+	PolicyViolations InferenceJobConditionType = "PolicyViolations"
+	// NameConflict is true when another InferenceJob in the namespace
+	// claimed the same deployment name first. The InferenceJob isn't synced
+	// while the condition holds.
+	NameConflict InferenceJobConditionType = "NameConflict"
+	// Ready is true when the workload of the InferenceJob is available
+	// and, for InferenceJobs with a post-rollout test, the latest rollout
+	// completed and passed it.
+	Ready InferenceJobConditionType = "Ready"
+	// Available mirrors the Available condition of the Deployment, or is
+	// true once all pods of a StatefulSet or DaemonSet are ready.
+	Available InferenceJobConditionType = "Available"
+	// Progressing is true while a rollout is in progress.
+	Progressing InferenceJobConditionType = "Progressing"
+	// Degraded is true when the rollout exceeded its progress deadline or
+	// the InferenceJob failed to sync repeatedly. The message holds the
+	// latest error.
+	Degraded InferenceJobConditionType = "Degraded"
+	// Failed is true when the InferenceJob failed to sync more than the
+	// controller's maximum number of retries. The message holds the last
+	// error. It isn't synced again until its spec changes.
+	Failed InferenceJobConditionType = "Failed"
+	// PendingChanges is true when the controller runs in observe mode and
+	// would change the Deployment of the InferenceJob. The message lists
+	// the changes.
+	PendingChanges InferenceJobConditionType = "PendingChanges"
+	// PolicyDenied is true when the external policy endpoint denied the
+	// Deployment rendered for the InferenceJob, or couldn't review it and
+	// the controller fails closed. The Deployment isn't created or updated
+	// while the condition holds.
+	PolicyDenied InferenceJobConditionType = "PolicyDenied"
+	// ModelTooLarge is true when spec.modelSizeBytes exceeds the memory of
+	// the GPUs of the InferenceJob. The Deployment isn't created or updated
+	// while the condition holds.
+	ModelTooLarge InferenceJobConditionType = "ModelTooLarge"
+)
+
+// InferenceJobCondition describes the state of a InferenceJob at a certain point.
+type InferenceJobCondition struct {
+	// Type of the condition.
+	Type InferenceJobConditionType `json:"type"`
+	// Status of the condition, one of True, False, Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+	// Last time the condition transitioned from one status to another.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// The reason for the condition's last transition.
+	Reason string `json:"reason,omitempty"`
+	// A human readable message indicating details about the transition.
+	Message string `json:"message,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -53,3 +645,55 @@ type InferenceJobList struct {
 
 	Items []InferenceJob `json:"items"`
 }
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// InferenceJobSet is a specification for a InferenceJobSet resource, a group
+// of InferenceJobs rolled out, reported on and deleted as a single unit.
+type InferenceJobSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InferenceJobSetSpec   `json:"spec"`
+	Status InferenceJobSetStatus `json:"status"`
+}
+
+// InferenceJobSetSpec is the spec for a InferenceJobSet resource
+type InferenceJobSetSpec struct {
+	// Defaults holds spec fields shared by all jobs. A field left empty on a
+	// job takes its value from Defaults.
+	Defaults InferenceJobSpec `json:"defaults,omitempty"`
+	// Jobs are rolled out in order: a job is only created or updated once all
+	// jobs listed before it are available.
+	Jobs []InferenceJobSetMember `json:"jobs"`
+}
+
+// InferenceJobSetMember is a single InferenceJob of a InferenceJobSet. The
+// InferenceJob is named <set name>-<member name>.
+type InferenceJobSetMember struct {
+	Name string           `json:"name"`
+	Spec InferenceJobSpec `json:"spec"`
+	// Clear lists spec fields, by their JSON name, the member sets to their
+	// empty value instead of taking them from the set defaults, e.g.
+	// dedicatedNodes to turn off a default of true.
+	Clear []string `json:"clear,omitempty"`
+}
+
+// InferenceJobSetStatus is the status for a InferenceJobSet resource
+type InferenceJobSetStatus struct {
+	// ReadyJobs is the number of jobs whose replicas are all available.
+	ReadyJobs int32 `json:"readyJobs"`
+	// Ready is true once every job of the set is ready.
+	Ready bool `json:"ready"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// InferenceJobSetList is a list of InferenceJobSet resources
+type InferenceJobSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []InferenceJobSet `json:"items"`
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package builder assembles InferenceJobs programmatically, e.g.
+//
+//	job, err := builder.NewInferenceJob("resnet").
+//		Namespace("vision").
+//		Image("registry.example.com/resnet:1.4").
+//		Replicas(3).
+//		GPU(1).
+//		Build()
+//
+// Build validates the InferenceJob, so required fields can't be missed.
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// Builder builds an InferenceJob. Its methods return the Builder so calls
+// can be chained, and record errors reported by Build.
+type Builder struct {
+	job *samplev1alpha1.InferenceJob
+}
+
+// NewInferenceJob starts an InferenceJob with the given name in the default
+// namespace, running one replica.
+func NewInferenceJob(name string) *Builder {
+	replicas := int32(1)
+	return &Builder{job: &samplev1alpha1.InferenceJob{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: samplev1alpha1.SchemeGroupVersion.String(),
+			Kind:       "InferenceJob",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: metav1.NamespaceDefault,
+		},
+		Spec: samplev1alpha1.InferenceJobSpec{
+			Replicas: &replicas,
+		},
+	}}
+}
+
+// Namespace sets the namespace of the InferenceJob.
+func (b *Builder) Namespace(namespace string) *Builder {
+	b.job.Namespace = namespace
+	return b
+}
+
+// Label adds a label to the InferenceJob.
+func (b *Builder) Label(key, value string) *Builder {
+	if b.job.Labels == nil {
+		b.job.Labels = map[string]string{}
+	}
+	b.job.Labels[key] = value
+	return b
+}
+
+// Image sets the image serving the model. It is required.
+func (b *Builder) Image(image string) *Builder {
+	b.job.Spec.ImageToDeploy = image
+	return b
+}
+
+// Replicas sets the number of replicas.
+func (b *Builder) Replicas(replicas int32) *Builder {
+	b.job.Spec.Replicas = &replicas
+	return b
+}
+
+// GPU sets the number of GPUs of every replica.
+func (b *Builder) GPU(gpus int64) *Builder {
+	b.job.Spec.GPUs = &gpus
+	return b
+}
+
+// Tier sets the serving tier.
+func (b *Builder) Tier(tier samplev1alpha1.InferenceTier) *Builder {
+	b.job.Spec.Tier = tier
+	return b
+}
+
+// ModelURI sets the location the model is loaded from.
+func (b *Builder) ModelURI(uri string) *Builder {
+	b.job.Spec.ModelURI = uri
+	return b
+}
+
+// DeploymentName sets the name of the generated Deployment.
+func (b *Builder) DeploymentName(name string) *Builder {
+	b.job.Spec.DeploymentName = name
+	return b
+}
+
+// Env adds an environment variable to the inference container.
+func (b *Builder) Env(name, value string) *Builder {
+	b.job.Spec.Env = append(b.job.Spec.Env, corev1.EnvVar{Name: name, Value: value})
+	return b
+}
+
+// Port exposes a port of the inference container.
+func (b *Builder) Port(name string, port int32) *Builder {
+	b.job.Spec.Ports = append(b.job.Spec.Ports, corev1.ContainerPort{Name: name, ContainerPort: port, Protocol: corev1.ProtocolTCP})
+	return b
+}
+
+// NodeSelector adds a node label the pods must be scheduled on.
+func (b *Builder) NodeSelector(key, value string) *Builder {
+	if b.job.Spec.NodeSelector == nil {
+		b.job.Spec.NodeSelector = map[string]string{}
+	}
+	b.job.Spec.NodeSelector[key] = value
+	return b
+}
+
+// Build validates and returns the InferenceJob. The Builder must not be
+// used afterwards.
+func (b *Builder) Build() (*samplev1alpha1.InferenceJob, error) {
+	if err := Validate(b.job); err != nil {
+		return nil, err
+	}
+	return b.job, nil
+}
+
+// Validate checks the fields of the InferenceJob the controller can't do
+// without.
+func Validate(job *samplev1alpha1.InferenceJob) error {
+	var errs []error
+	if msgs := validation.IsDNS1123Subdomain(job.Name); len(msgs) > 0 {
+		errs = append(errs, fmt.Errorf("invalid name %q: %s", job.Name, strings.Join(msgs, ", ")))
+	}
+	if msgs := validation.IsDNS1123Label(job.Namespace); len(msgs) > 0 {
+		errs = append(errs, fmt.Errorf("invalid namespace %q: %s", job.Namespace, strings.Join(msgs, ", ")))
+	}
+	spec := job.Spec
+	if spec.ImageToDeploy == "" {
+		errs = append(errs, fmt.Errorf("image is required"))
+	}
+	if spec.Replicas != nil && *spec.Replicas < 0 {
+		errs = append(errs, fmt.Errorf("replicas must not be negative, got %d", *spec.Replicas))
+	}
+	if spec.GPUs != nil && *spec.GPUs < 0 {
+		errs = append(errs, fmt.Errorf("gpus must not be negative, got %d", *spec.GPUs))
+	}
+	switch spec.Tier {
+	case "", samplev1alpha1.TierHot, samplev1alpha1.TierWarm, samplev1alpha1.TierCold:
+	default:
+		errs = append(errs, fmt.Errorf("invalid tier %q", spec.Tier))
+	}
+	if spec.DeploymentName != "" {
+		if msgs := validation.IsDNS1123Label(spec.DeploymentName); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid deployment name %q: %s", spec.DeploymentName, strings.Join(msgs, ", ")))
+		}
+	}
+	for _, env := range spec.Env {
+		if env.Name == "" {
+			errs = append(errs, fmt.Errorf("environment variables must be named"))
+		}
+	}
+	for _, port := range spec.Ports {
+		if msgs := validation.IsValidPortNum(int(port.ContainerPort)); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid port %d: %s", port.ContainerPort, strings.Join(msgs, ", ")))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	// Keys of the Secret holding the CA and serving certificate.
+	caCertKey      = "ca.crt"
+	caKeyKey       = "ca.key"
+	servingCertKey = corev1.TLSCertKey
+	servingKeyKey  = corev1.TLSPrivateKeyKey
+	// previousCACertKey holds the CA replaced by the last rotation. It stays
+	// in the CA bundle until it expires so serving certificates it signed,
+	// e.g. those of replicas that haven't picked up the rotation yet, are
+	// still trusted.
+	previousCACertKey = "ca-previous.crt"
+)
+
+// Rotator maintains a self-signed CA and a serving certificate in a Secret,
+// renewing them before they expire and patching the CA bundle into the named
+// webhook configurations. The CA bundle carries the previous CA as well
+// until it expires. The current serving certificate is exposed through
+// GetCertificate so TLS servers pick up rotations without restarting.
+type Rotator struct {
+	// Client is used to read and write the Secret and webhook configurations.
+	Client kubernetes.Interface
+	// Namespace and SecretName identify the Secret storing the certificates.
+	Namespace  string
+	SecretName string
+	// DNSNames are the names the serving certificate is valid for. The first
+	// one is used as the certificate common name.
+	DNSNames []string
+	// ValidatingWebhooks and MutatingWebhooks name the webhook
+	// configurations whose CA bundle is kept in sync with the CA.
+	ValidatingWebhooks []string
+	MutatingWebhooks   []string
+	// CAValidity and CertValidity are the lifetimes of newly issued
+	// certificates, and RefreshBefore is how long before expiry they are
+	// renewed.
+	CAValidity    time.Duration
+	CertValidity  time.Duration
+	RefreshBefore time.Duration
+
+	mu      sync.RWMutex
+	current *tls.Certificate
+}
+
+// NewRotator returns a Rotator with default certificate lifetimes.
+func NewRotator(client kubernetes.Interface, namespace, secretName string, dnsNames []string) *Rotator {
+	return &Rotator{
+		Client:        client,
+		Namespace:     namespace,
+		SecretName:    secretName,
+		DNSNames:      dnsNames,
+		CAValidity:    10 * 365 * 24 * time.Hour,
+		CertValidity:  365 * 24 * time.Hour,
+		RefreshBefore: 30 * 24 * time.Hour,
+	}
+}
+
+// Run checks the certificates every interval until stopCh is closed. It
+// performs the first check synchronously and returns its error so callers
+// can refuse to start serving without a certificate.
+func (r *Rotator) Run(interval time.Duration, stopCh <-chan struct{}) error {
+	if len(r.DNSNames) == 0 {
+		return fmt.Errorf("certificate rotator requires at least one DNS name")
+	}
+	if err := r.sync(); err != nil {
+		return err
+	}
+	go wait.Until(func() {
+		if err := r.sync(); err != nil {
+			utilruntime.HandleError(fmt.Errorf("error rotating certificates: %s", err.Error()))
+		}
+	}, interval, stopCh)
+	return nil
+}
+
+// GetCertificate returns the current serving certificate. It is meant to be
+// used as tls.Config.GetCertificate.
+func (r *Rotator) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.current == nil {
+		return nil, fmt.Errorf("no serving certificate available yet")
+	}
+	return r.current, nil
+}
+
+// sync ensures the Secret holds a valid CA and serving certificate, then
+// loads the serving certificate and propagates the CA bundle. Another
+// replica writing the Secret first isn't an error, its certificates are
+// used instead.
+func (r *Rotator) sync() error {
+	err := r.syncSecret()
+	if errors.IsAlreadyExists(err) || errors.IsConflict(err) {
+		klog.V(2).Infof("Secret %s/%s was written concurrently, reading it again", r.Namespace, r.SecretName)
+		err = r.syncSecret()
+	}
+	return err
+}
+
+func (r *Rotator) syncSecret() error {
+	secret, err := r.Client.CoreV1().Secrets(r.Namespace).Get(r.SecretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: r.SecretName, Namespace: r.Namespace},
+			Type:       corev1.SecretTypeTLS,
+		}
+	} else if err != nil {
+		return err
+	}
+
+	data := secret.Data
+	if data == nil {
+		data = map[string][]byte{}
+	}
+	ca := &KeyPair{Cert: data[caCertKey], Key: data[caKeyKey]}
+	serving := &KeyPair{Cert: data[servingCertKey], Key: data[servingKeyKey]}
+	previousCA := data[previousCACertKey]
+	changed := false
+
+	if ca.expiresWithin(r.RefreshBefore) {
+		klog.Infof("Generating new CA in secret %s/%s", r.Namespace, r.SecretName)
+		previousCA = ca.Cert
+		if ca, err = newCA(r.DNSNames[0]+"-ca", r.CAValidity); err != nil {
+			return err
+		}
+		// A new CA invalidates the serving certificate as well.
+		serving = &KeyPair{}
+		changed = true
+	}
+	if len(previousCA) > 0 && certExpiresWithin(previousCA, 0) {
+		previousCA = nil
+		changed = true
+	}
+	if serving.expiresWithin(r.RefreshBefore) || !serving.covers(r.DNSNames) {
+		klog.Infof("Generating new serving certificate in secret %s/%s", r.Namespace, r.SecretName)
+		if serving, err = newServingCert(ca, r.DNSNames, r.CertValidity); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if changed {
+		secret = secret.DeepCopy()
+		secret.Data = map[string][]byte{
+			caCertKey:      ca.Cert,
+			caKeyKey:       ca.Key,
+			servingCertKey: serving.Cert,
+			servingKeyKey:  serving.Key,
+		}
+		if len(previousCA) > 0 {
+			secret.Data[previousCACertKey] = previousCA
+		}
+		if secret.ResourceVersion == "" {
+			_, err = r.Client.CoreV1().Secrets(r.Namespace).Create(secret)
+		} else {
+			_, err = r.Client.CoreV1().Secrets(r.Namespace).Update(secret)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	cert, err := tls.X509KeyPair(serving.Cert, serving.Key)
+	if err != nil {
+		return err
+	}
+	// Clients trust the new CA before it is served.
+	if err := r.injectCABundle(append(append([]byte{}, ca.Cert...), previousCA...)); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.current = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// injectCABundle sets caBundle on every webhook of the configured webhook
+// configurations that doesn't already carry it.
+func (r *Rotator) injectCABundle(caBundle []byte) error {
+	admission := r.Client.AdmissionregistrationV1beta1()
+	for _, name := range r.ValidatingWebhooks {
+		cfg, err := admission.ValidatingWebhookConfigurations().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		changed := false
+		cfg = cfg.DeepCopy()
+		for i := range cfg.Webhooks {
+			if !bytes.Equal(cfg.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				cfg.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if changed {
+			if _, err := admission.ValidatingWebhookConfigurations().Update(cfg); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range r.MutatingWebhooks {
+		cfg, err := admission.MutatingWebhookConfigurations().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		changed := false
+		cfg = cfg.DeepCopy()
+		for i := range cfg.Webhooks {
+			if !bytes.Equal(cfg.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				cfg.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if changed {
+			if _, err := admission.MutatingWebhookConfigurations().Update(cfg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
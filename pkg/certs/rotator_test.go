@@ -0,0 +1,182 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"bytes"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	admissionv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+)
+
+const (
+	testNamespace = "sample-controller"
+	testSecret    = "webhook-certs"
+	testWebhook   = "inferencejobs"
+)
+
+func newTestRotator(objects ...runtime.Object) (*Rotator, *fake.Clientset) {
+	webhook := &admissionv1beta1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: testWebhook},
+		Webhooks:   []admissionv1beta1.Webhook{{Name: "validate.inferencejobs.example.com"}},
+	}
+	client := fake.NewSimpleClientset(append(objects, webhook)...)
+	r := NewRotator(client, testNamespace, testSecret, []string{"webhook.sample-controller.svc"})
+	r.ValidatingWebhooks = []string{testWebhook}
+	return r, client
+}
+
+// newTestSecret returns a Secret holding a CA valid for caValidity and a
+// serving certificate signed by it.
+func newTestSecret(t *testing.T, caValidity time.Duration) (*corev1.Secret, *KeyPair) {
+	ca, err := newCA("test-ca", caValidity)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	serving, err := newServingCert(ca, []string{"webhook.sample-controller.svc"}, caValidity)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: testSecret, Namespace: testNamespace, ResourceVersion: "1"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			caCertKey:      ca.Cert,
+			caKeyKey:       ca.Key,
+			servingCertKey: serving.Cert,
+			servingKeyKey:  serving.Key,
+		},
+	}, serving
+}
+
+func getSecret(t *testing.T, client *fake.Clientset) *corev1.Secret {
+	secret, err := client.CoreV1().Secrets(testNamespace).Get(testSecret, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return secret
+}
+
+func getCABundle(t *testing.T, client *fake.Clientset) []byte {
+	cfg, err := client.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(testWebhook, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return cfg.Webhooks[0].ClientConfig.CABundle
+}
+
+func TestRotatorCreatesSecret(t *testing.T) {
+	r, client := newTestRotator()
+	if err := r.sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret := getSecret(t, client)
+	if _, ok := secret.Data[previousCACertKey]; ok {
+		t.Errorf("expected no previous CA in a new secret")
+	}
+	if bundle := getCABundle(t, client); !bytes.Equal(bundle, secret.Data[caCertKey]) {
+		t.Errorf("expected the CA bundle to be the CA, got %q", bundle)
+	}
+	if cert, err := r.GetCertificate(nil); err != nil || cert == nil {
+		t.Errorf("expected a serving certificate, got %v, %v", cert, err)
+	}
+}
+
+func TestRotatorKeepsPreviousCA(t *testing.T) {
+	// The CA expires within RefreshBefore and is rotated.
+	old, _ := newTestSecret(t, 24*time.Hour)
+	r, client := newTestRotator(old)
+	if err := r.sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret := getSecret(t, client)
+	if bytes.Equal(secret.Data[caCertKey], old.Data[caCertKey]) {
+		t.Fatalf("expected the CA to be rotated")
+	}
+	if !bytes.Equal(secret.Data[previousCACertKey], old.Data[caCertKey]) {
+		t.Errorf("expected the replaced CA to be kept in the secret")
+	}
+	expected := append(append([]byte{}, secret.Data[caCertKey]...), old.Data[caCertKey]...)
+	if bundle := getCABundle(t, client); !bytes.Equal(bundle, expected) {
+		t.Errorf("expected the CA bundle to carry the new and the previous CA, got %q", bundle)
+	}
+}
+
+func TestRotatorDropsExpiredPreviousCA(t *testing.T) {
+	secret, _ := newTestSecret(t, 365*24*time.Hour)
+	expired, err := newCA("expired-ca", -time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret.Data[previousCACertKey] = expired.Cert
+	r, client := newTestRotator(secret)
+	if err := r.sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated := getSecret(t, client)
+	if _, ok := updated.Data[previousCACertKey]; ok {
+		t.Errorf("expected the expired previous CA to be removed")
+	}
+	if !bytes.Equal(updated.Data[caCertKey], secret.Data[caCertKey]) {
+		t.Errorf("expected the valid CA to be kept")
+	}
+	if bundle := getCABundle(t, client); !bytes.Equal(bundle, secret.Data[caCertKey]) {
+		t.Errorf("expected the CA bundle to be the CA, got %q", bundle)
+	}
+}
+
+func TestRotatorConcurrentCreate(t *testing.T) {
+	r, client := newTestRotator()
+	// Another replica creates the secret between the Get and the Create.
+	winner, serving := newTestSecret(t, 365*24*time.Hour)
+	client.PrependReactor("create", "secrets", func(action core.Action) (bool, runtime.Object, error) {
+		if err := client.Tracker().Add(winner); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return true, nil, errors.NewAlreadyExists(schema.GroupResource{Resource: "secrets"}, testSecret)
+	})
+	if err := r.sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(cert.Certificate[0], mustDecode(t, serving.Cert)) {
+		t.Errorf("expected the serving certificate of the other replica to be used")
+	}
+	if bundle := getCABundle(t, client); !bytes.Equal(bundle, winner.Data[caCertKey]) {
+		t.Errorf("expected the CA of the other replica in the CA bundle, got %q", bundle)
+	}
+}
+
+func mustDecode(t *testing.T, certPEM []byte) []byte {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatalf("failed to decode certificate PEM")
+	}
+	return block.Bytes
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bulk applies changes to many InferenceJobs at once, for platform
+// automation scripts.
+package bulk
+
+import (
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
+)
+
+// DefaultConcurrency is the number of InferenceJobs updated in parallel when
+// a Client is created with a concurrency below 1.
+const DefaultConcurrency = 5
+
+// Result is the outcome of a bulk operation for a single InferenceJob.
+type Result struct {
+	Namespace string
+	Name      string
+	// Err is nil if the InferenceJob was updated.
+	Err error
+}
+
+// Client runs bulk operations on the InferenceJobs matching a label
+// selector.
+type Client struct {
+	client      clientset.Interface
+	concurrency int
+}
+
+// New returns a Client updating at most concurrency InferenceJobs in
+// parallel.
+func New(client clientset.Interface, concurrency int) *Client {
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+	return &Client{client: client, concurrency: concurrency}
+}
+
+// List returns the InferenceJobs in namespace matching selector. An empty
+// namespace lists all namespaces, an empty selector matches everything.
+func (c *Client) List(namespace, selector string) ([]samplev1alpha1.InferenceJob, error) {
+	list, err := c.client.SamplecontrollerV1alpha1().InferenceJobs(namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// Scale sets the replica count of the matching InferenceJobs.
+func (c *Client) Scale(namespace, selector string, replicas int32) ([]Result, error) {
+	return c.Update(namespace, selector, func(job *samplev1alpha1.InferenceJob) {
+		job.Spec.Replicas = &replicas
+	})
+}
+
+// Suspend moves the matching InferenceJobs to the cold tier, scaling them
+// to zero while keeping their Deployments.
+func (c *Client) Suspend(namespace, selector string) ([]Result, error) {
+	return c.Update(namespace, selector, func(job *samplev1alpha1.InferenceJob) {
+		job.Spec.Tier = samplev1alpha1.TierCold
+	})
+}
+
+// Resume moves the matching InferenceJobs back to the hot tier.
+func (c *Client) Resume(namespace, selector string) ([]Result, error) {
+	return c.Update(namespace, selector, func(job *samplev1alpha1.InferenceJob) {
+		job.Spec.Tier = samplev1alpha1.TierHot
+	})
+}
+
+// SetImage re-images the matching InferenceJobs.
+func (c *Client) SetImage(namespace, selector, image string) ([]Result, error) {
+	return c.Update(namespace, selector, func(job *samplev1alpha1.InferenceJob) {
+		job.Spec.ImageToDeploy = image
+	})
+}
+
+// Restart rolls the pods of the matching InferenceJobs without changing
+// their spec, by setting RestartedAtAnnotation to the current time.
+func (c *Client) Restart(namespace, selector string) ([]Result, error) {
+	restartedAt := time.Now().Format(time.RFC3339)
+	return c.Update(namespace, selector, func(job *samplev1alpha1.InferenceJob) {
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		job.Annotations[samplev1alpha1.RestartedAtAnnotation] = restartedAt
+	})
+}
+
+// Update applies mutate to each matching InferenceJob and writes it back,
+// retrying on conflicts with a freshly read copy. The error is only set if
+// the InferenceJobs could not be listed, failures of individual updates are
+// reported in the results, in list order.
+func (c *Client) Update(namespace, selector string, mutate func(*samplev1alpha1.InferenceJob)) ([]Result, error) {
+	jobs, err := c.List(namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(jobs))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < c.concurrency && i < len(jobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = c.update(&jobs[i], mutate)
+			}
+		}()
+	}
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results, nil
+}
+
+func (c *Client) update(job *samplev1alpha1.InferenceJob, mutate func(*samplev1alpha1.InferenceJob)) Result {
+	jobs := c.client.SamplecontrollerV1alpha1().InferenceJobs(job.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		mutate(job)
+		_, err := jobs.Update(job)
+		if err == nil {
+			return nil
+		}
+		if latest, getErr := jobs.Get(job.Name, metav1.GetOptions{}); getErr == nil {
+			*job = *latest
+		}
+		return err
+	})
+	return Result{Namespace: job.Namespace, Name: job.Name, Err: err}
+}
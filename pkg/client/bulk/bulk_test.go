@@ -0,0 +1,225 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bulk
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	core "k8s.io/client-go/testing"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/generated/clientset/versioned/fake"
+	typed "k8s.io/sample-controller/pkg/generated/clientset/versioned/typed/samplecontroller/v1alpha1"
+)
+
+func newJob(name string, labels map[string]string) *samplev1alpha1.InferenceJob {
+	return &samplev1alpha1.InferenceJob{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault, Labels: labels},
+		Spec:       samplev1alpha1.InferenceJobSpec{ImageToDeploy: "model-server:v1"},
+	}
+}
+
+func newClientset(names ...string) *fake.Clientset {
+	var objects []runtime.Object
+	for _, name := range names {
+		objects = append(objects, newJob(name, map[string]string{"team": "search"}))
+	}
+	return fake.NewSimpleClientset(objects...)
+}
+
+func getJob(t *testing.T, client *fake.Clientset, name string) *samplev1alpha1.InferenceJob {
+	job, err := client.SamplecontrollerV1alpha1().InferenceJobs(metav1.NamespaceDefault).Get(name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return job
+}
+
+func TestScale(t *testing.T) {
+	client := newClientset("a", "b")
+	other := newJob("c", map[string]string{"team": "ads"})
+	if _, err := client.SamplecontrollerV1alpha1().InferenceJobs(other.Namespace).Create(other); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results, err := New(client, 0).Scale(metav1.NamespaceDefault, "team=search", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].Name != "a" || results[1].Name != "b" {
+		t.Fatalf("expected results for a and b in list order, got %+v", results)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("%s: unexpected error: %v", result.Name, result.Err)
+		}
+		if job := getJob(t, client, result.Name); job.Spec.Replicas == nil || *job.Spec.Replicas != 3 {
+			t.Errorf("%s: expected 3 replicas, got %v", result.Name, job.Spec.Replicas)
+		}
+	}
+	if job := getJob(t, client, "c"); job.Spec.Replicas != nil {
+		t.Errorf("expected the unselected InferenceJob not to be scaled, got %d replicas", *job.Spec.Replicas)
+	}
+}
+
+func TestUpdatePartialFailure(t *testing.T) {
+	client := newClientset("a", "b", "c")
+	client.PrependReactor("update", "inferencejobs", func(action core.Action) (bool, runtime.Object, error) {
+		if action.(core.UpdateAction).GetObject().(*samplev1alpha1.InferenceJob).Name == "b" {
+			return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "inferencejobs"}, "b", fmt.Errorf("denied"))
+		}
+		return false, nil, nil
+	})
+
+	results, err := New(client, 2).SetImage(metav1.NamespaceDefault, "", "model-server:v2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, result := range results {
+		failed := result.Name == "b"
+		if (result.Err != nil) != failed {
+			t.Errorf("%s: expected failure %v, got %v", result.Name, failed, result.Err)
+		}
+		image := getJob(t, client, result.Name).Spec.ImageToDeploy
+		if expected := map[bool]string{true: "model-server:v1", false: "model-server:v2"}[failed]; image != expected {
+			t.Errorf("%s: expected image %s, got %s", result.Name, expected, image)
+		}
+	}
+}
+
+func TestUpdateRetriesConflicts(t *testing.T) {
+	client := newClientset("a")
+	conflicts := 2
+	client.PrependReactor("update", "inferencejobs", func(action core.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		// Someone else changed the InferenceJob in the meantime.
+		job := action.(core.UpdateAction).GetObject().(*samplev1alpha1.InferenceJob).DeepCopy()
+		job.Labels["owner"] = "someone-else"
+		job.Spec.ImageToDeploy = "model-server:v1"
+		if err := client.Tracker().Update(samplev1alpha1.SchemeGroupVersion.WithResource("inferencejobs"), job, job.Namespace); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return true, nil, errors.NewConflict(schema.GroupResource{Resource: "inferencejobs"}, "a", fmt.Errorf("modified"))
+	})
+
+	results, err := New(client, 1).Suspend(metav1.NamespaceDefault, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected the update to succeed after the conflicts, got %+v", results)
+	}
+	job := getJob(t, client, "a")
+	if job.Spec.Tier != samplev1alpha1.TierCold || job.Labels["owner"] != "someone-else" {
+		t.Errorf("expected the change to be applied to the latest copy, got %+v", job)
+	}
+}
+
+func TestUpdateListError(t *testing.T) {
+	client := newClientset("a")
+	client.PrependReactor("list", "inferencejobs", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("unavailable")
+	})
+	if results, err := New(client, 1).Resume(metav1.NamespaceDefault, ""); err == nil {
+		t.Errorf("expected an error, got %+v", results)
+	}
+}
+
+// inFlight records the most updates running at the same time.
+type inFlight struct {
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (f *inFlight) start() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.current++
+	if f.current > f.max {
+		f.max = f.current
+	}
+}
+
+func (f *inFlight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.current--
+}
+
+// countingClientset counts the InferenceJob updates in flight. The fake
+// clientset serializes its reactors, so they can't.
+type countingClientset struct {
+	*fake.Clientset
+	inFlight *inFlight
+}
+
+func (c *countingClientset) SamplecontrollerV1alpha1() typed.SamplecontrollerV1alpha1Interface {
+	return &countingGroup{SamplecontrollerV1alpha1Interface: c.Clientset.SamplecontrollerV1alpha1(), inFlight: c.inFlight}
+}
+
+type countingGroup struct {
+	typed.SamplecontrollerV1alpha1Interface
+	inFlight *inFlight
+}
+
+func (g *countingGroup) InferenceJobs(namespace string) typed.InferenceJobInterface {
+	return &countingInferenceJobs{InferenceJobInterface: g.SamplecontrollerV1alpha1Interface.InferenceJobs(namespace), inFlight: g.inFlight}
+}
+
+type countingInferenceJobs struct {
+	typed.InferenceJobInterface
+	inFlight *inFlight
+}
+
+func (j *countingInferenceJobs) Update(job *samplev1alpha1.InferenceJob) (*samplev1alpha1.InferenceJob, error) {
+	j.inFlight.start()
+	defer j.inFlight.done()
+	time.Sleep(20 * time.Millisecond)
+	return j.InferenceJobInterface.Update(job)
+}
+
+func TestUpdateBoundedConcurrency(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e", "f", "g"}
+	client := &countingClientset{Clientset: newClientset(names...), inFlight: &inFlight{}}
+
+	results, err := New(client, 3).Scale(metav1.NamespaceDefault, "", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != len(names) {
+		t.Fatalf("expected %d results, got %+v", len(names), results)
+	}
+	for i, result := range results {
+		if result.Name != names[i] || result.Err != nil {
+			t.Errorf("expected %s to be updated, got %+v", names[i], result)
+		}
+	}
+	if max := client.inFlight.max; max > 3 || max < 2 {
+		t.Errorf("expected up to 3 concurrent updates, got %d", max)
+	}
+}
@@ -34,9 +34,9 @@ type FakeInferenceJobs struct {
 	ns   string
 }
 
-var inferencejobsResource = schema.GroupVersionResource{Group: "samplecontroller.k8s.io", Version: "v1alpha1", Resource: "inferencejobs"}
+var inferencejobsResource = schema.GroupVersionResource{Group: "fabianoyoschitaki.io", Version: "v1alpha1", Resource: "inferencejobs"}
 
-var inferencejobsKind = schema.GroupVersionKind{Group: "samplecontroller.k8s.io", Version: "v1alpha1", Kind: "InferenceJob"}
+var inferencejobsKind = schema.GroupVersionKind{Group: "fabianoyoschitaki.io", Version: "v1alpha1", Kind: "InferenceJob"}
 
 // Get takes name of the inferenceJob, and returns the corresponding inferenceJob object, and an error if there is any.
 func (c *FakeInferenceJobs) Get(name string, options v1.GetOptions) (result *v1alpha1.InferenceJob, err error) {
@@ -32,6 +32,10 @@ func (c *FakeSamplecontrollerV1alpha1) InferenceJobs(namespace string) v1alpha1.
 	return &FakeInferenceJobs{c, namespace}
 }
 
+func (c *FakeSamplecontrollerV1alpha1) InferenceJobSets(namespace string) v1alpha1.InferenceJobSetInterface {
+	return &FakeInferenceJobSets{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeSamplecontrollerV1alpha1) RESTClient() rest.Interface {
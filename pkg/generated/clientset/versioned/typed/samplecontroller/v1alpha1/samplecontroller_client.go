@@ -27,9 +27,10 @@ import (
 type SamplecontrollerV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	InferenceJobsGetter
+	InferenceJobSetsGetter
 }
 
-// SamplecontrollerV1alpha1Client is used to interact with features provided by the samplecontroller.k8s.io group.
+// SamplecontrollerV1alpha1Client is used to interact with features provided by the fabianoyoschitaki.io group.
 type SamplecontrollerV1alpha1Client struct {
 	restClient rest.Interface
 }
@@ -38,6 +39,10 @@ func (c *SamplecontrollerV1alpha1Client) InferenceJobs(namespace string) Inferen
 	return newInferenceJobs(c, namespace)
 }
 
+func (c *SamplecontrollerV1alpha1Client) InferenceJobSets(namespace string) InferenceJobSetInterface {
+	return newInferenceJobSets(c, namespace)
+}
+
 // NewForConfig creates a new SamplecontrollerV1alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*SamplecontrollerV1alpha1Client, error) {
 	config := *c
@@ -52,9 +52,11 @@ func (f *genericInformer) Lister() cache.GenericLister {
 // TODO extend this to unknown resources with a client pool
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
-	// Group=samplecontroller.k8s.io, Version=v1alpha1
+	// Group=fabianoyoschitaki.io, Version=v1alpha1
 	case v1alpha1.SchemeGroupVersion.WithResource("inferencejobs"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Samplecontroller().V1alpha1().InferenceJobs().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("inferencejobsets"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Samplecontroller().V1alpha1().InferenceJobSets().Informer()}, nil
 
 	}
 
@@ -26,6 +26,8 @@ import (
 type Interface interface {
 	// InferenceJobs returns a InferenceJobInformer.
 	InferenceJobs() InferenceJobInformer
+	// InferenceJobSets returns a InferenceJobSetInformer.
+	InferenceJobSets() InferenceJobSetInformer
 }
 
 type version struct {
@@ -43,3 +45,8 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 func (v *version) InferenceJobs() InferenceJobInformer {
 	return &inferenceJobInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// InferenceJobSets returns a InferenceJobSetInformer.
+func (v *version) InferenceJobSets() InferenceJobSetInformer {
+	return &inferenceJobSetInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
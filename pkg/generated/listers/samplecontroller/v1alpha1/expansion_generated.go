@@ -25,3 +25,11 @@ type InferenceJobListerExpansion interface{}
 // InferenceJobNamespaceListerExpansion allows custom methods to be added to
 // InferenceJobNamespaceLister.
 type InferenceJobNamespaceListerExpansion interface{}
+
+// InferenceJobSetListerExpansion allows custom methods to be added to
+// InferenceJobSetLister.
+type InferenceJobSetListerExpansion interface{}
+
+// InferenceJobSetNamespaceListerExpansion allows custom methods to be added to
+// InferenceJobSetNamespaceLister.
+type InferenceJobSetNamespaceListerExpansion interface{}
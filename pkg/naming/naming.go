@@ -0,0 +1,110 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package naming renders the names of the objects generated for an
+// InferenceJob from text/template name templates.
+package naming
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// MaxLength is the maximum length of a rendered name. Longer names are
+// truncated and suffixed with a hash of the full name, so names differing
+// only past the cut don't collide.
+const MaxLength = validation.DNS1123LabelMaxLength
+
+// hashLength is the length of the hash suffix of truncated names.
+const hashLength = 8
+
+// Data is the data name templates are executed with.
+type Data struct {
+	// JobName is the name of the InferenceJob.
+	JobName string
+	// Namespace is the namespace of the InferenceJob.
+	Namespace string
+	// Version is derived from the tag or digest of the image served.
+	Version string
+}
+
+// Render executes the name template with data and returns the resulting
+// name, truncated to MaxLength.
+func Render(name, text string, data Data) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s name template: %s", name, err.Error())
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("invalid %s name template: %s", name, err.Error())
+	}
+	rendered := Truncate(buf.String())
+	if errs := validation.IsDNS1123Label(rendered); len(errs) > 0 {
+		return "", fmt.Errorf("invalid %s name %q: %s", name, rendered, strings.Join(errs, ", "))
+	}
+	return rendered, nil
+}
+
+// Truncate shortens names longer than MaxLength, replacing their end with a
+// hash of the full name.
+func Truncate(name string) string {
+	if len(name) <= MaxLength {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	prefix := strings.TrimRight(name[:MaxLength-hashLength-1], "-.")
+	return fmt.Sprintf("%s-%0*x", prefix, hashLength, h.Sum32())
+}
+
+// QualifiedName returns namespace.name, truncated like Truncate so it is a
+// valid label value. Namespaces can't contain dots, so qualified names of
+// objects in different namespaces don't collide.
+func QualifiedName(namespace, name string) string {
+	return Truncate(namespace + "." + name)
+}
+
+// Version derives a name friendly version from an image reference: the tag,
+// or the first characters of the digest, lowercased and with characters
+// not allowed in names replaced by dashes. It is "latest" for untagged
+// images.
+func Version(image string) string {
+	version := "latest"
+	if i := strings.LastIndex(image, "@"); i != -1 {
+		version = strings.TrimPrefix(image[i+1:], "sha256:")
+		if len(version) > 12 {
+			version = version[:12]
+		}
+	} else if i := strings.LastIndex(image, ":"); i != -1 && !strings.Contains(image[i:], "/") {
+		version = image[i+1:]
+	}
+	version = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, version)
+	return strings.Trim(version, "-")
+}
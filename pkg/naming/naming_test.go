@@ -0,0 +1,52 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package naming
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestQualifiedName(t *testing.T) {
+	long := strings.Repeat("a", 70)
+	for _, tc := range []struct {
+		namespace, name string
+		expected        string
+	}{
+		{namespace: "team-a", name: "bert", expected: "team-a.bert"},
+		{namespace: "team-b", name: "bert", expected: "team-b.bert"},
+		{namespace: "team-a", name: "bert.v2", expected: "team-a.bert.v2"},
+	} {
+		if got := QualifiedName(tc.namespace, tc.name); got != tc.expected {
+			t.Errorf("%s/%s: expected %q, got %q", tc.namespace, tc.name, tc.expected, got)
+		}
+	}
+
+	// Long names are truncated to valid label values, still differing by
+	// namespace.
+	a, b := QualifiedName("team-a", long), QualifiedName("team-b", long)
+	for _, value := range []string{a, b} {
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			t.Errorf("expected %q to be a valid label value: %v", value, errs)
+		}
+	}
+	if a == b {
+		t.Errorf("expected qualified names in different namespaces to differ, got %q", a)
+	}
+}
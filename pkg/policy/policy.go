@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy evaluates lint rules against InferenceJob specs.
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// Violation is a single rule an InferenceJob doesn't comply with.
+type Violation struct {
+	// Rule is the name of the violated rule.
+	Rule string
+	// Message describes the violation.
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+}
+
+// Rule checks an InferenceJob against a single policy.
+type Rule interface {
+	// Name identifies the rule in violations.
+	Name() string
+	// Check returns the violations of the rule, if any.
+	Check(job *samplev1alpha1.InferenceJob) []Violation
+}
+
+// RuleFunc adapts a function to the Rule interface.
+type RuleFunc struct {
+	RuleName string
+	Func     func(job *samplev1alpha1.InferenceJob) []string
+}
+
+// Name implements Rule.
+func (r RuleFunc) Name() string { return r.RuleName }
+
+// Check implements Rule.
+func (r RuleFunc) Check(job *samplev1alpha1.InferenceJob) []Violation {
+	var violations []Violation
+	for _, msg := range r.Func(job) {
+		violations = append(violations, Violation{Rule: r.RuleName, Message: msg})
+	}
+	return violations
+}
+
+// Engine evaluates a set of rules.
+type Engine struct {
+	rules []Rule
+}
+
+// NewEngine returns an Engine evaluating the given rules.
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Register adds rules to the engine.
+func (e *Engine) Register(rules ...Rule) {
+	e.rules = append(e.rules, rules...)
+}
+
+// Evaluate runs every rule against the InferenceJob and returns all
+// violations in rule order.
+func (e *Engine) Evaluate(job *samplev1alpha1.InferenceJob) []Violation {
+	var violations []Violation
+	for _, rule := range e.rules {
+		violations = append(violations, rule.Check(job)...)
+	}
+	return violations
+}
+
+// Summary joins violations into a single human readable message.
+func Summary(violations []Violation) string {
+	msgs := make([]string, 0, len(violations))
+	for _, v := range violations {
+		msgs = append(msgs, v.String())
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+func TestEngineEvaluate(t *testing.T) {
+	e := NewEngine(DefaultRules()...)
+	e.Register(NamingConvention(nil, []string{"team"}))
+	job := &samplev1alpha1.InferenceJob{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{ProductionLabel: "production"}},
+		Spec:       samplev1alpha1.InferenceJobSpec{ImageToDeploy: "model-server"},
+	}
+
+	violations := e.Evaluate(job)
+	expected := []Violation{
+		{Rule: "LatestTag", Message: "image model-server should be pinned to a tag other than latest"},
+		{Rule: "SingleReplicaProduction", Message: "production jobs should run at least 2 replicas"},
+		{Rule: "NamingConvention", Message: `missing required label "team"`},
+	}
+	if !reflect.DeepEqual(violations, expected) {
+		t.Errorf("expected %v, got %v", expected, violations)
+	}
+	summary := `LatestTag: image model-server should be pinned to a tag other than latest; SingleReplicaProduction: production jobs should run at least 2 replicas; NamingConvention: missing required label "team"`
+	if got := Summary(violations); got != summary {
+		t.Errorf("expected summary %q, got %q", summary, got)
+	}
+}
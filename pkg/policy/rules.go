@@ -0,0 +1,134 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// ProductionLabel marks an InferenceJob as serving production traffic when
+// set to "production".
+const ProductionLabel = "environment"
+
+// DefaultRules returns the built-in rule set.
+func DefaultRules() []Rule {
+	return []Rule{
+		LatestTag,
+		SingleReplicaProduction,
+	}
+}
+
+// LatestTag flags images that are untagged or use the mutable latest tag.
+var LatestTag Rule = RuleFunc{
+	RuleName: "LatestTag",
+	Func: func(job *samplev1alpha1.InferenceJob) []string {
+		image := job.Spec.ImageToDeploy
+		if image == "" || strings.Contains(image, "@") {
+			return nil
+		}
+		// The tag follows the last colon, unless that colon belongs to a
+		// registry host:port.
+		i := strings.LastIndex(image, ":")
+		if i == -1 || strings.Contains(image[i:], "/") || image[i+1:] == "latest" {
+			return []string{"image " + image + " should be pinned to a tag other than latest"}
+		}
+		return nil
+	},
+}
+
+// SingleReplicaProduction flags production jobs without redundancy.
+var SingleReplicaProduction Rule = RuleFunc{
+	RuleName: "SingleReplicaProduction",
+	Func: func(job *samplev1alpha1.InferenceJob) []string {
+		if job.Labels[ProductionLabel] != "production" {
+			return nil
+		}
+		if job.Spec.Replicas == nil || *job.Spec.Replicas < 2 {
+			return []string{"production jobs should run at least 2 replicas"}
+		}
+		return nil
+	},
+}
+
+// NamingConvention returns a rule requiring InferenceJob names to match
+// namePattern, if not nil, and to carry all of requiredLabels.
+func NamingConvention(namePattern *regexp.Regexp, requiredLabels []string) Rule {
+	return RuleFunc{
+		RuleName: "NamingConvention",
+		Func: func(job *samplev1alpha1.InferenceJob) []string {
+			var msgs []string
+			// Names generated by the API server are only known after
+			// admission.
+			if namePattern != nil && job.Name != "" && !namePattern.MatchString(job.Name) {
+				msgs = append(msgs, fmt.Sprintf("name %q does not match %q", job.Name, namePattern.String()))
+			}
+			for _, label := range requiredLabels {
+				if job.Labels[label] == "" {
+					msgs = append(msgs, fmt.Sprintf("missing required label %q", label))
+				}
+			}
+			return msgs
+		},
+	}
+}
+
+// AcceleratorMemory maps the GPU types of the nodes, read from NodeLabel in
+// the node selector of InferenceJobs, to the memory of a single GPU.
+type AcceleratorMemory struct {
+	NodeLabel string
+	Memory    map[string]resource.Quantity
+}
+
+// ModelFit returns why the model of the InferenceJob doesn't fit the memory
+// of its GPUs, or an empty string if it fits or can't be checked because the
+// model size, GPUs or GPU type are unknown.
+func (a *AcceleratorMemory) ModelFit(job *samplev1alpha1.InferenceJob) string {
+	if job.Spec.ModelSizeBytes == nil || job.Spec.GPUs == nil || *job.Spec.GPUs <= 0 {
+		return ""
+	}
+	accelerator := job.Spec.NodeSelector[a.NodeLabel]
+	memory, ok := a.Memory[accelerator]
+	if !ok {
+		return ""
+	}
+	total := memory.Value() * *job.Spec.GPUs
+	if *job.Spec.ModelSizeBytes <= total {
+		return ""
+	}
+	return fmt.Sprintf("model of %s does not fit the %s of memory of %d %s GPUs",
+		resource.NewQuantity(*job.Spec.ModelSizeBytes, resource.BinarySI).String(), resource.NewQuantity(total, resource.BinarySI).String(), *job.Spec.GPUs, accelerator)
+}
+
+// ModelFit returns a rule rejecting InferenceJobs whose model doesn't fit
+// the memory of their GPUs.
+func ModelFit(accelerators *AcceleratorMemory) Rule {
+	return RuleFunc{
+		RuleName: "ModelTooLarge",
+		Func: func(job *samplev1alpha1.InferenceJob) []string {
+			if msg := accelerators.ModelFit(job); msg != "" {
+				return []string{msg}
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func int64Ptr(i int64) *int64 { return &i }
+
+// checkRule runs the rule against the InferenceJob and compares the
+// messages of the violations.
+func checkRule(t *testing.T, rule Rule, name string, job *samplev1alpha1.InferenceJob, expected []string) {
+	t.Helper()
+	var msgs []string
+	for _, v := range rule.Check(job) {
+		if v.Rule != rule.Name() {
+			t.Errorf("%s: expected violations of %s, got %s", name, rule.Name(), v.Rule)
+		}
+		msgs = append(msgs, v.Message)
+	}
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Errorf("%s: expected violations %q, got %q", name, expected, msgs)
+	}
+}
+
+func TestLatestTag(t *testing.T) {
+	for _, tc := range []struct {
+		image    string
+		expected []string
+	}{
+		{image: ""},
+		{image: "model-server:v1"},
+		{image: "registry:5000/model-server:v1"},
+		{image: "model-server@sha256:0123456789abcdef"},
+		{image: "model-server", expected: []string{"image model-server should be pinned to a tag other than latest"}},
+		{image: "model-server:latest", expected: []string{"image model-server:latest should be pinned to a tag other than latest"}},
+		{image: "registry:5000/model-server", expected: []string{"image registry:5000/model-server should be pinned to a tag other than latest"}},
+	} {
+		job := &samplev1alpha1.InferenceJob{Spec: samplev1alpha1.InferenceJobSpec{ImageToDeploy: tc.image}}
+		checkRule(t, LatestTag, tc.image, job, tc.expected)
+	}
+}
+
+func TestSingleReplicaProduction(t *testing.T) {
+	violation := []string{"production jobs should run at least 2 replicas"}
+	for _, tc := range []struct {
+		name        string
+		environment string
+		replicas    *int32
+		expected    []string
+	}{
+		{name: "not production", environment: "staging", replicas: int32Ptr(1)},
+		{name: "redundant", environment: "production", replicas: int32Ptr(2)},
+		{name: "single replica", environment: "production", replicas: int32Ptr(1), expected: violation},
+		{name: "default replicas", environment: "production", expected: violation},
+	} {
+		job := &samplev1alpha1.InferenceJob{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{ProductionLabel: tc.environment}},
+			Spec:       samplev1alpha1.InferenceJobSpec{Replicas: tc.replicas},
+		}
+		checkRule(t, SingleReplicaProduction, tc.name, job, tc.expected)
+	}
+}
+
+func TestNamingConvention(t *testing.T) {
+	rule := NamingConvention(regexp.MustCompile(`^[a-z]+-(dev|prod)$`), []string{"team"})
+	for _, tc := range []struct {
+		name     string
+		jobName  string
+		labels   map[string]string
+		expected []string
+	}{
+		{name: "compliant", jobName: "ranker-prod", labels: map[string]string{"team": "search"}},
+		{name: "generated name", labels: map[string]string{"team": "search"}},
+		{name: "bad name", jobName: "Ranker", labels: map[string]string{"team": "search"}, expected: []string{`name "Ranker" does not match "^[a-z]+-(dev|prod)$"`}},
+		{name: "missing label", jobName: "ranker-dev", expected: []string{`missing required label "team"`}},
+		{name: "both", jobName: "ranker", labels: map[string]string{"team": ""}, expected: []string{
+			`name "ranker" does not match "^[a-z]+-(dev|prod)$"`,
+			`missing required label "team"`,
+		}},
+	} {
+		job := &samplev1alpha1.InferenceJob{ObjectMeta: metav1.ObjectMeta{Name: tc.jobName, Labels: tc.labels}}
+		checkRule(t, rule, tc.name, job, tc.expected)
+	}
+
+	// Without a pattern only the labels are checked.
+	job := &samplev1alpha1.InferenceJob{ObjectMeta: metav1.ObjectMeta{Name: "Ranker", Labels: map[string]string{"team": "search"}}}
+	checkRule(t, NamingConvention(nil, []string{"team"}), "no pattern", job, nil)
+}
+
+func TestModelFit(t *testing.T) {
+	rule := ModelFit(&AcceleratorMemory{
+		NodeLabel: "accelerator",
+		Memory:    map[string]resource.Quantity{"t4": resource.MustParse("16Gi")},
+	})
+	for _, tc := range []struct {
+		name        string
+		accelerator string
+		gpus        *int64
+		modelSize   *int64
+		expected    []string
+	}{
+		{name: "fits", accelerator: "t4", gpus: int64Ptr(1), modelSize: int64Ptr(8 << 30)},
+		{name: "fits several GPUs", accelerator: "t4", gpus: int64Ptr(2), modelSize: int64Ptr(24 << 30)},
+		{name: "unknown size", accelerator: "t4", gpus: int64Ptr(1)},
+		{name: "no GPUs", accelerator: "t4", gpus: int64Ptr(0), modelSize: int64Ptr(24 << 30)},
+		{name: "unknown accelerator", accelerator: "a100", gpus: int64Ptr(1), modelSize: int64Ptr(24 << 30)},
+		{name: "too large", accelerator: "t4", gpus: int64Ptr(1), modelSize: int64Ptr(24 << 30), expected: []string{
+			"model of 24Gi does not fit the 16Gi of memory of 1 t4 GPUs",
+		}},
+	} {
+		job := &samplev1alpha1.InferenceJob{Spec: samplev1alpha1.InferenceJobSpec{
+			NodeSelector:   map[string]string{"accelerator": tc.accelerator},
+			GPUs:           tc.gpus,
+			ModelSizeBytes: tc.modelSize,
+		}}
+		checkRule(t, rule, tc.name, job, tc.expected)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// podControllerLabel is set on the pods of an InferenceJob to its name.
+// The pod informer only watches pods carrying it.
+const podControllerLabel = "controller"
+
+// failingPodReasons are the waiting reasons of containers that won't start
+// without a change to the InferenceJob or its image.
+var failingPodReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// watchPods makes the controller sync InferenceJobs whose pods start
+// failing, and read their pods from the informer cache rather than listing
+// them on every sync.
+func (c *Controller) watchPods(podInformer coreinformers.PodInformer) {
+	c.podsLister = podInformer.Lister()
+	c.podsSynced = podInformer.Informer().HasSynced
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.handlePod,
+		UpdateFunc: func(old, new interface{}) {
+			oldReason, _ := podFailure(old.(*corev1.Pod))
+			if newReason, _ := podFailure(new.(*corev1.Pod)); newReason != oldReason {
+				c.handlePod(new)
+			}
+		},
+	})
+}
+
+// handlePod enqueues the InferenceJob of a failing pod.
+func (c *Controller) handlePod(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	name := pod.Labels[podControllerLabel]
+	if reason, _ := podFailure(pod); reason == "" || name == "" {
+		return
+	}
+	c.workqueue.Add(pod.Namespace + "/" + name)
+}
+
+// podFailure returns the reason and message of the first container of the
+// pod failing to start, or an empty reason.
+func podFailure(pod *corev1.Pod) (string, string) {
+	if pod.DeletionTimestamp != nil {
+		return "", ""
+	}
+	for _, container := range pod.Status.ContainerStatuses {
+		if waiting := container.State.Waiting; waiting != nil && failingPodReasons[waiting.Reason] {
+			return waiting.Reason, fmt.Sprintf("container %s of pod %s: %s", container.Name, pod.Name, waiting.Message)
+		}
+	}
+	return "", ""
+}
+
+// deploymentPods returns the pods of the Deployment from the informer
+// cache, or lists them if pods aren't watched.
+func (c *Controller) deploymentPods(deployment *appsv1.Deployment) ([]*corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if c.podsLister != nil {
+		return c.podsLister.Pods(deployment.Namespace).List(selector)
+	}
+	list, err := c.kubeclientset.CoreV1().Pods(deployment.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]*corev1.Pod, 0, len(list.Items))
+	for i := range list.Items {
+		pods = append(pods, &list.Items[i])
+	}
+	return pods, nil
+}
+
+// setFailingPodsCondition marks the InferenceJob Degraded with the reason
+// of a pod of the Deployment stuck failing to start its containers, and
+// records an Event the first time. Without a pod informer, pods are only
+// listed while some replicas are unavailable.
+func (c *Controller) setFailingPodsCondition(inferenceJob *samplev1alpha1.InferenceJob, status *samplev1alpha1.InferenceJobStatus, deployment *appsv1.Deployment) {
+	if c.podsLister == nil && deployment.Status.UnavailableReplicas == 0 {
+		return
+	}
+	pods, err := c.deploymentPods(deployment)
+	if err != nil {
+		// Pod failures are informational, they must not fail the sync.
+		utilruntime.HandleError(fmt.Errorf("failed to list pods of deployment %s/%s: %s", deployment.Namespace, deployment.Name, err.Error()))
+		return
+	}
+	for _, pod := range pods {
+		reason, msg := podFailure(pod)
+		if reason == "" {
+			continue
+		}
+		if cond := getCondition(inferenceJob.Status, samplev1alpha1.Degraded); cond == nil || cond.Reason != reason {
+			c.recorder.Event(inferenceJob, corev1.EventTypeWarning, reason, msg)
+		}
+		setCondition(status, newCondition(samplev1alpha1.Degraded, corev1.ConditionTrue, reason, msg))
+		return
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
+	informers "k8s.io/sample-controller/pkg/generated/informers/externalversions"
+)
+
+// pollWatch stands in for the watch of a polling informer. It sends no
+// events and expires after the poll interval, which makes the reflector of
+// the informer LIST again and notify the event handlers of the differences.
+func pollWatch(interval time.Duration) func(metav1.ListOptions) (watch.Interface, error) {
+	return func(metav1.ListOptions) (watch.Interface, error) {
+		ch := make(chan watch.Event)
+		w := watch.NewProxyWatcher(ch)
+		go func() {
+			timer := time.NewTimer(interval)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-w.StopChan():
+				return
+			}
+			expired := &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    http.StatusGone,
+				Reason:  metav1.StatusReasonExpired,
+				Message: "poll interval elapsed",
+			}
+			select {
+			case ch <- watch.Event{Type: watch.Error, Object: expired}:
+			case <-w.StopChan():
+			}
+		}()
+		return w, nil
+	}
+}
+
+// usePollingInformers makes the informer factories poll with LIST every
+// interval instead of watching, for API servers restricting or breaking
+// watches. The informers, and so the sync logic, are otherwise unchanged,
+// Deployments are trimmed and listed in pages of listPageSize as by
+// useTrimmedDeploymentInformer. Only the namespace is listed if set. It
+// must be called before the informers are first requested.
+func usePollingInformers(kubeInformerFactory kubeinformers.SharedInformerFactory, exampleInformerFactory informers.SharedInformerFactory, namespace string, interval time.Duration, listPageSize int64) {
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	kubeInformerFactory.InformerFor(&appsv1.Deployment{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return cache.NewSharedIndexInformer(trimmedListWatch(pagedListWatch(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.AppsV1().Deployments(namespace).List(options)
+			},
+			WatchFunc: pollWatch(interval),
+		}, listPageSize)), &appsv1.Deployment{}, resync, indexers)
+	})
+	exampleInformerFactory.InformerFor(&samplev1alpha1.InferenceJob{}, func(client clientset.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.SamplecontrollerV1alpha1().InferenceJobs(namespace).List(options)
+			},
+			WatchFunc: pollWatch(interval),
+		}, &samplev1alpha1.InferenceJob{}, resync, indexers)
+	})
+	exampleInformerFactory.InformerFor(&samplev1alpha1.InferenceJobSet{}, func(client clientset.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.SamplecontrollerV1alpha1().InferenceJobSets(namespace).List(options)
+			},
+			WatchFunc: pollWatch(interval),
+		}, &samplev1alpha1.InferenceJobSet{}, resync, indexers)
+	})
+}
+
+// usePollingPodInformer makes the pod informer factory poll as
+// usePollingInformers does. Only the pods of InferenceJobs are listed.
+func usePollingPodInformer(podInformerFactory kubeinformers.SharedInformerFactory, namespace string, interval time.Duration) {
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	podInformerFactory.InformerFor(&corev1.Pod{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = podControllerLabel
+				return client.CoreV1().Pods(namespace).List(options)
+			},
+			WatchFunc: pollWatch(interval),
+		}, &corev1.Pod{}, resync, indexers)
+	})
+}
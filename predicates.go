@@ -0,0 +1,41 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// inferenceJobChanged reports whether an update of an InferenceJob calls for
+// a sync. Updates of the status alone, the controller's own status writes
+// included, don't, except for the Ready condition an InferenceJob waits on
+// before it is promoted. Resyncs always do.
+func inferenceJobChanged(old, new *samplev1alpha1.InferenceJob) bool {
+	if old.ResourceVersion == new.ResourceVersion {
+		return true
+	}
+	if old.Generation != new.Generation ||
+		!reflect.DeepEqual(old.Labels, new.Labels) ||
+		!reflect.DeepEqual(old.Annotations, new.Annotations) ||
+		!reflect.DeepEqual(old.Finalizers, new.Finalizers) ||
+		(old.DeletionTimestamp == nil) != (new.DeletionTimestamp == nil) {
+		return true
+	}
+	return new.Annotations[PromoteAnnotation] != "" && promotable(old) != promotable(new)
+}
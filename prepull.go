@@ -0,0 +1,158 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/naming"
+)
+
+const (
+	// prePullPollInterval is how often the progress of a pre-pull is
+	// checked. DaemonSets aren't watched by the controller.
+	prePullPollInterval = 10 * time.Second
+	// prePullPauseImage keeps the pre-pull pods alive once the model image
+	// has been pulled by the init container.
+	prePullPauseImage = "k8s.gcr.io/pause:3.1"
+
+	// ImagePrePulling is used as part of the Event 'reason' when a new image
+	// is being pulled onto the nodes ahead of a rollout.
+	ImagePrePulling = "ImagePrePulling"
+	// MessageImagePrePulling is the message used for Events when a new image
+	// is being pulled onto the nodes ahead of a rollout.
+	MessageImagePrePulling = "Pre-pulling image %q before rolling out Deployment %q"
+)
+
+// prePullName returns the name of the pre-pull DaemonSet of a Deployment.
+func prePullName(deploymentName string) string {
+	return naming.Truncate(deploymentName + "-prepull")
+}
+
+// deploymentImage returns the image of the inference container.
+func deploymentImage(deployment *appsv1.Deployment) string {
+	if len(deployment.Spec.Template.Spec.Containers) == 0 {
+		return ""
+	}
+	return deployment.Spec.Template.Spec.Containers[0].Image
+}
+
+// prePullImage makes sure the image of the desired Deployment is present on
+// every node the Deployment can schedule to. It returns true once all
+// pre-pull pods are ready, at which point the pre-pull DaemonSet is removed
+// and the rollout may proceed.
+func (c *Controller) prePullImage(inferenceJob *samplev1alpha1.InferenceJob, desired *appsv1.Deployment) (bool, error) {
+	daemonSets := c.kubeclientset.AppsV1().DaemonSets(inferenceJob.Namespace)
+	name := prePullName(desired.Name)
+	image := deploymentImage(desired)
+
+	ds, err := daemonSets.Get(name, metav1.GetOptions{})
+	if err == nil && prePullImageOf(ds) != image {
+		// Left over from an earlier image, start over.
+		if err := daemonSets.Delete(name, nil); err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	if errors.IsNotFound(err) {
+		c.recorder.Eventf(inferenceJob, corev1.EventTypeNormal, ImagePrePulling, MessageImagePrePulling, image, desired.Name)
+		_, err = daemonSets.Create(newPrePullDaemonSet(inferenceJob, desired))
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if ds.Status.ObservedGeneration < ds.Generation ||
+		ds.Status.DesiredNumberScheduled == 0 ||
+		ds.Status.NumberReady < ds.Status.DesiredNumberScheduled {
+		klog.V(4).Infof("Pre-pull of image %s for deployment %s: %d/%d nodes ready", image, desired.Name, ds.Status.NumberReady, ds.Status.DesiredNumberScheduled)
+		return false, nil
+	}
+
+	if err := daemonSets.Delete(name, nil); err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// prePullImageOf returns the image pulled by a pre-pull DaemonSet.
+func prePullImageOf(ds *appsv1.DaemonSet) string {
+	if len(ds.Spec.Template.Spec.InitContainers) == 0 {
+		return ""
+	}
+	return ds.Spec.Template.Spec.InitContainers[0].Image
+}
+
+// newPrePullDaemonSet creates a DaemonSet pulling the image of the desired
+// Deployment onto the nodes its pods may land on. The image is pulled by an
+// init container that exits right away, the long running container is a
+// pause container.
+func newPrePullDaemonSet(inferenceJob *samplev1alpha1.InferenceJob, desired *appsv1.Deployment) *appsv1.DaemonSet {
+	labels := map[string]string{
+		"prepull":    desired.Name,
+		"controller": inferenceJob.Name,
+	}
+	podSpec := desired.Spec.Template.Spec
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      prePullName(desired.Name),
+			Namespace: inferenceJob.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(inferenceJob, samplev1alpha1.SchemeGroupVersion.WithKind("InferenceJob")),
+			},
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					NodeSelector:     podSpec.NodeSelector,
+					Affinity:         podSpec.Affinity,
+					Tolerations:      podSpec.Tolerations,
+					ImagePullSecrets: podSpec.ImagePullSecrets,
+					InitContainers: []corev1.Container{
+						{
+							Name:    "prepull",
+							Image:   deploymentImage(desired),
+							Command: []string{"/bin/sh", "-c", "exit 0"},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "pause",
+							Image: prePullPauseImage,
+						},
+					},
+				},
+			},
+		},
+	}
+	stampIdentity(&ds.ObjectMeta, inferenceJob)
+	return ds
+}
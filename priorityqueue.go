@@ -0,0 +1,246 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// priorityQueue is a rate limited work queue handing out the waiting item
+// of the highest priority first, and items of the same priority in the
+// order they were added. Like the queues of the workqueue package, an item
+// is only queued once and never processed by two workers at the same
+// time.
+type priorityQueue struct {
+	rateLimiter workqueue.RateLimiter
+	// priority returns the priority of an item when it is queued.
+	priority func(item interface{}) int32
+
+	cond *sync.Cond
+	// queue holds the items ready to be processed.
+	queue priorityHeap
+	// seq orders the items of the same priority.
+	seq uint64
+	// dirty holds the items to be processed, processing those being
+	// processed. An item added while being processed is queued again once
+	// it is done.
+	dirty      map[interface{}]bool
+	processing map[interface{}]bool
+	// waiting holds the items added with a delay.
+	waiting      map[interface{}]*waitingItem
+	shuttingDown bool
+}
+
+// waitingItem is an item added to a priorityQueue with a delay.
+type waitingItem struct {
+	readyAt time.Time
+	timer   *time.Timer
+}
+
+var _ workqueue.RateLimitingInterface = &priorityQueue{}
+
+func newPriorityQueue(rateLimiter workqueue.RateLimiter, priority func(item interface{}) int32) *priorityQueue {
+	return &priorityQueue{
+		rateLimiter: rateLimiter,
+		priority:    priority,
+		cond:        sync.NewCond(&sync.Mutex{}),
+		dirty:       map[interface{}]bool{},
+		processing:  map[interface{}]bool{},
+		waiting:     map[interface{}]*waitingItem{},
+	}
+}
+
+// Add queues the item unless it is already.
+func (q *priorityQueue) Add(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.add(item)
+}
+
+func (q *priorityQueue) add(item interface{}) {
+	if q.shuttingDown || q.dirty[item] {
+		return
+	}
+	q.dirty[item] = true
+	if q.processing[item] {
+		return
+	}
+	q.push(item)
+}
+
+func (q *priorityQueue) push(item interface{}) {
+	q.seq++
+	heap.Push(&q.queue, prioritizedItem{item: item, priority: q.priority(item), seq: q.seq})
+	q.cond.Signal()
+}
+
+// Len returns the number of items ready to be processed.
+func (q *priorityQueue) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.queue.Len()
+}
+
+// Get blocks until an item is ready and returns the one of the highest
+// priority. It returns shutdown once the queue is shut down and empty. Done
+// must be called with the item once it is processed.
+func (q *priorityQueue) Get() (item interface{}, shutdown bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for q.queue.Len() == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if q.queue.Len() == 0 {
+		return nil, true
+	}
+	item = heap.Pop(&q.queue).(prioritizedItem).item
+	q.processing[item] = true
+	delete(q.dirty, item)
+	return item, false
+}
+
+// Done marks the item as processed, queueing it again if it was added in
+// the meantime.
+func (q *priorityQueue) Done(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	delete(q.processing, item)
+	if q.dirty[item] {
+		q.push(item)
+	}
+}
+
+// ShutDown stops accepting items and makes Get return once the queue is
+// empty. Items waiting for their delay are dropped.
+func (q *priorityQueue) ShutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.shuttingDown = true
+	for item, w := range q.waiting {
+		w.timer.Stop()
+		delete(q.waiting, item)
+	}
+	q.cond.Broadcast()
+}
+
+func (q *priorityQueue) ShuttingDown() bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.shuttingDown
+}
+
+// AddAfter adds the item once the duration has passed. An item waiting
+// already is added at the earlier of both times.
+func (q *priorityQueue) AddAfter(item interface{}, duration time.Duration) {
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	readyAt := time.Now().Add(duration)
+	if w, ok := q.waiting[item]; ok {
+		if !readyAt.Before(w.readyAt) {
+			return
+		}
+		w.timer.Stop()
+	}
+	q.waiting[item] = &waitingItem{
+		readyAt: readyAt,
+		timer: time.AfterFunc(duration, func() {
+			q.cond.L.Lock()
+			defer q.cond.L.Unlock()
+			// The timer may have been replaced by an earlier one.
+			if w, ok := q.waiting[item]; ok && w.readyAt.Equal(readyAt) {
+				delete(q.waiting, item)
+				q.add(item)
+			}
+		}),
+	}
+}
+
+// AddRateLimited adds the item once the rate limiter says it is ok.
+func (q *priorityQueue) AddRateLimited(item interface{}) {
+	q.AddAfter(item, q.rateLimiter.When(item))
+}
+
+// Forget makes the rate limiter stop tracking the item.
+func (q *priorityQueue) Forget(item interface{}) {
+	q.rateLimiter.Forget(item)
+}
+
+// NumRequeues returns the number of times the item was rate limited since
+// it was last forgotten.
+func (q *priorityQueue) NumRequeues(item interface{}) int {
+	return q.rateLimiter.NumRequeues(item)
+}
+
+// prioritizedItem is an item in a priorityHeap.
+type prioritizedItem struct {
+	item     interface{}
+	priority int32
+	seq      uint64
+}
+
+// priorityHeap orders items by priority, then by the order they were
+// pushed in.
+type priorityHeap []prioritizedItem
+
+func (h priorityHeap) Len() int { return len(h) }
+func (h priorityHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h priorityHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *priorityHeap) Push(x interface{}) { *h = append(*h, x.(prioritizedItem)) }
+
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// inferenceJobPriority returns spec.priority of the InferenceJob with the
+// given key, 0 if it isn't cached.
+func (c *Controller) inferenceJobPriority(item interface{}) int32 {
+	key, ok := item.(string)
+	if !ok {
+		return 0
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return 0
+	}
+	inferenceJob, err := c.inferenceJobsLister.InferenceJobs(namespace).Get(name)
+	if err != nil {
+		return 0
+	}
+	return inferenceJob.Spec.Priority
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// PromoteAnnotation requests the promotion of a InferenceJob. The value
+	// is the namespace to copy the InferenceJob to, which must be a target
+	// of the promotion config. The annotation is removed once handled.
+	PromoteAnnotation = "fabianoyoschitaki.io/promote-to"
+	// PromotedFromAnnotation records the namespace/name of the InferenceJob
+	// a promoted copy was made from. Only copies made from the same source
+	// are overwritten by later promotions.
+	PromotedFromAnnotation = "fabianoyoschitaki.io/promoted-from"
+
+	// SuccessPromoted is used as part of the Event 'reason' when a
+	// InferenceJob is promoted to another namespace.
+	SuccessPromoted = "Promoted"
+	// MessagePromoted is the message used for an Event fired when a
+	// InferenceJob is promoted to another namespace.
+	MessagePromoted = "Promoted to namespace %q"
+	// ErrPromotion is used as part of the Event 'reason' when a InferenceJob
+	// can't be promoted.
+	ErrPromotion = "PromotionFailed"
+)
+
+// promotionConfig maps the namespaces InferenceJobs may be promoted to onto
+// the environment specific rewrites applied to the promoted copies.
+type promotionConfig struct {
+	Targets map[string]promotionTarget `json:"targets"`
+}
+
+// promotionTarget rewrites the environment specific fields of a promoted
+// InferenceJob. Unset fields are copied unchanged.
+type promotionTarget struct {
+	// Labels are merged over the labels of the InferenceJob.
+	Labels map[string]string `json:"labels,omitempty"`
+	// ImageRegistries maps image prefixes, e.g. staging registries, onto
+	// the prefixes to use in the target namespace.
+	ImageRegistries map[string]string `json:"imageRegistries,omitempty"`
+	// Env overrides the values of environment variables.
+	Env                map[string]string `json:"env,omitempty"`
+	Replicas           *int32            `json:"replicas,omitempty"`
+	NodeSelector       map[string]string `json:"nodeSelector,omitempty"`
+	ServiceAccountName string            `json:"serviceAccountName,omitempty"`
+}
+
+// loadPromotionConfig reads a YAML or JSON promotion config.
+func loadPromotionConfig(path string) (*promotionConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	config := &promotionConfig{}
+	if err := yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(config); err != nil {
+		return nil, fmt.Errorf("error parsing promotion config %s: %s", path, err.Error())
+	}
+	return config, nil
+}
+
+// promoteInferenceJob copies a InferenceJob annotated with PromoteAnnotation
+// to the target namespace and removes the annotation. Promotions that can't
+// succeed without a change to the InferenceJob are reported in an event and
+// not retried.
+func (c *Controller) promoteInferenceJob(inferenceJob *samplev1alpha1.InferenceJob) error {
+	targetNamespace := inferenceJob.Annotations[PromoteAnnotation]
+	promoted, err := c.newPromotedInferenceJob(inferenceJob, targetNamespace)
+	if err != nil {
+		c.recorder.Event(inferenceJob, corev1.EventTypeWarning, ErrPromotion, err.Error())
+		return c.removePromoteAnnotation(inferenceJob)
+	}
+
+	inferenceJobs := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(targetNamespace)
+	existing, err := inferenceJobs.Get(promoted.Name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = inferenceJobs.Create(promoted)
+	case err != nil:
+	case existing.Annotations[PromotedFromAnnotation] != promoted.Annotations[PromotedFromAnnotation]:
+		c.recorder.Eventf(inferenceJob, corev1.EventTypeWarning, ErrPromotion, "InferenceJob %s/%s exists and wasn't promoted from this InferenceJob", targetNamespace, existing.Name)
+		return c.removePromoteAnnotation(inferenceJob)
+	default:
+		existing = existing.DeepCopy()
+		existing.Labels = promoted.Labels
+		existing.Spec = promoted.Spec
+		_, err = inferenceJobs.Update(existing)
+	}
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("Promoted inferenceJob %s/%s to namespace %s", inferenceJob.Namespace, inferenceJob.Name, targetNamespace)
+	c.recorder.Eventf(inferenceJob, corev1.EventTypeNormal, SuccessPromoted, MessagePromoted, targetNamespace)
+	return c.removePromoteAnnotation(inferenceJob)
+}
+
+func (c *Controller) removePromoteAnnotation(inferenceJob *samplev1alpha1.InferenceJob) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{PromoteAnnotation: nil},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).Patch(inferenceJob.Name, types.MergePatchType, patch)
+	return err
+}
+
+// newPromotedInferenceJob returns the copy of the InferenceJob to create in
+// the target namespace. Promoted images must be pinned to a digest so the
+// target runs exactly what was validated in the source namespace.
+func (c *Controller) newPromotedInferenceJob(inferenceJob *samplev1alpha1.InferenceJob, targetNamespace string) (*samplev1alpha1.InferenceJob, error) {
+	if c.promotion == nil {
+		return nil, fmt.Errorf("promotion is not configured")
+	}
+	target, ok := c.promotion.Targets[targetNamespace]
+	if !ok || targetNamespace == inferenceJob.Namespace {
+		return nil, fmt.Errorf("namespace %q is not a promotion target", targetNamespace)
+	}
+
+	spec := inferenceJob.Spec.DeepCopy()
+	for from, to := range target.ImageRegistries {
+		if strings.HasPrefix(spec.ImageToDeploy, from) {
+			spec.ImageToDeploy = to + strings.TrimPrefix(spec.ImageToDeploy, from)
+			break
+		}
+	}
+	if !strings.Contains(spec.ImageToDeploy, "@sha256:") {
+		return nil, fmt.Errorf("image %s must be pinned to a digest to be promoted", spec.ImageToDeploy)
+	}
+	for i := range spec.Env {
+		if value, ok := target.Env[spec.Env[i].Name]; ok {
+			spec.Env[i].Value = value
+			spec.Env[i].ValueFrom = nil
+		}
+	}
+	if target.Replicas != nil {
+		spec.Replicas = target.Replicas
+	}
+	if target.NodeSelector != nil {
+		spec.NodeSelector = target.NodeSelector
+	}
+	if target.ServiceAccountName != "" {
+		spec.ServiceAccountName = target.ServiceAccountName
+	}
+
+	labels := map[string]string{}
+	for k, v := range inferenceJob.Labels {
+		labels[k] = v
+	}
+	for k, v := range target.Labels {
+		labels[k] = v
+	}
+	return &samplev1alpha1.InferenceJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      inferenceJob.Name,
+			Namespace: targetNamespace,
+			Labels:    labels,
+			Annotations: map[string]string{
+				PromotedFromAnnotation: inferenceJob.Namespace + "/" + inferenceJob.Name,
+			},
+		},
+		Spec: *spec,
+	}, nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// syncTimes records when each InferenceJob was last reconciled.
+type syncTimes struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+func newSyncTimes() *syncTimes {
+	return &syncTimes{times: map[string]time.Time{}}
+}
+
+func (s *syncTimes) get(key string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.times[key]
+	return t, ok
+}
+
+func (s *syncTimes) set(key string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.times[key] = t
+}
+
+func (s *syncTimes) forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.times, key)
+}
+
+// reconcileDelay returns how long the reconcile of the InferenceJob must be
+// put off to honor spec.reconcilePolicy.minIntervalSeconds, zero if it can
+// go ahead.
+func (c *Controller) reconcileDelay(key string, inferenceJob *samplev1alpha1.InferenceJob, now time.Time) time.Duration {
+	policy := inferenceJob.Spec.ReconcilePolicy
+	if policy == nil || policy.MinIntervalSeconds == nil {
+		return 0
+	}
+	last, ok := c.lastSynced.get(key)
+	if !ok {
+		return 0
+	}
+	if delay := last.Add(time.Duration(*policy.MinIntervalSeconds) * time.Second).Sub(now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// scheduleReconcile records a completed reconcile of the InferenceJob and
+// queues the next one after spec.reconcilePolicy.maxIntervalSeconds, or the
+// requeue interval of the controller if unset. This picks up changes of
+// external state no watch event reports, e.g. GPU availability.
+func (c *Controller) scheduleReconcile(key string, inferenceJob *samplev1alpha1.InferenceJob, now time.Time) {
+	c.lastSynced.set(key, now)
+	interval := c.requeueInterval
+	if policy := inferenceJob.Spec.ReconcilePolicy; policy != nil && policy.MaxIntervalSeconds != nil {
+		interval = time.Duration(*policy.MaxIntervalSeconds) * time.Second
+	}
+	if interval > 0 {
+		c.workqueue.AddAfter(key, interval)
+	}
+}
+
+// TemplateHashAnnotation records a hash of the pod template rendered from the
+// InferenceJob on its Deployment. It tells changes of the InferenceJob apart
+// from changes made to the Deployment directly.
+const TemplateHashAnnotation = "fabianoyoschitaki.io/template-hash"
+
+// templateHash hashes a pod template rendered by newDeployment.
+func templateHash(template *corev1.PodTemplateSpec) string {
+	data, err := json.Marshal(template)
+	if err != nil {
+		// Pod templates always marshal.
+		panic(err)
+	}
+	h := fnv.New32a()
+	h.Write(data)
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// templateChanged reports whether the pod template rendered from the
+// InferenceJob changed since the Deployment was last updated.
+func templateChanged(desired, existing *appsv1.Deployment) bool {
+	return desired.Annotations[TemplateHashAnnotation] != existing.Annotations[TemplateHashAnnotation]
+}
+
+// driftCorrection reports whether changes made to the pod template of the
+// Deployment of the InferenceJob are reverted.
+func driftCorrection(inferenceJob *samplev1alpha1.InferenceJob) bool {
+	return inferenceJob.Spec.ReconcilePolicy == nil || !inferenceJob.Spec.ReconcilePolicy.DisableDriftCorrection
+}
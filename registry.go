@@ -0,0 +1,167 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
+	listers "k8s.io/sample-controller/pkg/generated/listers/samplecontroller/v1alpha1"
+)
+
+const (
+	// modelRegistryPath is the path model version events are posted to.
+	modelRegistryPath = "/model-versions"
+	// latestTrack is followed by the versions announced without a stage.
+	latestTrack = "latest"
+
+	// ModelUpdated is used as part of the Event 'reason' when a InferenceJob
+	// is moved to a new model version announced by the model registry.
+	ModelUpdated = "ModelUpdated"
+	// MessageModelUpdated is the message used for an Event fired when a
+	// InferenceJob is moved to a new model version.
+	MessageModelUpdated = "Updated to version %s of model %s"
+)
+
+// modelVersionEvent is posted by the model registry when a model version is
+// published or moved to a stage.
+type modelVersionEvent struct {
+	ModelID string `json:"modelID"`
+	Version string `json:"version"`
+	// Stage is the registry stage the version was moved to, if any.
+	Stage string `json:"stage,omitempty"`
+	// Image and ModelURI are copied onto the InferenceJobs following the
+	// model. Either may be empty to leave the current value.
+	Image    string `json:"image,omitempty"`
+	ModelURI string `json:"modelURI,omitempty"`
+	// SizeBytes is the size of the model, copied onto
+	// spec.modelSizeBytes. Zero if unknown.
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+}
+
+// modelRegistryReceiver updates the InferenceJobs following a model when the
+// model registry announces a new version.
+type modelRegistryReceiver struct {
+	sampleclientset     clientset.Interface
+	inferenceJobsLister listers.InferenceJobLister
+	recorder            record.EventRecorder
+	// token, if set, must be presented as a bearer token.
+	token string
+}
+
+func (rr *modelRegistryReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if rr.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+rr.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	event := modelVersionEvent{}
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil || event.ModelID == "" || event.Version == "" {
+		http.Error(w, "malformed model version event", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := rr.handle(&event)
+	if err != nil {
+		// The registry is expected to retry, updates are idempotent.
+		utilruntime.HandleError(fmt.Errorf("error handling version %s of model %s: %s", event.Version, event.ModelID, err.Error()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	klog.Infof("Version %s of model %s applied to %d inferenceJobs", event.Version, event.ModelID, updated)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handle updates the InferenceJobs serving the model of the event that track
+// its stage. It returns the number of InferenceJobs updated.
+func (rr *modelRegistryReceiver) handle(event *modelVersionEvent) (int, error) {
+	selector := labels.SelectorFromSet(labels.Set{samplev1alpha1.ModelIDLabel: event.ModelID})
+	inferenceJobs, err := rr.inferenceJobsLister.List(selector)
+	if err != nil {
+		return 0, err
+	}
+	track := event.Stage
+	if track == "" {
+		track = latestTrack
+	}
+
+	updated := 0
+	var errs []error
+	for _, inferenceJob := range inferenceJobs {
+		if inferenceJob.Spec.AutoUpdate == nil || inferenceJob.Spec.AutoUpdate.Track != track {
+			continue
+		}
+		if (event.Image == "" || event.Image == inferenceJob.Spec.ImageToDeploy) &&
+			(event.ModelURI == "" || event.ModelURI == inferenceJob.Spec.ModelURI) &&
+			(event.SizeBytes == 0 || (inferenceJob.Spec.ModelSizeBytes != nil && *inferenceJob.Spec.ModelSizeBytes == event.SizeBytes)) {
+			continue
+		}
+		// NEVER modify objects from the store.
+		inferenceJobCopy := inferenceJob.DeepCopy()
+		if event.Image != "" {
+			inferenceJobCopy.Spec.ImageToDeploy = event.Image
+		}
+		if event.ModelURI != "" {
+			inferenceJobCopy.Spec.ModelURI = event.ModelURI
+		}
+		if event.SizeBytes > 0 {
+			sizeBytes := event.SizeBytes
+			inferenceJobCopy.Spec.ModelSizeBytes = &sizeBytes
+		}
+		if _, err := rr.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).Update(inferenceJobCopy); err != nil {
+			errs = append(errs, fmt.Errorf("inferenceJob %s/%s: %s", inferenceJob.Namespace, inferenceJob.Name, err.Error()))
+			continue
+		}
+		rr.recorder.Eventf(inferenceJob, corev1.EventTypeNormal, ModelUpdated, MessageModelUpdated, event.Version, event.ModelID)
+		updated++
+	}
+	if len(errs) > 0 {
+		return updated, fmt.Errorf("%d of the updates failed, first error: %s", len(errs), errs[0].Error())
+	}
+	return updated, nil
+}
+
+// serveModelRegistry serves the model registry receiver over plain HTTP until
+// stopCh is closed.
+func serveModelRegistry(addr string, rr *modelRegistryReceiver, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle(modelRegistryPath, rr)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-stopCh
+		server.Close()
+	}()
+	go func() {
+		klog.Infof("Receiving model registry events on %s", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.Fatalf("Error serving model registry receiver: %s", err.Error())
+		}
+	}()
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// deploymentResourceStatus returns the resource status of a Deployment
+// synced successfully.
+func deploymentResourceStatus(deployment *appsv1.Deployment) samplev1alpha1.ResourceStatus {
+	return samplev1alpha1.ResourceStatus{
+		Kind:            "Deployment",
+		Name:            deployment.Name,
+		LastAppliedHash: deployment.Annotations[TemplateHashAnnotation],
+		LastSyncTime:    metav1.Now(),
+	}
+}
+
+// setResourceStatus replaces the status of the resource of the same kind
+// and name, or adds it.
+func setResourceStatus(status *samplev1alpha1.InferenceJobStatus, resource samplev1alpha1.ResourceStatus) {
+	for i := range status.Resources {
+		if status.Resources[i].Kind == resource.Kind && status.Resources[i].Name == resource.Name {
+			status.Resources[i] = resource
+			return
+		}
+	}
+	status.Resources = append(status.Resources, resource)
+}
+
+// statusChanged reports whether the status of an InferenceJob differs from
+// the current one other than by its sync times, which every sync renews.
+func statusChanged(current, status samplev1alpha1.InferenceJobStatus) bool {
+	current, status = *current.DeepCopy(), *status.DeepCopy()
+	for _, s := range []*samplev1alpha1.InferenceJobStatus{&current, &status} {
+		s.LastSyncTime = nil
+		for i := range s.Resources {
+			s.Resources[i].LastSyncTime = metav1.Time{}
+		}
+	}
+	return !equality.Semantic.DeepEqual(current, status)
+}
+
+// lastSyncRefresh is how often status.lastSyncTime is renewed while the
+// syncs leave the rest of the status unchanged.
+const lastSyncRefresh = 5 * time.Minute
+
+// syncTimeStale reports whether the last sync time of the status is older
+// than lastSyncRefresh at now, or was never set.
+func syncTimeStale(status samplev1alpha1.InferenceJobStatus, now time.Time) bool {
+	return status.LastSyncTime == nil || now.Sub(status.LastSyncTime.Time) >= lastSyncRefresh
+}
+
+// degradedRequeues is the number of consecutive failed syncs after which an
+// InferenceJob is marked Degraded.
+const degradedRequeues = 5
+
+const (
+	// ErrRetriesExhausted is used as part of the Event 'reason' when an
+	// InferenceJob failed to sync more than the maximum number of retries.
+	ErrRetriesExhausted = "RetriesExhausted"
+	// MessageRetriesExhausted is the message used for Events when an
+	// InferenceJob failed to sync more than the maximum number of retries.
+	MessageRetriesExhausted = "Gave up after %d retries, waiting for a spec change: %s"
+)
+
+// recordResourceError records the failed sync of a child in the status of
+// the InferenceJob, keeping the hash it was last rendered from. Failing to
+// record it is only logged, the sync error is what gets retried.
+func (c *Controller) recordResourceError(inferenceJob *samplev1alpha1.InferenceJob, kind, name string, syncErr error) {
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	resource := samplev1alpha1.ResourceStatus{Kind: kind, Name: name}
+	for _, r := range inferenceJob.Status.Resources {
+		if r.Kind == kind && r.Name == name {
+			resource.LastAppliedHash = r.LastAppliedHash
+		}
+	}
+	resource.LastSyncTime = metav1.Now()
+	resource.LastError = syncErr.Error()
+	setResourceStatus(&inferenceJobCopy.Status, resource)
+	if _, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).UpdateStatus(inferenceJobCopy); err != nil {
+		utilruntime.HandleError(fmt.Errorf("error recording sync error of %s %s in inferenceJob %s/%s: %s", kind, name, inferenceJob.Namespace, inferenceJob.Name, err.Error()))
+	}
+}
+
+// markDegraded sets the Degraded condition of an InferenceJob failing to
+// sync repeatedly. The condition is cleared by the next successful sync.
+func (c *Controller) markDegraded(key string, syncErr error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil || c.dryRun {
+		return
+	}
+	inferenceJob, err := c.inferenceJobsLister.InferenceJobs(namespace).Get(name)
+	if err != nil {
+		return
+	}
+	if cond := getCondition(inferenceJob.Status, samplev1alpha1.Degraded); cond != nil && cond.Message == syncErr.Error() {
+		return
+	}
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	setCondition(&inferenceJobCopy.Status, newCondition(samplev1alpha1.Degraded, corev1.ConditionTrue, "SyncFailed", syncErr.Error()))
+	inferenceJobCopy.Status.Phase = inferenceJobPhase(inferenceJobCopy)
+	if _, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(namespace).UpdateStatus(inferenceJobCopy); err != nil {
+		utilruntime.HandleError(fmt.Errorf("error marking inferenceJob %s degraded: %s", key, err.Error()))
+	}
+}
+
+// markFailed sets the Failed condition of an InferenceJob that exhausted
+// its retries and records the generation it failed at. The InferenceJob is
+// synced again once its spec changes.
+func (c *Controller) markFailed(key string, syncErr error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil || c.dryRun {
+		return
+	}
+	inferenceJob, err := c.inferenceJobsLister.InferenceJobs(namespace).Get(name)
+	if err != nil {
+		return
+	}
+	c.recorder.Eventf(inferenceJob, corev1.EventTypeWarning, ErrRetriesExhausted, MessageRetriesExhausted, c.maxRetries, syncErr.Error())
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	setCondition(&inferenceJobCopy.Status, newCondition(samplev1alpha1.Failed, corev1.ConditionTrue, ErrRetriesExhausted, syncErr.Error()))
+	inferenceJobCopy.Status.FailedGeneration = inferenceJob.Generation
+	inferenceJobCopy.Status.Phase = inferenceJobPhase(inferenceJobCopy)
+	if _, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(namespace).UpdateStatus(inferenceJobCopy); err != nil {
+		utilruntime.HandleError(fmt.Errorf("error marking inferenceJob %s failed: %s", key, err.Error()))
+	}
+}
+
+// gaveUp returns whether the controller gave up syncing the current
+// generation of the InferenceJob.
+func gaveUp(inferenceJob *samplev1alpha1.InferenceJob) bool {
+	cond := getCondition(inferenceJob.Status, samplev1alpha1.Failed)
+	return cond != nil && cond.Status == corev1.ConditionTrue && inferenceJob.Status.FailedGeneration == inferenceJob.Generation
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/sample-controller/pkg/client/bulk"
+	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
+)
+
+// restartInferenceJobs runs the restart subcommand, rolling the pods of the
+// selected InferenceJobs by setting their RestartedAtAnnotation. The pods are
+// replaced according to the rollout strategy of each InferenceJob.
+func restartInferenceJobs(sampleclientset clientset.Interface, args []string) error {
+	flags := flag.NewFlagSet("restart", flag.ContinueOnError)
+	namespace := flags.String("namespace", metav1.NamespaceAll, "Namespace of the InferenceJobs to restart. All namespaces if empty.")
+	selector := flags.String("selector", "", "Label selector of the InferenceJobs to restart. All InferenceJobs if empty.")
+	concurrency := flags.Int("concurrency", bulk.DefaultConcurrency, "Number of InferenceJobs updated in parallel.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	results, err := bulk.New(sampleclientset, *concurrency).Restart(*namespace, *selector)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("Failed to restart inferenceJob %s/%s: %s\n", result.Namespace, result.Name, result.Err.Error())
+			failed++
+		}
+	}
+	fmt.Printf("Restarted %d InferenceJobs\n", len(results)-failed)
+	if failed > 0 {
+		return fmt.Errorf("%d InferenceJobs failed to restart", failed)
+	}
+	return nil
+}
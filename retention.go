@@ -0,0 +1,218 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+const (
+	// RetainFinalizer holds the deletion of InferenceJobs with the Retain
+	// deletion policy until their Deployments have been orphaned.
+	RetainFinalizer = "fabianoyoschitaki.io/retain-children"
+	// RetainedFromLabel is set on retained Deployments to the name of the
+	// deleted InferenceJob.
+	RetainedFromLabel = "fabianoyoschitaki.io/retained-from"
+	// RetainedUntilLabel is set on retained Deployments to the Unix time
+	// they are removed at.
+	RetainedUntilLabel = "fabianoyoschitaki.io/retained-until"
+
+	// defaultRetention is the retention period of InferenceJobs without
+	// spec.retentionHours.
+	defaultRetention = 24 * time.Hour
+	// retentionSweepInterval is how often expired Deployments are removed.
+	retentionSweepInterval = time.Minute
+
+	// SuccessAdopted is used as part of the Event 'reason' when a retained
+	// or, with spec.adoptExisting, a pre-existing Deployment is adopted.
+	SuccessAdopted = "Adopted"
+	// MessageAdopted is the message used for an Event fired when a retained
+	// Deployment is adopted by a recreated InferenceJob.
+	MessageAdopted = "Adopted retained Deployment %q"
+	// MessageAdoptedExisting is the message used for an Event fired when a
+	// pre-existing Deployment is adopted with spec.adoptExisting.
+	MessageAdoptedExisting = "Adopted existing Deployment %q"
+)
+
+// syncRetainFinalizer adds RetainFinalizer to InferenceJobs with the Retain
+// deletion policy and removes it from the others. It returns true if the
+// InferenceJob was updated, in which case the sync ends and continues with
+// the update event.
+func (c *Controller) syncRetainFinalizer(inferenceJob *samplev1alpha1.InferenceJob) (bool, error) {
+	retain := inferenceJob.Spec.DeletionPolicy == samplev1alpha1.DeletionPolicyRetain
+	if retain == hasFinalizer(inferenceJob, RetainFinalizer) {
+		return false, nil
+	}
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	if retain {
+		inferenceJobCopy.Finalizers = append(inferenceJobCopy.Finalizers, RetainFinalizer)
+	} else {
+		inferenceJobCopy.Finalizers = removeFinalizer(inferenceJobCopy.Finalizers, RetainFinalizer)
+	}
+	_, err := c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).Update(inferenceJobCopy)
+	return true, err
+}
+
+// retainDeployments orphans the Deployments of a deleted InferenceJob,
+// labelling them for removal once the retention period is over, and then
+// releases the InferenceJob by removing RetainFinalizer.
+func (c *Controller) retainDeployments(inferenceJob *samplev1alpha1.InferenceJob) error {
+	retention := defaultRetention
+	if inferenceJob.Spec.RetentionHours > 0 {
+		retention = time.Duration(inferenceJob.Spec.RetentionHours) * time.Hour
+	}
+	until := strconv.FormatInt(time.Now().Add(retention).Unix(), 10)
+
+	deployments, err := c.ownedDeployments(inferenceJob)
+	if err != nil {
+		return err
+	}
+	for _, deployment := range deployments {
+		if !metav1.IsControlledBy(deployment, inferenceJob) {
+			continue
+		}
+		ownerRefs := []metav1.OwnerReference{}
+		for _, ref := range deployment.OwnerReferences {
+			if ref.UID != inferenceJob.UID {
+				ownerRefs = append(ownerRefs, ref)
+			}
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"ownerReferences": ownerRefs,
+				"labels": map[string]interface{}{
+					RetainedFromLabel:  inferenceJob.Name,
+					RetainedUntilLabel: until,
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := c.kubeclientset.AppsV1().Deployments(deployment.Namespace).Patch(deployment.Name, types.MergePatchType, patch); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		klog.Infof("Retaining deployment %s/%s of deleted inferenceJob %s for %s", deployment.Namespace, deployment.Name, inferenceJob.Name, retention)
+	}
+
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	inferenceJobCopy.Finalizers = removeFinalizer(inferenceJobCopy.Finalizers, RetainFinalizer)
+	_, err = c.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(inferenceJob.Namespace).Update(inferenceJobCopy)
+	return err
+}
+
+// adoptDeployment hands a Deployment retained from a deleted InferenceJob of
+// the same name back to the recreated InferenceJob or, with
+// spec.adoptExisting, takes over a Deployment no controller owns. It returns
+// nil if the Deployment can't be adopted.
+func (c *Controller) adoptDeployment(inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
+	if metav1.GetControllerOf(deployment) != nil {
+		return nil, nil
+	}
+	retained := deployment.Labels[RetainedFromLabel] == inferenceJob.Name
+	if !retained && !inferenceJob.Spec.AdoptExisting {
+		return nil, nil
+	}
+	ownerRefs := append([]metav1.OwnerReference{}, deployment.OwnerReferences...)
+	ownerRefs = append(ownerRefs, *metav1.NewControllerRef(inferenceJob, samplev1alpha1.SchemeGroupVersion.WithKind("InferenceJob")))
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": ownerRefs,
+			"labels": map[string]interface{}{
+				RetainedFromLabel:    nil,
+				RetainedUntilLabel:   nil,
+				InferenceJobUIDLabel: string(inferenceJob.UID),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	adopted, err := c.kubeclientset.AppsV1().Deployments(deployment.Namespace).Patch(deployment.Name, types.MergePatchType, patch)
+	if err != nil {
+		return nil, err
+	}
+	msg := MessageAdoptedExisting
+	if retained {
+		msg = MessageAdopted
+	}
+	c.recorder.Event(inferenceJob, corev1.EventTypeNormal, SuccessAdopted, fmt.Sprintf(msg, deployment.Name))
+	return adopted, nil
+}
+
+// sweepRetainedDeployments removes retained Deployments whose retention
+// period is over.
+func (c *Controller) sweepRetainedDeployments() {
+	requirement, err := labels.NewRequirement(RetainedUntilLabel, selection.Exists, nil)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	deployments, err := c.deploymentsLister.List(labels.NewSelector().Add(*requirement))
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	now := time.Now().Unix()
+	for _, deployment := range deployments {
+		until, err := strconv.ParseInt(deployment.Labels[RetainedUntilLabel], 10, 64)
+		if err != nil || until > now || metav1.GetControllerOf(deployment) != nil || c.observing(deployment.Namespace) ||
+			!c.shards.owns(deployment.Namespace+"/"+deployment.Name) {
+			continue
+		}
+		klog.Infof("Removing deployment %s/%s, its retention period is over", deployment.Namespace, deployment.Name)
+		err = c.kubeclientset.AppsV1().Deployments(deployment.Namespace).Delete(deployment.Name, nil)
+		if err != nil && !errors.IsNotFound(err) {
+			utilruntime.HandleError(fmt.Errorf("error removing retained deployment %s/%s: %s", deployment.Namespace, deployment.Name, err.Error()))
+		}
+	}
+}
+
+func hasFinalizer(inferenceJob *samplev1alpha1.InferenceJob, finalizer string) bool {
+	for _, f := range inferenceJob.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFinalizer(finalizers []string, finalizer string) []string {
+	var out []string
+	for _, f := range finalizers {
+		if f != finalizer {
+			out = append(out, f)
+		}
+	}
+	return out
+}
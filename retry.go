@@ -0,0 +1,260 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// retryClass groups sync errors retried with the same backoff.
+type retryClass string
+
+const (
+	// retryDefault covers errors of no other class, e.g. network failures.
+	retryDefault retryClass = "default"
+	// retryThrottled covers requests rejected by API priority and fairness
+	// or max-in-flight limits.
+	retryThrottled retryClass = "throttled"
+	// retryWebhook covers admission webhooks that failed or timed out.
+	retryWebhook retryClass = "webhook"
+	// retryQuota covers writes exceeding a ResourceQuota, which rarely
+	// clears up within seconds.
+	retryQuota retryClass = "quota"
+	// retryConflict covers writes based on a stale resourceVersion.
+	retryConflict retryClass = "conflict"
+)
+
+// retryBackoff is an exponential backoff curve, doubling from base up to
+// max with each failure.
+type retryBackoff struct {
+	base, max time.Duration
+}
+
+// defaultRetryBackoffs are the backoff curves of the classes not set with
+// --retry-backoffs. The default class matches the workqueue's default.
+var defaultRetryBackoffs = map[retryClass]retryBackoff{
+	retryDefault:   {5 * time.Millisecond, 1000 * time.Second},
+	retryThrottled: {time.Second, 5 * time.Minute},
+	retryWebhook:   {time.Second, 2 * time.Minute},
+	retryQuota:     {30 * time.Second, 30 * time.Minute},
+	retryConflict:  {5 * time.Millisecond, 10 * time.Second},
+}
+
+// classifyError returns the retry class of a sync error.
+func classifyError(err error) retryClass {
+	switch {
+	case errors.IsTooManyRequests(err):
+		return retryThrottled
+	case errors.IsConflict(err):
+		return retryConflict
+	case errors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota"):
+		return retryQuota
+	case strings.Contains(err.Error(), "failed calling webhook"):
+		return retryWebhook
+	}
+	return retryDefault
+}
+
+// parseRetryBackoffs parses a comma-separated list of class=base:max
+// backoff curves, e.g. quota=1m:1h, over the default ones.
+func parseRetryBackoffs(value string) (map[retryClass]retryBackoff, error) {
+	backoffs := map[retryClass]retryBackoff{}
+	for class, backoff := range defaultRetryBackoffs {
+		backoffs[class] = backoff
+	}
+	for _, entry := range splitList(value) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid retry backoff %q, must be class=base:max", entry)
+		}
+		class := retryClass(parts[0])
+		if _, ok := defaultRetryBackoffs[class]; !ok {
+			return nil, fmt.Errorf("unknown retry class %q", class)
+		}
+		durations := strings.SplitN(parts[1], ":", 2)
+		if len(durations) != 2 {
+			return nil, fmt.Errorf("invalid retry backoff %q, must be class=base:max", entry)
+		}
+		base, err := time.ParseDuration(durations[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid base delay of retry class %s: %s", class, err.Error())
+		}
+		max, err := time.ParseDuration(durations[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid max delay of retry class %s: %s", class, err.Error())
+		}
+		if base <= 0 || max < base {
+			return nil, fmt.Errorf("invalid retry backoff %q, base must be positive and at most max", entry)
+		}
+		backoffs[class] = retryBackoff{base, max}
+	}
+	return backoffs, nil
+}
+
+const (
+	// defaultRetryQPS and defaultRetryBurst limit the overall rate of
+	// retries as the workqueue's default rate limiter does.
+	defaultRetryQPS   = 10
+	defaultRetryBurst = 100
+)
+
+// defaultRetryBackoff returns the --retry-backoffs entry of the default
+// class for the --retry-base-delay and --retry-max-delay shorthands, or an
+// empty string if neither is set. Unset delays keep their default.
+func defaultRetryBackoff(base, max time.Duration) string {
+	if base == 0 && max == 0 {
+		return ""
+	}
+	if base == 0 {
+		base = defaultRetryBackoffs[retryDefault].base
+	}
+	if max == 0 {
+		max = defaultRetryBackoffs[retryDefault].max
+	}
+	return fmt.Sprintf("%s=%s:%s,", retryDefault, base, max)
+}
+
+// classRateLimiter backs off retries of a work item on the curve of the
+// class of its last sync error, and limits the overall rate of retries of
+// all items. The requeues of an item are counted across classes, so errors
+// alternating between classes still add up to --max-retries.
+type classRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[retryClass]workqueue.RateLimiter
+	classes  map[interface{}]retryClass
+	requeues map[interface{}]int
+	overall  *bucketRateLimiter
+}
+
+func newClassRateLimiter(backoffs map[retryClass]retryBackoff) *classRateLimiter {
+	r := &classRateLimiter{
+		classes:  map[interface{}]retryClass{},
+		requeues: map[interface{}]int{},
+		overall:  newBucketRateLimiter(defaultRetryQPS, defaultRetryBurst),
+	}
+	r.configure(backoffs)
+	return r
+}
+
+// limitOverall replaces the overall rate limit of retries, disabled if qps
+// is 0. It must be called before the workers are started.
+func (r *classRateLimiter) limitOverall(qps float64, burst int) {
+	r.overall = newBucketRateLimiter(qps, burst)
+}
+
+// configure replaces the backoff curves. It must be called before the
+// workers are started.
+func (r *classRateLimiter) configure(backoffs map[retryClass]retryBackoff) {
+	limiters := map[retryClass]workqueue.RateLimiter{}
+	for class, backoff := range backoffs {
+		limiters[class] = workqueue.NewItemExponentialFailureRateLimiter(backoff.base, backoff.max)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limiters = limiters
+}
+
+// observe records the sync error the item is about to be retried for.
+func (r *classRateLimiter) observe(item interface{}, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.classes[item] = classifyError(err)
+}
+
+func (r *classRateLimiter) limiter(item interface{}) workqueue.RateLimiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if limiter, ok := r.limiters[r.classes[item]]; ok {
+		return limiter
+	}
+	return r.limiters[retryDefault]
+}
+
+func (r *classRateLimiter) When(item interface{}) time.Duration {
+	r.mu.Lock()
+	r.requeues[item]++
+	r.mu.Unlock()
+	delay := r.limiter(item).When(item)
+	if overall := r.overall.When(item); overall > delay {
+		return overall
+	}
+	return delay
+}
+
+func (r *classRateLimiter) NumRequeues(item interface{}) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requeues[item]
+}
+
+func (r *classRateLimiter) Forget(item interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, limiter := range r.limiters {
+		limiter.Forget(item)
+	}
+	delete(r.classes, item)
+	delete(r.requeues, item)
+}
+
+// bucketRateLimiter is a token bucket refilled at qps up to burst tokens,
+// delaying the items taking tokens the bucket doesn't have yet.
+type bucketRateLimiter struct {
+	mu     sync.Mutex
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newBucketRateLimiter(qps float64, burst int) *bucketRateLimiter {
+	return &bucketRateLimiter{qps: qps, burst: float64(burst), tokens: float64(burst), now: time.Now}
+}
+
+func (b *bucketRateLimiter) When(item interface{}) time.Duration {
+	if b.qps <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.qps
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.qps * float64(time.Second))
+}
+
+func (b *bucketRateLimiter) NumRequeues(item interface{}) int {
+	return 0
+}
+
+func (b *bucketRateLimiter) Forget(item interface{}) {}
@@ -0,0 +1,154 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+// PodDeletionCostAnnotation is read by the ReplicaSet controller to pick which
+// pods to remove first on scale-down; pods with a lower cost go first.
+const PodDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+
+// podLoadProvider reports the current request rate served by a pod.
+type podLoadProvider interface {
+	RequestRate(pod *corev1.Pod) (float64, error)
+}
+
+// scrapedPodLoad reads the request rate from a gauge exposed by the model
+// server in the Prometheus text format.
+type scrapedPodLoad struct {
+	port   int
+	path   string
+	metric string
+	client *http.Client
+}
+
+func newScrapedPodLoad(port int, path, metric string) *scrapedPodLoad {
+	return &scrapedPodLoad{
+		port:   port,
+		path:   path,
+		metric: metric,
+		client: &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+// RequestRate scrapes the pod and sums every sample of the configured metric.
+func (s *scrapedPodLoad) RequestRate(pod *corev1.Pod) (float64, error) {
+	if pod.Status.PodIP == "" {
+		return 0, fmt.Errorf("pod %s has no IP", pod.Name)
+	}
+	resp, err := s.client.Get(fmt.Sprintf("http://%s:%d%s", pod.Status.PodIP, s.port, s.path))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("scraping pod %s: unexpected status %d", pod.Name, resp.StatusCode)
+	}
+
+	var total float64
+	found := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, s.metric) {
+			continue
+		}
+		rest := line[len(s.metric):]
+		if rest == "" || (rest[0] != ' ' && rest[0] != '{') {
+			// A different metric sharing our prefix.
+			continue
+		}
+		fields := strings.Fields(rest[strings.LastIndex(rest, "}")+1:])
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		total += v
+		found = true
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("metric %q not exposed by pod %s", s.metric, pod.Name)
+	}
+	return total, nil
+}
+
+// setPodDeletionCosts annotates the running pods of the Deployment with their
+// current request rate as deletion cost, so a following scale-down removes
+// the least loaded replicas first. Pods whose load can't be determined are
+// left untouched.
+func (c *Controller) setPodDeletionCosts(deployment *appsv1.Deployment) error {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return err
+	}
+	pods, err := c.kubeclientset.CoreV1().Pods(deployment.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		rate, err := c.podLoad.RequestRate(pod)
+		if err != nil {
+			klog.V(4).Infof("Skipping deletion cost for pod %s/%s: %s", pod.Namespace, pod.Name, err.Error())
+			continue
+		}
+		if rate > math.MaxInt32 {
+			rate = math.MaxInt32
+		}
+		cost := strconv.Itoa(int(rate))
+		if pod.Annotations[PodDeletionCostAnnotation] == cost {
+			continue
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{PodDeletionCostAnnotation: cost},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := c.kubeclientset.CoreV1().Pods(pod.Namespace).Patch(pod.Name, types.MergePatchType, patch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	// ShardIndexLabel and ShardCountLabel identify the shard a Lease of a
+	// sharded controller is held for.
+	ShardIndexLabel = "fabianoyoschitaki.io/shard-index"
+	ShardCountLabel = "fabianoyoschitaki.io/shard-count"
+)
+
+const (
+	// shardLeaseDuration is how long the Lease of a shard is held without
+	// being renewed.
+	shardLeaseDuration = 15 * time.Second
+	// shardRenewInterval is how often the Lease of a shard is renewed and
+	// the Leases of the other shards are checked.
+	shardRenewInterval = 5 * time.Second
+)
+
+// shardOf returns the shard out of count the namespace/name key belongs to.
+func shardOf(key string, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(count))
+}
+
+// shardLease is a Lease held for a shard.
+type shardLease struct {
+	index, count int
+	acquired     time.Time
+}
+
+// shards runs one shard out of count of a sharded controller. The shard
+// owns the keys that hash to it while it holds the Lease of the shard, so
+// a second replica of the same shard stands by.
+//
+// Changing the number of shards reassigns keys. Until the Lease of the
+// shard a key was assigned to before is released or expires, the shard
+// that acquired its Lease first keeps the key, so a key is never synced
+// by two replicas during the rollout of a new shard count.
+type shards struct {
+	index, count int
+	client       kubernetes.Interface
+	namespace    string
+	identity     string
+	// onChange is called when the keys owned may have changed.
+	onChange func()
+
+	mu sync.RWMutex
+	// held is the Lease of the shard while it is held, lastRenew when it
+	// was last renewed.
+	held      *shardLease
+	lastRenew time.Time
+	// peers are the Leases held for shards of other shard counts.
+	peers []shardLease
+	// primaryWork runs while the shard is primary, until primaryStop is
+	// closed.
+	primaryWork []func(stopCh <-chan struct{})
+	primaryStop chan struct{}
+}
+
+func newShards(client kubernetes.Interface, namespace, identity string, index, count int) *shards {
+	return &shards{index: index, count: count, client: client, namespace: namespace, identity: identity}
+}
+
+func (s *shards) leaseName() string {
+	return fmt.Sprintf("%s-shard-%d-of-%d", controllerAgentName, s.index, s.count)
+}
+
+// owns returns whether the shard syncs the namespace/name key. Every key is
+// owned if the controller isn't sharded.
+func (s *shards) owns(key string) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.held == nil || shardOf(key, s.count) != s.index {
+		return false
+	}
+	for _, peer := range s.peers {
+		if shardOf(key, peer.count) == peer.index && peer.acquired.Before(s.held.acquired) {
+			return false
+		}
+	}
+	return true
+}
+
+// primary returns whether the shard runs the work that isn't split by key:
+// it is the first shard and holds its Lease, and no first shard of another
+// shard count held its Lease before. Always true if the controller isn't
+// sharded.
+func (s *shards) primary() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.isPrimary()
+}
+
+func (s *shards) isPrimary() bool {
+	if s.index != 0 || s.held == nil {
+		return false
+	}
+	for _, peer := range s.peers {
+		if peer.index == 0 && peer.acquired.Before(s.held.acquired) {
+			return false
+		}
+	}
+	return true
+}
+
+// runPrimary runs work while the shard is primary, see primary. It is
+// started when the shard becomes primary and its stop channel is closed
+// when the shard stops being primary or releases its Lease, so a standby
+// replica doesn't duplicate it. If the controller isn't sharded, work runs
+// until stopCh is closed.
+func (s *shards) runPrimary(stopCh <-chan struct{}, work func(stopCh <-chan struct{})) {
+	if s == nil {
+		go work(stopCh)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.primaryWork = append(s.primaryWork, work)
+	if s.primaryStop != nil {
+		go work(s.primaryStop)
+	}
+}
+
+// setPrimary starts or stops the primary work as the shard became or
+// stopped being primary. s.mu must be held.
+func (s *shards) setPrimary(primary bool) {
+	switch {
+	case primary && s.primaryStop == nil:
+		klog.Infof("Shard %d of %d is primary, starting the work that isn't sharded", s.index, s.count)
+		s.primaryStop = make(chan struct{})
+		for _, work := range s.primaryWork {
+			go work(s.primaryStop)
+		}
+	case !primary && s.primaryStop != nil:
+		klog.Infof("Shard %d of %d is no longer primary, stopping the work that isn't sharded", s.index, s.count)
+		close(s.primaryStop)
+		s.primaryStop = nil
+	}
+}
+
+// renew acquires or renews the Lease of the shard and refreshes the Leases
+// of the shards of other shard counts. onChange is called if that changes
+// the keys owned.
+func (s *shards) renew() {
+	now := time.Now()
+	held, err := s.renewLease(now)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("error renewing the lease of shard %d of %d: %s", s.index, s.count, err.Error()))
+	}
+	peers, listErr := s.listPeers(now)
+	if listErr != nil {
+		utilruntime.HandleError(fmt.Errorf("error listing the leases of other shards: %s", listErr.Error()))
+	}
+
+	s.mu.Lock()
+	before := s.held
+	beforePeers := s.peers
+	switch {
+	case err == nil:
+		s.held = held
+		if held != nil {
+			s.lastRenew = now
+		}
+	case s.held != nil && now.Sub(s.lastRenew) >= shardLeaseDuration:
+		// Another replica may have taken over the expired Lease.
+		s.held = nil
+	}
+	if listErr == nil {
+		s.peers = peers
+	}
+	changed := !reflect.DeepEqual(before, s.held) || !reflect.DeepEqual(beforePeers, s.peers)
+	after := s.held
+	s.setPrimary(s.isPrimary())
+	s.mu.Unlock()
+
+	if (before == nil) != (after == nil) {
+		if after != nil {
+			klog.Infof("Acquired the lease of shard %d of %d", s.index, s.count)
+		} else {
+			klog.Warningf("Lost the lease of shard %d of %d", s.index, s.count)
+		}
+	}
+	if changed && s.onChange != nil {
+		s.onChange()
+	}
+}
+
+// renewLease acquires or renews the Lease of the shard. It returns nil
+// while another replica holds it.
+func (s *shards) renewLease(now time.Time) (*shardLease, error) {
+	leases := s.client.CoordinationV1().Leases(s.namespace)
+	renewTime := metav1.NewMicroTime(now)
+	lease, err := leases.Get(s.leaseName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		lease, err = leases.Create(s.newLease(renewTime))
+		if err != nil {
+			return nil, err
+		}
+		return &shardLease{index: s.index, count: s.count, acquired: lease.Spec.AcquireTime.Time}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if holder := leaseHolder(lease); holder != s.identity && holder != "" && !leaseExpired(lease, now) {
+		return nil, nil
+	}
+	if leaseHolder(lease) != s.identity {
+		lease.Spec.HolderIdentity = &s.identity
+		lease.Spec.AcquireTime = &renewTime
+		transitions := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions += *lease.Spec.LeaseTransitions
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+	lease.Spec.RenewTime = &renewTime
+	if lease, err = leases.Update(lease); err != nil {
+		return nil, err
+	}
+	return &shardLease{index: s.index, count: s.count, acquired: lease.Spec.AcquireTime.Time}, nil
+}
+
+func (s *shards) newLease(now metav1.MicroTime) *coordinationv1.Lease {
+	duration := int32(shardLeaseDuration / time.Second)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.leaseName(),
+			Namespace: s.namespace,
+			Labels: map[string]string{
+				ShardIndexLabel: strconv.Itoa(s.index),
+				ShardCountLabel: strconv.Itoa(s.count),
+			},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &s.identity,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	}
+}
+
+// listPeers returns the Leases held for the shards of other shard counts,
+// ordered by name.
+func (s *shards) listPeers(now time.Time) ([]shardLease, error) {
+	list, err := s.client.CoordinationV1().Leases(s.namespace).List(metav1.ListOptions{LabelSelector: ShardCountLabel})
+	if err != nil {
+		return nil, err
+	}
+	var peers []shardLease
+	for i := range list.Items {
+		lease := &list.Items[i]
+		index, indexErr := strconv.Atoi(lease.Labels[ShardIndexLabel])
+		count, countErr := strconv.Atoi(lease.Labels[ShardCountLabel])
+		if indexErr != nil || countErr != nil || count <= 0 || count == s.count ||
+			leaseHolder(lease) == "" || leaseExpired(lease, now) || lease.Spec.AcquireTime == nil {
+			continue
+		}
+		peers = append(peers, shardLease{index: index, count: count, acquired: lease.Spec.AcquireTime.Time})
+	}
+	return peers, nil
+}
+
+// release gives up the Lease of the shard, so the shards of a new shard
+// count take over its keys without waiting for it to expire.
+func (s *shards) release() {
+	s.mu.Lock()
+	s.held = nil
+	s.setPrimary(false)
+	s.mu.Unlock()
+	leases := s.client.CoordinationV1().Leases(s.namespace)
+	lease, err := leases.Get(s.leaseName(), metav1.GetOptions{})
+	if err != nil || leaseHolder(lease) != s.identity {
+		return
+	}
+	lease.Spec.HolderIdentity = nil
+	if _, err := leases.Update(lease); err != nil {
+		utilruntime.HandleError(fmt.Errorf("error releasing the lease of shard %d of %d: %s", s.index, s.count, err.Error()))
+	}
+}
+
+func leaseHolder(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second).Before(now)
+}
@@ -0,0 +1,421 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/naming"
+)
+
+const (
+	// defaultPostRolloutTestTimeout bounds post-rollout tests without
+	// spec.postRolloutTest.timeoutSeconds.
+	defaultPostRolloutTestTimeout = 60 * time.Second
+	// postRolloutTestPollInterval is how often running test Jobs are
+	// checked.
+	postRolloutTestPollInterval = 10 * time.Second
+	// defaultPostRolloutTestAttempts is how often failing post-rollout
+	// tests are run without spec.postRolloutTest.maxAttempts.
+	defaultPostRolloutTestAttempts = 3
+	// postRolloutTestRetryInterval is the backoff before the second attempt
+	// of a failing post-rollout test, doubled for every further attempt up
+	// to maxPostRolloutTestRetryInterval.
+	postRolloutTestRetryInterval    = 15 * time.Second
+	maxPostRolloutTestRetryInterval = 5 * time.Minute
+	// maxPostRolloutTestBody is the most of a response body matched
+	// against the expected pattern.
+	maxPostRolloutTestBody = 1 << 20
+
+	// SuccessPostRolloutTest is used as part of the Event 'reason' when a
+	// rollout passes its post-rollout test.
+	SuccessPostRolloutTest = "PostRolloutTestPassed"
+	// ErrPostRolloutTest is used as part of the Event 'reason' when a
+	// rollout fails its post-rollout test.
+	ErrPostRolloutTest = "PostRolloutTestFailed"
+)
+
+// postRolloutTest runs the post-rollout test of the InferenceJob once the
+// rollout of its Deployment completed, and returns the result to record in
+// status. The previous result is returned while the rollout or the test
+// is in progress, and for rollouts already tested. Failed tests are run
+// again after a backoff until spec.postRolloutTest.maxAttempts is reached.
+func (c *Controller) postRolloutTest(key string, inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment) (*samplev1alpha1.PostRolloutTestResult, error) {
+	test := inferenceJob.Spec.PostRolloutTest
+	if test == nil {
+		return nil, nil
+	}
+	previous := inferenceJob.Status.PostRolloutTest
+	revision := deployment.Annotations[TemplateHashAnnotation]
+	attempt := int32(1)
+	if previous != nil && previous.Revision == revision {
+		if previous.Passed || previous.Attempts >= postRolloutTestAttempts(test) {
+			return previous, nil
+		}
+		if wait := postRolloutTestBackoff(previous.Attempts) - time.Since(previous.CompletedAt.Time); wait > 0 {
+			c.workqueue.AddAfter(key, wait)
+			return previous, nil
+		}
+		attempt = previous.Attempts + 1
+	}
+	// There is nothing to test without replicas.
+	if !rolloutComplete(deployment) || deployment.Status.AvailableReplicas == 0 {
+		return previous, nil
+	}
+
+	timeout := defaultPostRolloutTestTimeout
+	if test.TimeoutSeconds > 0 {
+		timeout = time.Duration(test.TimeoutSeconds) * time.Second
+	}
+	var result *samplev1alpha1.PostRolloutTestResult
+	switch {
+	case test.HTTP != nil:
+		// The request runs in the background, its result is picked up by
+		// the sync following it.
+		result = c.rolloutTests.run(key, revision, attempt, func() *samplev1alpha1.PostRolloutTestResult {
+			return c.runHTTPRolloutTest(test.HTTP, deployment, timeout)
+		}, func() {
+			c.workqueue.Add(key)
+		})
+		if result == nil {
+			return previous, nil
+		}
+	case test.Image != "":
+		var err error
+		if result, err = c.runRolloutTestJob(inferenceJob, deployment, revision, attempt, timeout); err != nil {
+			return previous, err
+		}
+		if result == nil {
+			c.workqueue.AddAfter(key, postRolloutTestPollInterval)
+			return previous, nil
+		}
+	default:
+		return nil, nil
+	}
+	result.Revision = revision
+	result.Attempts = attempt
+	result.CompletedAt = metav1.Now()
+	switch {
+	case result.Passed:
+		c.recorder.Eventf(inferenceJob, corev1.EventTypeNormal, SuccessPostRolloutTest, "Rollout of deployment %q passed its post-rollout test in %dms", deployment.Name, result.LatencyMilliseconds)
+	case attempt < postRolloutTestAttempts(test):
+		klog.V(2).Infof("Rollout of deployment %s/%s failed attempt %d of its post-rollout test, retrying: %s", deployment.Namespace, deployment.Name, attempt, result.Message)
+		c.workqueue.AddAfter(key, postRolloutTestBackoff(attempt))
+	default:
+		c.recorder.Eventf(inferenceJob, corev1.EventTypeWarning, ErrPostRolloutTest, "Rollout of deployment %q failed its post-rollout test %d times: %s", deployment.Name, attempt, result.Message)
+	}
+	return result, nil
+}
+
+// postRolloutTestAttempts returns how often the test is run before the
+// revision is marked failed.
+func postRolloutTestAttempts(test *samplev1alpha1.PostRolloutTest) int32 {
+	if test.MaxAttempts > 0 {
+		return test.MaxAttempts
+	}
+	return defaultPostRolloutTestAttempts
+}
+
+// postRolloutTestBackoff returns the delay after the failed attempt of a
+// post-rollout test before the next one.
+func postRolloutTestBackoff(attempt int32) time.Duration {
+	backoff := postRolloutTestRetryInterval
+	for i := int32(1); i < attempt && backoff < maxPostRolloutTestRetryInterval; i++ {
+		backoff *= 2
+	}
+	if backoff > maxPostRolloutTestRetryInterval {
+		return maxPostRolloutTestRetryInterval
+	}
+	return backoff
+}
+
+// rolloutTestRunner runs the HTTP post-rollout tests of InferenceJobs in
+// the background so syncs don't wait for the response.
+type rolloutTestRunner struct {
+	mu   sync.Mutex
+	runs map[string]*rolloutTestRun
+}
+
+type rolloutTestRun struct {
+	revision string
+	attempt  int32
+	result   *samplev1alpha1.PostRolloutTestResult
+}
+
+func newRolloutTestRunner() *rolloutTestRunner {
+	return &rolloutTestRunner{runs: map[string]*rolloutTestRun{}}
+}
+
+// run returns the result of the attempt of the revision if an earlier call
+// started it and it finished, and nil while it runs. Otherwise it starts
+// test, calling done once it returns.
+func (r *rolloutTestRunner) run(key, revision string, attempt int32, test func() *samplev1alpha1.PostRolloutTestResult, done func()) *samplev1alpha1.PostRolloutTestResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if run, ok := r.runs[key]; ok && run.revision == revision && run.attempt == attempt {
+		if run.result != nil {
+			delete(r.runs, key)
+		}
+		return run.result
+	}
+	run := &rolloutTestRun{revision: revision, attempt: attempt}
+	r.runs[key] = run
+	go func() {
+		result := test()
+		r.mu.Lock()
+		run.result = result
+		r.mu.Unlock()
+		done()
+	}()
+	return nil
+}
+
+// forget drops the test of a deleted InferenceJob.
+func (r *rolloutTestRunner) forget(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.runs, key)
+}
+
+// rolloutComplete reports whether every replica of the Deployment runs the
+// current pod template and is available.
+func rolloutComplete(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.Replicas == replicas &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+// runHTTPRolloutTest sends the test request to a ready pod of the
+// Deployment.
+func (c *Controller) runHTTPRolloutTest(test *samplev1alpha1.HTTPRolloutTest, deployment *appsv1.Deployment, timeout time.Duration) *samplev1alpha1.PostRolloutTestResult {
+	failed := func(format string, args ...interface{}) *samplev1alpha1.PostRolloutTestResult {
+		return &samplev1alpha1.PostRolloutTestResult{Message: fmt.Sprintf(format, args...)}
+	}
+	pod, err := c.readyPod(deployment)
+	if err != nil {
+		return failed("%s", err.Error())
+	}
+	expectedStatus := 200
+	if test.ExpectedStatus != 0 {
+		expectedStatus = int(test.ExpectedStatus)
+	}
+	var pattern *regexp.Regexp
+	if test.ExpectedBodyPattern != "" {
+		if pattern, err = regexp.Compile(test.ExpectedBodyPattern); err != nil {
+			return failed("invalid expected body pattern: %s", err.Error())
+		}
+	}
+	method := test.Method
+	if method == "" {
+		method = http.MethodGet
+		if test.Body != "" {
+			method = http.MethodPost
+		}
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("http://%s:%d%s", pod.Status.PodIP, test.Port, test.Path), strings.NewReader(test.Body))
+	if err != nil {
+		return failed("%s", err.Error())
+	}
+	client := &http.Client{Timeout: timeout}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return failed("%s", err.Error())
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPostRolloutTestBody))
+	latency := time.Since(start)
+	if err != nil {
+		return failed("reading response of pod %s: %s", pod.Name, err.Error())
+	}
+
+	result := &samplev1alpha1.PostRolloutTestResult{LatencyMilliseconds: latency.Nanoseconds() / int64(time.Millisecond)}
+	switch {
+	case resp.StatusCode != expectedStatus:
+		result.Message = fmt.Sprintf("pod %s responded with status %d, expected %d", pod.Name, resp.StatusCode, expectedStatus)
+	case pattern != nil && !pattern.Match(body):
+		result.Message = fmt.Sprintf("response of pod %s doesn't match %q", pod.Name, test.ExpectedBodyPattern)
+	default:
+		result.Passed = true
+	}
+	return result
+}
+
+// readyPod returns a ready pod of the Deployment.
+func (c *Controller) readyPod(deployment *appsv1.Deployment) (*corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := c.kubeclientset.CoreV1().Pods(deployment.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp == nil && pod.Status.PodIP != "" && podReady(pod) {
+			return pod, nil
+		}
+	}
+	return nil, fmt.Errorf("deployment %s has no ready pod", deployment.Name)
+}
+
+// runRolloutTestJob runs the test Job of the attempt of the revision. It
+// returns nil while the Job is running. Finished Jobs are removed.
+func (c *Controller) runRolloutTestJob(inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment, revision string, attempt int32, timeout time.Duration) (*samplev1alpha1.PostRolloutTestResult, error) {
+	jobs := c.kubeclientset.BatchV1().Jobs(deployment.Namespace)
+	name := deployment.Name + "-test-" + revision
+	if attempt > 1 {
+		name += fmt.Sprintf("-%d", attempt)
+	}
+	name = naming.Truncate(name)
+	job, err := jobs.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = jobs.Create(newRolloutTestJob(inferenceJob, deployment, name, timeout))
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result *samplev1alpha1.PostRolloutTestResult
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			result = &samplev1alpha1.PostRolloutTestResult{Passed: true}
+		case batchv1.JobFailed:
+			result = &samplev1alpha1.PostRolloutTestResult{Message: fmt.Sprintf("test job %s failed: %s", name, cond.Message)}
+		}
+	}
+	if result == nil {
+		return nil, nil
+	}
+	if job.Status.StartTime != nil {
+		end := time.Now()
+		if job.Status.CompletionTime != nil {
+			end = job.Status.CompletionTime.Time
+		}
+		result.LatencyMilliseconds = end.Sub(job.Status.StartTime.Time).Nanoseconds() / int64(time.Millisecond)
+	}
+	propagation := metav1.DeletePropagationBackground
+	err = jobs.Delete(name, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	return result, nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func newRolloutTestJob(inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment, name string, timeout time.Duration) *batchv1.Job {
+	test := inferenceJob.Spec.PostRolloutTest
+	backoffLimit := int32(0)
+	deadline := int64(timeout / time.Second)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: deployment.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(inferenceJob, samplev1alpha1.SchemeGroupVersion.WithKind("InferenceJob")),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy:    corev1.RestartPolicyNever,
+					ImagePullSecrets: deployment.Spec.Template.Spec.ImagePullSecrets,
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: test.Image,
+							Args:  append([]string{}, test.Args...),
+							Env: []corev1.EnvVar{
+								{Name: "INFERENCE_DEPLOYMENT", Value: deployment.Name},
+								{Name: "INFERENCE_SELECTOR", Value: metav1.FormatLabelSelector(deployment.Spec.Selector)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	stampIdentity(&job.ObjectMeta, inferenceJob)
+	return job
+}
+
+// postRolloutReady reports whether the InferenceJob passed the post-rollout
+// test of the current revision of its Deployment.
+func postRolloutReady(deployment *appsv1.Deployment, result *samplev1alpha1.PostRolloutTestResult) bool {
+	return result != nil && result.Passed && result.Revision == deployment.Annotations[TemplateHashAnnotation] && rolloutComplete(deployment)
+}
+
+// promotable reports whether the InferenceJob may be promoted, which for
+// InferenceJobs with a post-rollout test requires the Ready condition.
+func promotable(inferenceJob *samplev1alpha1.InferenceJob) bool {
+	if inferenceJob.Spec.PostRolloutTest == nil {
+		return true
+	}
+	cond := getCondition(inferenceJob.Status, samplev1alpha1.Ready)
+	return cond != nil && cond.Status == corev1.ConditionTrue
+}
+
+// setReadyCondition sets the Ready condition of InferenceJobs with a
+// post-rollout test from the latest result. The revision only fails once
+// the test failed its last attempt.
+func setReadyCondition(status *samplev1alpha1.InferenceJobStatus, test *samplev1alpha1.PostRolloutTest, deployment *appsv1.Deployment, result *samplev1alpha1.PostRolloutTestResult) {
+	switch {
+	case postRolloutReady(deployment, result):
+		setCondition(status, newCondition(samplev1alpha1.Ready, corev1.ConditionTrue, SuccessPostRolloutTest, ""))
+	case result != nil && result.Revision == deployment.Annotations[TemplateHashAnnotation] && !result.Passed && result.Attempts >= postRolloutTestAttempts(test):
+		setCondition(status, newCondition(samplev1alpha1.Ready, corev1.ConditionFalse, ErrPostRolloutTest, result.Message))
+	default:
+		setCondition(status, newCondition(samplev1alpha1.Ready, corev1.ConditionFalse, "RolloutInProgress", ""))
+	}
+}
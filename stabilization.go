@@ -0,0 +1,73 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// downscaleStabilization returns the downscale stabilization window of the
+// InferenceJob, zero if it has none. Tier changes and hibernation are
+// explicit and aren't held back.
+func downscaleStabilization(inferenceJob *samplev1alpha1.InferenceJob) time.Duration {
+	if tiered(inferenceJob) || hibernated(inferenceJob) || inferenceJob.Spec.Autoscaling == nil || inferenceJob.Spec.Autoscaling.DownscaleStabilizationSeconds == nil {
+		return 0
+	}
+	return time.Duration(*inferenceJob.Spec.Autoscaling.DownscaleStabilizationSeconds) * time.Second
+}
+
+// stabilizedReplicas returns the replica count to apply to the Deployment.
+// A reduction is only applied once the PendingScaleDown recorded in status
+// by a previous sync is older than the stabilization window; until then the
+// current replica count is kept and the key is requeued for when the window
+// ends.
+func (c *Controller) stabilizedReplicas(key string, inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment) *int32 {
+	desired := tierReplicas(inferenceJob)
+	window := downscaleStabilization(inferenceJob)
+	if desired == nil || deployment.Spec.Replicas == nil || window == 0 || *desired >= *deployment.Spec.Replicas {
+		return desired
+	}
+
+	pending := inferenceJob.Status.PendingScaleDown
+	if pending == nil || pending.Replicas != *desired {
+		c.workqueue.AddAfter(key, window)
+		return deployment.Spec.Replicas
+	}
+	if remaining := window - time.Since(pending.Since.Time); remaining > 0 {
+		c.workqueue.AddAfter(key, remaining)
+		return deployment.Spec.Replicas
+	}
+	return desired
+}
+
+// pendingScaleDown returns the PendingScaleDown to record in status, keeping
+// the start of the window of an unchanged target.
+func pendingScaleDown(inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment) *samplev1alpha1.PendingScaleDown {
+	desired := tierReplicas(inferenceJob)
+	if desired == nil || deployment.Spec.Replicas == nil || downscaleStabilization(inferenceJob) == 0 || *desired >= *deployment.Spec.Replicas {
+		return nil
+	}
+	if pending := inferenceJob.Status.PendingScaleDown; pending != nil && pending.Replicas == *desired {
+		return pending.DeepCopy()
+	}
+	return &samplev1alpha1.PendingScaleDown{Replicas: *desired, Since: metav1.Now()}
+}
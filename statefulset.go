@@ -0,0 +1,341 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// statefulSetPollInterval is how often InferenceJobs running in a
+// StatefulSet are synced until all replicas are ready. StatefulSets aren't
+// watched by the controller.
+const statefulSetPollInterval = 10 * time.Second
+
+// defaultClusterDomain is the DNS domain of the cluster unless overridden
+// with --cluster-domain.
+const defaultClusterDomain = "cluster.local"
+
+// newStatefulSet renders the StatefulSet of an InferenceJob with
+// spec.workloadType StatefulSet. Its pods are the ones newDeployment
+// renders, it is governed by the headless Service of the same name unless
+// syncStatefulSet names it from a Service template.
+func newStatefulSet(inferenceJob *samplev1alpha1.InferenceJob) *appsv1.StatefulSet {
+	deployment := newDeployment(inferenceJob)
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: deployment.ObjectMeta,
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    deployment.Spec.Replicas,
+			Selector:    deployment.Spec.Selector,
+			Template:    deployment.Spec.Template,
+			ServiceName: deployment.Name,
+			// Model servers don't depend on each other, start and stop
+			// them all at once.
+			PodManagementPolicy:  appsv1.ParallelPodManagement,
+			RevisionHistoryLimit: deployment.Spec.RevisionHistoryLimit,
+		},
+	}
+	for i := range inferenceJob.Spec.VolumeClaimTemplates {
+		statefulSet.Spec.VolumeClaimTemplates = append(statefulSet.Spec.VolumeClaimTemplates, *inferenceJob.Spec.VolumeClaimTemplates[i].DeepCopy())
+	}
+	return statefulSet
+}
+
+// newHeadlessService renders the headless Service giving the pods of the
+// StatefulSet their stable network identities.
+func newHeadlessService(statefulSet *appsv1.StatefulSet) *corev1.Service {
+	labels := map[string]string{}
+	for k, v := range statefulSet.Labels {
+		labels[k] = v
+	}
+	if ref := metav1.GetControllerOf(statefulSet); ref != nil {
+		labels[InferenceJobLabel] = ref.Name
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            statefulSet.Spec.ServiceName,
+			Namespace:       statefulSet.Namespace,
+			Labels:          labels,
+			OwnerReferences: statefulSet.OwnerReferences,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  statefulSet.Spec.Selector.MatchLabels,
+		},
+	}
+	for _, port := range statefulSet.Spec.Template.Spec.Containers[0].Ports {
+		name := port.Name
+		if name == "" {
+			name = fmt.Sprintf("port-%d", port.ContainerPort)
+		}
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name:     name,
+			Port:     port.ContainerPort,
+			Protocol: port.Protocol,
+		})
+	}
+	return service
+}
+
+// serviceEndpoint returns the cluster DNS name of the Service and the URL of
+// its first port.
+func serviceEndpoint(service *corev1.Service, clusterDomain string) (string, string) {
+	address := fmt.Sprintf("%s.%s.svc.%s", service.Name, service.Namespace, clusterDomain)
+	if len(service.Spec.Ports) == 0 {
+		return address, ""
+	}
+	return address, fmt.Sprintf("http://%s:%d", address, service.Spec.Ports[0].Port)
+}
+
+// syncStatefulSet reconciles the StatefulSet and headless Service of an
+// InferenceJob with spec.workloadType StatefulSet, in place of its
+// Deployment.
+func (c *Controller) syncStatefulSet(key string, inferenceJob, named *samplev1alpha1.InferenceJob) error {
+	desired := newStatefulSet(named)
+	statefulSets := c.kubeclientset.AppsV1().StatefulSets(desired.Namespace)
+	statefulSet, getErr := statefulSets.Get(desired.Name, metav1.GetOptions{})
+	switch {
+	case getErr == nil:
+		// The Service governing a StatefulSet can't be changed.
+		desired.Spec.ServiceName = statefulSet.Spec.ServiceName
+	case errors.IsNotFound(getErr):
+		serviceName, err := c.serviceName(inferenceJob, desired.Name)
+		if err != nil {
+			// Absorbed like invalid Deployment names, see syncHandler.
+			utilruntime.HandleError(fmt.Errorf("%s: %s", key, err.Error()))
+			return nil
+		}
+		desired.Spec.ServiceName = serviceName
+	default:
+		c.recordResourceError(inferenceJob, "StatefulSet", desired.Name, getErr)
+		return getErr
+	}
+
+	service, err := c.syncHeadlessService(inferenceJob, newHeadlessService(desired))
+	if err == errWriteThrottled {
+		c.workqueue.AddAfter(key, writeThrottleRetry)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if errors.IsNotFound(getErr) {
+		statefulSet, err = c.writeStatefulSet(desired, statefulSets.Create)
+	}
+	if err == errWriteThrottled {
+		c.workqueue.AddAfter(key, writeThrottleRetry)
+		return nil
+	}
+	if err != nil {
+		c.recordResourceError(inferenceJob, "StatefulSet", desired.Name, err)
+		return err
+	}
+	if !metav1.IsControlledBy(statefulSet, inferenceJob) {
+		msg := fmt.Sprintf(MessageResourceExists, statefulSet.Name)
+		c.recorder.Event(inferenceJob, corev1.EventTypeWarning, ErrResourceExists, msg)
+		return fmt.Errorf(msg)
+	}
+
+	if statefulSetDrifted(inferenceJob, desired, statefulSet) {
+		klog.V(4).Infof("InferenceJob %s replicas or pod template have drifted from statefulset %s", inferenceJob.Name, statefulSet.Name)
+		// Most of the spec of a StatefulSet is immutable, only the
+		// replicas, pod template and update settings are updated.
+		statefulSetCopy := statefulSet.DeepCopy()
+		statefulSetCopy.Labels = desired.Labels
+		statefulSetCopy.Annotations = desired.Annotations
+		statefulSetCopy.Spec.Replicas = desired.Spec.Replicas
+		statefulSetCopy.Spec.Template = desired.Spec.Template
+		statefulSetCopy.Spec.RevisionHistoryLimit = desired.Spec.RevisionHistoryLimit
+		statefulSet, err = c.writeStatefulSet(statefulSetCopy, statefulSets.Update)
+	}
+	if err == errWriteThrottled {
+		c.workqueue.AddAfter(key, writeThrottleRetry)
+		return nil
+	}
+	if err != nil {
+		c.recordResourceError(inferenceJob, "StatefulSet", desired.Name, err)
+		return err
+	}
+
+	// The Deployments or DaemonSet the InferenceJob ran in before are
+	// replaced.
+	if err := c.deleteControlledDeployments(inferenceJob); err != nil {
+		return err
+	}
+	if err := c.deleteWorkloads(inferenceJob, "DaemonSet"); err != nil {
+		return err
+	}
+	if statefulSet.Spec.Replicas != nil && statefulSet.Status.ReadyReplicas != *statefulSet.Spec.Replicas {
+		c.workqueue.AddAfter(key, statefulSetPollInterval)
+	}
+
+	if err := c.updateStatefulSetStatus(inferenceJob, statefulSet, service); err != nil {
+		return err
+	}
+	c.scheduleReconcile(key, inferenceJob, time.Now())
+	c.recorder.Event(inferenceJob, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	return nil
+}
+
+// statefulSetDrifted reports whether the replicas or pod template of the
+// StatefulSet differ from the desired ones.
+func statefulSetDrifted(inferenceJob *samplev1alpha1.InferenceJob, desired, existing *appsv1.StatefulSet) bool {
+	if desired.Spec.Replicas != nil && (existing.Spec.Replicas == nil || *desired.Spec.Replicas != *existing.Spec.Replicas) {
+		return true
+	}
+	if desired.Annotations[TemplateHashAnnotation] != existing.Annotations[TemplateHashAnnotation] {
+		return true
+	}
+	return driftCorrection(inferenceJob) && !equality.Semantic.DeepDerivative(desired.Spec.Template, existing.Spec.Template)
+}
+
+// writeStatefulSet creates or updates the StatefulSet holding a write slot
+// of its namespace.
+func (c *Controller) writeStatefulSet(statefulSet *appsv1.StatefulSet, write func(*appsv1.StatefulSet) (*appsv1.StatefulSet, error)) (*appsv1.StatefulSet, error) {
+	release, ok := c.deploymentWrites.tryAcquire(statefulSet.Namespace)
+	if !ok {
+		return nil, errWriteThrottled
+	}
+	defer release()
+	return write(statefulSet)
+}
+
+// syncHeadlessService creates the headless Service of a StatefulSet and
+// updates its ports.
+func (c *Controller) syncHeadlessService(inferenceJob *samplev1alpha1.InferenceJob, desired *corev1.Service) (*corev1.Service, error) {
+	services := c.kubeclientset.CoreV1().Services(desired.Namespace)
+	service, err := services.Get(desired.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		release, ok := c.deploymentWrites.tryAcquire(desired.Namespace)
+		if !ok {
+			return nil, errWriteThrottled
+		}
+		defer release()
+		service, err = services.Create(desired)
+	}
+	if err != nil {
+		c.recordResourceError(inferenceJob, "Service", desired.Name, err)
+		return nil, err
+	}
+	if !metav1.IsControlledBy(service, inferenceJob) {
+		msg := fmt.Sprintf(MessageResourceExists, service.Name)
+		c.recorder.Event(inferenceJob, corev1.EventTypeWarning, ErrResourceExists, msg)
+		return nil, fmt.Errorf(msg)
+	}
+	if equality.Semantic.DeepEqual(service.Spec.Ports, desired.Spec.Ports) && service.Labels[InferenceJobLabel] == desired.Labels[InferenceJobLabel] {
+		return service, nil
+	}
+	release, ok := c.deploymentWrites.tryAcquire(desired.Namespace)
+	if !ok {
+		return nil, errWriteThrottled
+	}
+	defer release()
+	serviceCopy := service.DeepCopy()
+	serviceCopy.Labels = desired.Labels
+	serviceCopy.Spec.Ports = desired.Spec.Ports
+	if service, err = services.Update(serviceCopy); err != nil {
+		c.recordResourceError(inferenceJob, "Service", desired.Name, err)
+		return nil, err
+	}
+	return service, nil
+}
+
+// deleteControlledDeployments deletes every Deployment of the InferenceJob.
+func (c *Controller) deleteControlledDeployments(inferenceJob *samplev1alpha1.InferenceJob) error {
+	deployments, err := c.ownedDeployments(inferenceJob)
+	if err != nil {
+		return err
+	}
+	for _, deployment := range deployments {
+		if !metav1.IsControlledBy(deployment, inferenceJob) {
+			continue
+		}
+		klog.V(4).Infof("Deleting deployment %s replaced by a %s", deployment.Name, inferenceJob.Spec.WorkloadType)
+		err := c.kubeclientset.AppsV1().Deployments(deployment.Namespace).Delete(deployment.Name, nil)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteWorkloads deletes the resources of the given kinds an InferenceJob
+// listed in its status before it was switched to another workload type.
+func (c *Controller) deleteWorkloads(inferenceJob *samplev1alpha1.InferenceJob, kinds ...string) error {
+	for _, resource := range inferenceJob.Status.Resources {
+		if !containsString(kinds, resource.Kind) {
+			continue
+		}
+		var err error
+		switch resource.Kind {
+		case "StatefulSet":
+			klog.V(4).Infof("Deleting statefulset %s replaced by a %s", resource.Name, workloadType(inferenceJob))
+			err = c.kubeclientset.AppsV1().StatefulSets(inferenceJob.Namespace).Delete(resource.Name, nil)
+		case "DaemonSet":
+			klog.V(4).Infof("Deleting daemonset %s replaced by a %s", resource.Name, workloadType(inferenceJob))
+			err = c.kubeclientset.AppsV1().DaemonSets(inferenceJob.Namespace).Delete(resource.Name, nil)
+		case "Service":
+			err = c.kubeclientset.CoreV1().Services(inferenceJob.Namespace).Delete(resource.Name, nil)
+		}
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateStatefulSetStatus updates the status of an InferenceJob running in
+// a StatefulSet. Ready replicas are reported as available.
+func (c *Controller) updateStatefulSetStatus(inferenceJob *samplev1alpha1.InferenceJob, statefulSet *appsv1.StatefulSet, service *corev1.Service) error {
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	// NEVER modify objects from the store.
+	inferenceJobCopy := inferenceJob.DeepCopy()
+	inferenceJobCopy.Status.Replicas = replicas
+	inferenceJobCopy.Status.AvailableReplicas = statefulSet.Status.ReadyReplicas
+	inferenceJobCopy.Status.ReadyReplicas = statefulSet.Status.ReadyReplicas
+	inferenceJobCopy.Status.UpdatedReplicas = statefulSet.Status.UpdatedReplicas
+	inferenceJobCopy.Status.UnavailableReplicas = statefulSet.Status.Replicas - statefulSet.Status.ReadyReplicas
+	inferenceJobCopy.Status.NumberReady = 0
+	inferenceJobCopy.Status.LabelSelector = metav1.FormatLabelSelector(statefulSet.Spec.Selector)
+	inferenceJobCopy.Status.DeploymentGeneration = 0
+	inferenceJobCopy.Status.DeploymentName = ""
+	inferenceJobCopy.Status.TemplateHash = statefulSet.Annotations[TemplateHashAnnotation]
+	inferenceJobCopy.Status.Address, inferenceJobCopy.Status.URL = serviceEndpoint(service, c.clusterDomain)
+	inferenceJobCopy.Status.PendingScaleDown = nil
+	inferenceJobCopy.Status.ZoneSurge = 0
+	inferenceJobCopy.Status.PostRolloutTest = nil
+	inferenceJobCopy.Status.Resources = []samplev1alpha1.ResourceStatus{
+		{Kind: "StatefulSet", Name: statefulSet.Name, LastAppliedHash: statefulSet.Annotations[TemplateHashAnnotation], LastSyncTime: metav1.Now()},
+		{Kind: "Service", Name: service.Name, LastSyncTime: metav1.Now()},
+	}
+	setReplicaConditions(&inferenceJobCopy.Status, statefulSet.Status.ReadyReplicas, replicas)
+	return c.writeInferenceJobStatus(inferenceJob, inferenceJobCopy)
+}
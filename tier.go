@@ -0,0 +1,59 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// tierReplicas returns the replica count the InferenceJob runs with in its
+// tier, zero while it hibernates. Unknown tiers are treated as hot.
+func tierReplicas(inferenceJob *samplev1alpha1.InferenceJob) *int32 {
+	var replicas int32
+	if hibernated(inferenceJob) {
+		return &replicas
+	}
+	switch inferenceJob.Spec.Tier {
+	case samplev1alpha1.TierWarm:
+		replicas = 1
+	case samplev1alpha1.TierCold:
+		replicas = 0
+	default:
+		return inferenceJob.Spec.Replicas
+	}
+	return &replicas
+}
+
+// tiered reports whether the InferenceJob has been moved out of the hot
+// tier, in which case its replica count is set explicitly rather than
+// following traffic.
+func tiered(inferenceJob *samplev1alpha1.InferenceJob) bool {
+	return inferenceJob.Spec.Tier == samplev1alpha1.TierWarm || inferenceJob.Spec.Tier == samplev1alpha1.TierCold
+}
+
+// reactivating reports whether a tiered InferenceJob is being brought back
+// from zero replicas. The nodes may have garbage collected its image while
+// it was cold, so it is pulled again before the Deployment is scaled up.
+func reactivating(inferenceJob *samplev1alpha1.InferenceJob, desired, deployment *appsv1.Deployment) bool {
+	if inferenceJob.Spec.Tier == "" || inferenceJob.Spec.Tier == samplev1alpha1.TierCold {
+		return false
+	}
+	return deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0 &&
+		desired.Spec.Replicas != nil && *desired.Spec.Replicas > 0
+}
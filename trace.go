@@ -0,0 +1,81 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// TraceAnnotation, set to "true" on an InferenceJob, logs each step of its
+// syncs without raising the verbosity of the whole controller.
+const TraceAnnotation = "fabianoyoschitaki.io/trace"
+
+// traceVerbosity is the verbosity the sync steps of InferenceJobs that
+// aren't traced are logged at.
+const traceVerbosity = 6
+
+// traced returns whether the sync steps of the InferenceJob are logged
+// regardless of the verbosity.
+func (c *Controller) traced(inferenceJob *samplev1alpha1.InferenceJob) bool {
+	return c.traceAll || (inferenceJob != nil && inferenceJob.Annotations[TraceAnnotation] == "true")
+}
+
+// trace logs a sync step of the InferenceJob with the given key, followed
+// by the key/value pairs describing it, e.g.
+//
+//	trace inferenceJob="default/example" step="patch deployment" name="example-deployment"
+//
+// Steps of InferenceJobs traced by --trace or TraceAnnotation are always
+// logged, the others only at traceVerbosity.
+func (c *Controller) trace(key, step string, keysAndValues ...interface{}) {
+	if !c.traceAll && !bool(klog.V(traceVerbosity)) {
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			return
+		}
+		inferenceJob, err := c.inferenceJobsLister.InferenceJobs(namespace).Get(name)
+		if err != nil || !c.traced(inferenceJob) {
+			return
+		}
+	}
+	klog.InfoDepth(1, traceLine(key, step, keysAndValues...))
+}
+
+// traceLine formats a sync step as key/value pairs. A trailing key without
+// a value is dropped.
+func traceLine(key, step string, keysAndValues ...interface{}) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "trace inferenceJob=%q step=%q", key, step)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fmt.Fprintf(&b, " %v=", keysAndValues[i])
+		switch v := keysAndValues[i+1].(type) {
+		case string:
+			fmt.Fprintf(&b, "%q", v)
+		case error:
+			fmt.Fprintf(&b, "%q", v.Error())
+		default:
+			fmt.Fprintf(&b, "%v", v)
+		}
+	}
+	return b.String()
+}
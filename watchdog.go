@@ -0,0 +1,183 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/klog"
+
+	clientset "k8s.io/sample-controller/pkg/generated/clientset/versioned"
+	listers "k8s.io/sample-controller/pkg/generated/listers/samplecontroller/v1alpha1"
+)
+
+// watchdogSampleSize is the number of objects of each resource read
+// directly from the API server on every check.
+const watchdogSampleSize = 50
+
+// watchdogResources are the resources sampled by the cache watchdog, the
+// first part of the keys of the sampled objects.
+var watchdogResources = []string{"deployment", "inferencejob"}
+
+// cacheLag tracks an object whose cached copy differs from the API server.
+type cacheLag struct {
+	// cachedVersion is the resourceVersion cached when the difference was
+	// first seen, empty if the object wasn't cached.
+	cachedVersion string
+	since         time.Time
+}
+
+// cacheWatchdog detects informer caches that stopped receiving events, e.g.
+// because their watch broke silently. It periodically lists a sample of
+// objects from the API server and compares them with the listers. An object
+// the API server changed whose cached copy hasn't moved for longer than
+// maxStaleness means the cache is stale.
+type cacheWatchdog struct {
+	kubeclientset       kubernetes.Interface
+	sampleclientset     clientset.Interface
+	deploymentsLister   appslisters.DeploymentLister
+	inferenceJobsLister listers.InferenceJobLister
+	maxStaleness        time.Duration
+	// namespace is the namespace the listers are limited to, all
+	// namespaces if empty.
+	namespace string
+	// metrics, if set, records the stale objects of every check.
+	metrics *controllerMetrics
+	// exitOnStale exits the process when the caches are stale.
+	exitOnStale bool
+
+	lags map[string]cacheLag
+}
+
+func newCacheWatchdog(
+	kubeclientset kubernetes.Interface,
+	sampleclientset clientset.Interface,
+	deploymentsLister appslisters.DeploymentLister,
+	inferenceJobsLister listers.InferenceJobLister,
+	maxStaleness time.Duration) *cacheWatchdog {
+	return &cacheWatchdog{
+		kubeclientset:       kubeclientset,
+		sampleclientset:     sampleclientset,
+		deploymentsLister:   deploymentsLister,
+		inferenceJobsLister: inferenceJobsLister,
+		maxStaleness:        maxStaleness,
+		lags:                map[string]cacheLag{},
+	}
+}
+
+// Run checks the caches every interval until stopCh is closed, exporting
+// the stale objects found in inferencejob_stale_cache_objects. A stale cache
+// can't be re-listed in place, shared informers don't support it, so with
+// exitOnStale the process exits and the caches are rebuilt by a fresh LIST
+// when it is restarted. Otherwise the stale objects are only reported.
+func (w *cacheWatchdog) Run(interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		stale, err := w.check(time.Now())
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("error sampling objects for the cache watchdog: %s", err.Error()))
+			return
+		}
+		if w.metrics != nil {
+			w.metrics.observeStaleCache(stale)
+		}
+		if len(stale) == 0 {
+			return
+		}
+		if w.exitOnStale {
+			klog.Fatalf("Informer caches are stale, %d sampled objects haven't caught up for %s, e.g. %s; restarting to re-list", len(stale), w.maxStaleness, stale[0])
+		}
+		utilruntime.HandleError(fmt.Errorf("informer caches are stale, %d sampled objects haven't caught up for %s, e.g. %s", len(stale), w.maxStaleness, stale[0]))
+	}, interval, stopCh)
+}
+
+// check compares a fresh sample of objects with the listers and returns the
+// keys of the objects lagging behind for longer than maxStaleness.
+func (w *cacheWatchdog) check(now time.Time) ([]string, error) {
+	// Quorum reads, an empty resourceVersion bypasses the watch cache.
+	options := metav1.ListOptions{Limit: watchdogSampleSize}
+	live := map[string]string{}
+	cached := map[string]string{}
+
+	deployments, err := w.kubeclientset.AppsV1().Deployments(w.namespace).List(options)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		key := "deployment/" + d.Namespace + "/" + d.Name
+		live[key] = d.ResourceVersion
+		cached[key] = ""
+		if c, err := w.deploymentsLister.Deployments(d.Namespace).Get(d.Name); err == nil {
+			cached[key] = c.ResourceVersion
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	inferenceJobs, err := w.sampleclientset.SamplecontrollerV1alpha1().InferenceJobs(w.namespace).List(options)
+	if err != nil {
+		return nil, err
+	}
+	for i := range inferenceJobs.Items {
+		j := &inferenceJobs.Items[i]
+		key := "inferencejob/" + j.Namespace + "/" + j.Name
+		live[key] = j.ResourceVersion
+		cached[key] = ""
+		if c, err := w.inferenceJobsLister.InferenceJobs(j.Namespace).Get(j.Name); err == nil {
+			cached[key] = c.ResourceVersion
+		} else if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	return w.observe(live, cached, now), nil
+}
+
+// observe updates the tracked lags from the live and cached resourceVersions
+// of the sampled objects and returns the keys lagging for too long. A lag
+// ends as soon as the cached copy changes, resourceVersions can't be ordered
+// so any event delivered to the cache counts as progress.
+func (w *cacheWatchdog) observe(live, cached map[string]string, now time.Time) []string {
+	var stale []string
+	for key, liveVersion := range live {
+		cachedVersion := cached[key]
+		lag, tracked := w.lags[key]
+		switch {
+		case cachedVersion == liveVersion, tracked && cachedVersion != lag.cachedVersion:
+			delete(w.lags, key)
+		case !tracked:
+			w.lags[key] = cacheLag{cachedVersion: cachedVersion, since: now}
+		case now.Sub(lag.since) > w.maxStaleness:
+			stale = append(stale, key)
+		}
+	}
+	// Objects that left the sample, e.g. because they were deleted, are
+	// sampled again from scratch.
+	for key := range w.lags {
+		if _, ok := live[key]; !ok {
+			delete(w.lags, key)
+		}
+	}
+	return stale
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+	"k8s.io/sample-controller/pkg/policy"
+)
+
+// validatingWebhookPath is the path the validating admission webhook for
+// InferenceJobs is served on.
+const validatingWebhookPath = "/validate-inferencejobs"
+
+// validatingWebhook rejects InferenceJobs violating any rule of its policy
+// engine. Only enforced rules belong in this engine, advisory rules are
+// reported by the controller through the PolicyViolations condition.
+type validatingWebhook struct {
+	policy *policy.Engine
+}
+
+func (wh *validatingWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	review := admissionv1beta1.AdmissionReview{}
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "malformed admission review", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = wh.validate(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+	data, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		utilruntime.HandleError(fmt.Errorf("error writing admission response: %s", err.Error()))
+	}
+}
+
+func (wh *validatingWebhook) validate(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	inferenceJob := &samplev1alpha1.InferenceJob{}
+	if err := json.Unmarshal(req.Object.Raw, inferenceJob); err != nil {
+		return &admissionv1beta1.AdmissionResponse{
+			Result: &metav1.Status{Status: metav1.StatusFailure, Code: http.StatusBadRequest, Message: err.Error()},
+		}
+	}
+	if inferenceJob.Name == "" {
+		inferenceJob.Name = req.Name
+	}
+
+	violations := wh.policy.Evaluate(inferenceJob)
+	if len(violations) == 0 {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	klog.V(4).Infof("Denying inferenceJob %s/%s: %s", req.Namespace, inferenceJob.Name, policy.Summary(violations))
+	return &admissionv1beta1.AdmissionResponse{
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusForbidden,
+			Reason:  metav1.StatusReasonForbidden,
+			Message: policy.Summary(violations),
+		},
+	}
+}
+
+// serveWebhooks serves the admission webhooks over TLS until stopCh is
+// closed.
+func serveWebhooks(addr string, wh *validatingWebhook, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error), stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle(validatingWebhookPath, wh)
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   mux,
+		TLSConfig: &tls.Config{GetCertificate: getCertificate},
+	}
+	go func() {
+		<-stopCh
+		server.Close()
+	}()
+	go func() {
+		klog.Infof("Serving admission webhooks on %s", addr)
+		if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			klog.Fatalf("Error serving admission webhooks: %s", err.Error())
+		}
+	}()
+}
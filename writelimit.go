@@ -0,0 +1,103 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// writeThrottleRetry is how long an InferenceJob waits for a write slot of
+// its namespace.
+const writeThrottleRetry = time.Second
+
+// errWriteThrottled is returned by Deployment writes while every write slot
+// of the namespace is taken.
+var errWriteThrottled = errors.New("too many concurrent deployment writes in namespace")
+
+// namespaceLimiter bounds the concurrent writes per namespace, so one
+// tenant's mass update can't take up every worker and starve the
+// InferenceJobs of other namespaces. Writes are never waited for, the
+// InferenceJob is requeued instead.
+type namespaceLimiter struct {
+	// limit is the number of concurrent writes per namespace, 0 for no
+	// limit.
+	limit int
+
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func newNamespaceLimiter(limit int) *namespaceLimiter {
+	return &namespaceLimiter{limit: limit, inFlight: map[string]int{}}
+}
+
+// tryAcquire takes a write slot of the namespace. It returns false if none
+// is free, otherwise the slot must be released by calling release.
+func (l *namespaceLimiter) tryAcquire(namespace string) (release func(), ok bool) {
+	if l.limit <= 0 {
+		return func() {}, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[namespace] >= l.limit {
+		return nil, false
+	}
+	l.inFlight[namespace]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.inFlight[namespace]--; l.inFlight[namespace] == 0 {
+			delete(l.inFlight, namespace)
+		}
+	}, true
+}
+
+// applyDeployment server-side applies the Deployment holding a write slot
+// of its namespace. It creates the Deployment if it doesn't exist. The
+// request is cancelled with ctx.
+func (c *Controller) applyDeployment(ctx context.Context, deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := applyConfiguration(deployment)
+	if err != nil {
+		return nil, err
+	}
+	release, ok := c.deploymentWrites.tryAcquire(deployment.Namespace)
+	if !ok {
+		return nil, errWriteThrottled
+	}
+	defer release()
+	return c.deploymentApplier.Apply(ctx, deployment.Namespace, deployment.Name, data)
+}
+
+// patchDeployment updates a drifted Deployment to the desired one with the
+// same apply patch it was created with. The API server only changes the
+// fields that differ and drops the ones the controller no longer sets, as
+// it owns them, so fields set by others don't cause a rollout.
+func (c *Controller) patchDeployment(ctx context.Context, desired *appsv1.Deployment) (*appsv1.Deployment, error) {
+	patched, err := c.applyDeployment(ctx, desired)
+	if err == nil {
+		c.metrics.deploymentUpdated()
+	}
+	return patched, err
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	samplev1alpha1 "k8s.io/sample-controller/pkg/apis/samplecontroller/v1alpha1"
+)
+
+// zoneLabel is the node label holding the failure domain of the node.
+const zoneLabel = "failure-domain.beta.kubernetes.io/zone"
+
+const (
+	// ErrZoneCheckUnavailable is used as part of the Event 'reason' when
+	// spec.minReplicasPerZone can't be honored because nodes aren't
+	// watched.
+	ErrZoneCheckUnavailable = "ZoneCheckUnavailable"
+	// MessageZoneCheckUnavailable is the message used for Events when nodes
+	// aren't watched.
+	MessageZoneCheckUnavailable = "Nodes aren't watched, replicas aren't added during zone outages"
+)
+
+// canWatchNodes reports whether the controller is allowed to list and watch
+// nodes. Controllers deployed with namespaced permissions aren't.
+func canWatchNodes(client kubernetes.Interface) (bool, error) {
+	for _, verb := range []string{"list", "watch"} {
+		review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(&authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{Verb: verb, Resource: "nodes"},
+			},
+		})
+		if err != nil {
+			return false, err
+		}
+		if !review.Status.Allowed {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// watchNodes makes the controller read the zones of nodes from the informer
+// cache, and sync the InferenceJobs keeping replicas per zone when a node
+// becomes ready or unready.
+func (c *Controller) watchNodes(nodeInformer coreinformers.NodeInformer) {
+	c.nodesLister = nodeInformer.Lister()
+	c.nodesSynced = nodeInformer.Informer().HasSynced
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, new interface{}) {
+			oldNode, newNode := old.(*corev1.Node), new.(*corev1.Node)
+			if nodeReady(oldNode) != nodeReady(newNode) || oldNode.Labels[zoneLabel] != newNode.Labels[zoneLabel] {
+				c.enqueueZonedInferenceJobs()
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.enqueueZonedInferenceJobs()
+		},
+	})
+}
+
+// enqueueZonedInferenceJobs enqueues the InferenceJobs with
+// spec.minReplicasPerZone.
+func (c *Controller) enqueueZonedInferenceJobs() {
+	inferenceJobs, err := c.inferenceJobsLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, inferenceJob := range inferenceJobs {
+		if inferenceJob.Spec.MinReplicasPerZone != nil {
+			c.enqueueInferenceJob(inferenceJob)
+		}
+	}
+}
+
+// zoneSurge returns the number of replicas to add to the Deployment so the
+// available zones keep spec.minReplicasPerZone replicas during a zone
+// outage. The surge is the current shortfall of the available zones, kept
+// while the outage lasts so the replicas it brought up don't flap, and is
+// capped at the minimum of every available zone as the scheduler may place
+// surged pods in zones already meeting it. It is dropped once every zone is
+// back. Without access to nodes no replicas are added.
+func (c *Controller) zoneSurge(inferenceJob *samplev1alpha1.InferenceJob, deployment *appsv1.Deployment) (int32, error) {
+	min := inferenceJob.Spec.MinReplicasPerZone
+	if min == nil || *min <= 0 {
+		return 0, nil
+	}
+	if c.nodesLister == nil {
+		c.recorder.Event(inferenceJob, corev1.EventTypeWarning, ErrZoneCheckUnavailable, MessageZoneCheckUnavailable)
+		return 0, nil
+	}
+
+	nodes, err := c.nodesLister.List(labels.Everything())
+	if err != nil {
+		return 0, err
+	}
+	nodeZones := map[string]string{}
+	// available records whether each zone has a ready node.
+	available := map[string]bool{}
+	for _, node := range nodes {
+		zone := node.Labels[zoneLabel]
+		if zone == "" {
+			continue
+		}
+		nodeZones[node.Name] = zone
+		available[zone] = available[zone] || nodeReady(node)
+	}
+	outage := false
+	for _, ok := range available {
+		if !ok {
+			outage = true
+		}
+	}
+	if !outage {
+		return 0, nil
+	}
+
+	pods, err := c.deploymentPods(deployment)
+	if err != nil {
+		return 0, err
+	}
+	// Pods scheduled to a zone count towards it even if not ready yet,
+	// unscheduled ones may still land in any zone short of replicas.
+	perZone := map[string]int32{}
+	var live, unscheduled int32
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		live++
+		if pod.Spec.NodeName == "" {
+			unscheduled++
+			continue
+		}
+		perZone[nodeZones[pod.Spec.NodeName]]++
+	}
+	// The replicas the ReplicaSet hasn't created pods for yet, e.g. right
+	// after the surge was applied, are unscheduled too.
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas > live {
+		unscheduled += *deployment.Spec.Replicas - live
+	}
+	var shortfall, availableZones int32
+	for zone, ok := range available {
+		if !ok {
+			continue
+		}
+		availableZones++
+		if perZone[zone] < *min {
+			shortfall += *min - perZone[zone]
+		}
+	}
+	if shortfall -= unscheduled; shortfall < 0 {
+		shortfall = 0
+	}
+	surge := inferenceJob.Status.ZoneSurge
+	if shortfall > surge {
+		surge = shortfall
+	}
+	if limit := *min * availableZones; surge > limit {
+		surge = limit
+	}
+	return surge, nil
+}
+
+// surgedReplicas raises replicas to the replicas of the InferenceJob plus
+// the zone surge. The stabilized replicas may already include the surge.
+// InferenceJobs scaled to zero, cold or hibernating, aren't surged.
+func surgedReplicas(inferenceJob *samplev1alpha1.InferenceJob, replicas *int32, zoneSurge int32) *int32 {
+	base := tierReplicas(inferenceJob)
+	if zoneSurge == 0 || base == nil || *base == 0 || replicas == nil {
+		return replicas
+	}
+	surged := *base + zoneSurge
+	if surged <= *replicas {
+		return replicas
+	}
+	return &surged
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}